@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	defaultAnilistEndpoint = "https://graphql.anilist.co"
+	anilistAuthorizeURL    = "https://anilist.co/api/v2/oauth/authorize"
+)
+
+// anilistEndpoint can be pointed at a local stub server with ANIGARDEN_ANILIST_URL
+func anilistEndpoint() string {
+	if endpoint := os.Getenv("ANIGARDEN_ANILIST_URL"); endpoint != "" {
+		return endpoint
+	}
+	return defaultAnilistEndpoint
+}
+
+// anilistLoginURL is where the user authorizes anigarden, anilist's implicit grant
+// shows the token on the page for the user to paste back
+func anilistLoginURL(clientId string) string {
+	return fmt.Sprintf("%s?client_id=%s&response_type=token", anilistAuthorizeURL, clientId)
+}
+
+var errAnilistLoggedOut = errors.New("not logged in to anilist, run anigarden anilist login")
+
+// errAnilistTokenInvalid is returned once the pasted token expired or was revoked, the implicit
+// grant has no refresh token so the user has to log in again, tokens last a year
+var errAnilistTokenInvalid = errors.New("anilist token expired or was revoked, run anigarden anilist login again")
+
+type anilistCredentials struct {
+	Token    string `json:"token"`
+	UserID   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+}
+
+var anilistStatuses = map[string]watchStatus{
+	"CURRENT":   statusWatching,
+	"REPEATING": statusWatching,
+	"COMPLETED": statusCompleted,
+	"PAUSED":    statusOnHold,
+	"DROPPED":   statusDropped,
+	"PLANNING":  statusPlanToWatch,
+}
+
+func anilistStatus(status watchStatus) string {
+	switch status {
+	case statusWatching:
+		return "CURRENT"
+	case statusCompleted:
+		return "COMPLETED"
+	case statusOnHold:
+		return "PAUSED"
+	case statusDropped:
+		return "DROPPED"
+	default:
+		return "PLANNING"
+	}
+}
+
+// anilistQuery posts a graphql query and decodes its data into data
+func anilistQuery(token, query string, variables map[string]any, data any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, anilistEndpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	response := struct {
+		Data   any `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{Data: data}
+	if res.StatusCode == http.StatusUnauthorized {
+		return errAnilistTokenInvalid
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("anilist responded with %s", res.Status)
+	}
+	if len(response.Errors) > 0 {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		if token != "" && slices.Contains(messages, "Invalid token") {
+			return errAnilistTokenInvalid
+		}
+		return fmt.Errorf("anilist: %s", strings.Join(messages, ", "))
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("anilist responded with %s", res.Status)
+	}
+	return nil
+}
+
+func loadAnilistCredentials() (anilistCredentials, error) {
+	var creds anilistCredentials
+	err := loadCredentials("anilist", &creds)
+	if os.IsNotExist(err) || (err == nil && creds.Token == "") {
+		return creds, errAnilistLoggedOut
+	}
+	return creds, err
+}
+
+// anilistLogin checks a token by asking anilist who it belongs to and stores it
+func anilistLogin(token string) (anilistCredentials, error) {
+	var data struct {
+		Viewer struct {
+			ID   int    `json:"id"`
+			Name string `json:"name"`
+		} `json:"Viewer"`
+	}
+	if err := anilistQuery(token, `query { Viewer { id name } }`, nil, &data); err != nil {
+		return anilistCredentials{}, err
+	}
+
+	creds := anilistCredentials{token, data.Viewer.ID, data.Viewer.Name}
+	return creds, saveCredentials("anilist", creds)
+}
+
+func anilistLogout() error {
+	return removeCredentials("anilist")
+}
+
+// anilistService pushes watchlist changes to anilist
+type anilistService struct{}
+
+func (anilistService) name() string {
+	return "anilist"
+}
+
+func (anilistService) enabled() bool {
+	_, err := loadAnilistCredentials()
+	return err == nil
+}
+
+func (anilistService) push(entry watchlistEntry, progress int) error {
+	creds, err := loadAnilistCredentials()
+	if err != nil {
+		return err
+	}
+
+	ids, err := lookupIds(entry.animeId)
+	if err != nil {
+		return err
+	}
+	if ids.anilist == 0 {
+		return errNoServiceId
+	}
+
+	status := anilistStatus(entry.status)
+	if entry.status == statusWatching && entry.rewatches > 0 {
+		status = "REPEATING"
+	}
+
+	vars := map[string]any{
+		"mediaId":  ids.anilist,
+		"status":   status,
+		"progress": progress,
+		"repeat":   entry.rewatches,
+	}
+	// unscored entries leave the score on anilist alone, a missing variable isn't saved
+	if entry.score > 0 {
+		vars["scoreRaw"] = entry.score * 10
+	}
+
+	return anilistQuery(creds.Token, `
+	mutation ($mediaId: Int, $status: MediaListStatus, $progress: Int, $scoreRaw: Int, $repeat: Int) {
+		SaveMediaListEntry(mediaId: $mediaId, status: $status, progress: $progress, scoreRaw: $scoreRaw, repeat: $repeat) { id }
+	}`, vars, nil)
+}
+
+type anilistEntry struct {
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Score    int    `json:"score"`
+	Repeat   int    `json:"repeat"`
+	Notes    string `json:"notes"`
+	Media    struct {
+		ID    int `json:"id"`
+		IDMal int `json:"idMal"`
+		Title struct {
+			Romaji  string `json:"romaji"`
+			English string `json:"english"`
+		} `json:"title"`
+	} `json:"media"`
+	CreatedAt int64 `json:"createdAt"`
+}
+
+func (e anilistEntry) title() string {
+	if e.Media.Title.English != "" {
+		return e.Media.Title.English
+	}
+	return e.Media.Title.Romaji
+}
+
+func getAnilistEntries(creds anilistCredentials) ([]anilistEntry, error) {
+	var data struct {
+		MediaListCollection struct {
+			Lists []struct {
+				Entries []anilistEntry `json:"entries"`
+			} `json:"lists"`
+		} `json:"MediaListCollection"`
+	}
+	err := anilistQuery(creds.Token, `
+	query ($userId: Int) {
+		MediaListCollection(userId: $userId, type: ANIME) {
+			lists {
+				entries {
+					status progress repeat notes createdAt
+					score(format: POINT_10)
+					media { id idMal title { romaji english } }
+				}
+			}
+		}
+	}`, map[string]any{"userId": creds.UserID}, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	// an anime shows up once per custom list it's in as well
+	seen := make(map[int]bool)
+	var entries []anilistEntry
+	for _, l := range data.MediaListCollection.Lists {
+		for _, e := range l.Entries {
+			if !seen[e.Media.ID] {
+				seen[e.Media.ID] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// matchAnilistEntry finds the hianime anime of an anilist entry, known ids are looked up before searching
+func matchAnilistEntry(e anilistEntry) (anime, bool, error) {
+	for _, known := range []struct {
+		service string
+		id      int
+	}{{"anilist", e.Media.ID}, {"myanimelist", e.Media.IDMal}} {
+		animeId, found, err := findAnimeId(known.service, known.id)
+		if err != nil || found {
+			return anime{ID: animeId, Name: e.title()}, found, err
+		}
+	}
+
+	return matchAnime([]string{e.Media.Title.English, e.Media.Title.Romaji}, func(d animeDetails) bool {
+		return d.AnilistID == e.Media.ID || (e.Media.IDMal != 0 && d.MalID == e.Media.IDMal)
+	})
+}
+
+// convertAnilistEntries matches anilist entries to hianime anime and turns them into an
+// anigarden export, titles of entries that couldn't be matched are returned separately
+func convertAnilistEntries(entries []anilistEntry, progress func(done, total int)) (export, []string, error) {
+	data := export{Version: exportVersion, ExportedAt: time.Now().UTC()}
+	var unmatched []string
+
+	for i, e := range entries {
+		if progress != nil {
+			progress(i+1, len(entries))
+		}
+
+		match, found, err := matchAnilistEntry(e)
+		if err != nil {
+			return data, nil, fmt.Errorf("failed to match %s: %w", e.title(), err)
+		}
+		if !found {
+			unmatched = append(unmatched, e.title())
+			continue
+		}
+
+		status, ok := anilistStatuses[e.Status]
+		if !ok {
+			status = statusPlanToWatch
+		}
+
+		entry := exportEntry{
+			AnimeID:   match.ID,
+			Status:    status,
+			Score:     e.Score,
+			Notes:     e.Notes,
+			Rewatches: e.Repeat,
+			Lists:     []string{"Watchlist"},
+			Sync:      true,
+		}
+		if e.CreatedAt > 0 {
+			entry.AddedAt = time.Unix(e.CreatedAt, 0).UTC()
+		}
+		data.Entries = append(data.Entries, entry)
+
+		if e.Progress > 0 {
+			history, err := watchedHistory(match.ID, e.Progress, time.Time{})
+			if err != nil {
+				return data, nil, err
+			}
+			data.History = append(data.History, history...)
+		}
+	}
+
+	return data, unmatched, nil
+}
+
+// anilistPull merges the anilist list of the logged in user into the local watchlist
+func anilistPull(dryRun bool, progress func(done, total int)) (importReport, []string, error) {
+	creds, err := loadAnilistCredentials()
+	if err != nil {
+		return importReport{}, nil, err
+	}
+
+	entries, err := getAnilistEntries(creds)
+	if err != nil {
+		return importReport{}, nil, err
+	}
+
+	data, unmatched, err := convertAnilistEntries(entries, progress)
+	if err != nil {
+		return importReport{}, nil, err
+	}
+
+	report, err := importData(data, importMerge, dryRun)
+	return report, unmatched, err
+}
+
+func pullAnilist() tea.Msg {
+	report, unmatched, err := anilistPull(false, nil)
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return importedMsg{report, len(unmatched)}
+}
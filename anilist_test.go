@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// anilistRequest is a graphql request sent to the stub server
+type anilistRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables"`
+	token     string
+}
+
+// useAnilistStub logs in to a local anilist that answers every query with response,
+// the requests it got are appended to requests
+func useAnilistStub(t *testing.T, response string, requests *[]anilistRequest) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req anilistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.token = r.Header.Get("Authorization")
+		*requests = append(*requests, req)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("ANIGARDEN_ANILIST_URL", server.URL)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if err := saveCredentials("anilist", anilistCredentials{Token: "secret", UserID: 7, UserName: "frieren"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnilistPush(t *testing.T) {
+	tests := []struct {
+		name      string
+		anilistId int
+		entry     watchlistEntry
+		progress  int
+		want      map[string]any
+		wantErr   error
+	}{
+		{
+			name:      "watching",
+			anilistId: 21,
+			entry:     watchlistEntry{animeId: "one-piece-100", status: statusWatching, score: 8},
+			progress:  3,
+			want:      map[string]any{"mediaId": 21.0, "status": "CURRENT", "progress": 3.0, "scoreRaw": 80.0, "repeat": 0.0},
+		},
+		{
+			name:      "rewatching",
+			anilistId: 21,
+			entry:     watchlistEntry{animeId: "one-piece-100", status: statusWatching, score: 10, rewatches: 2},
+			progress:  1,
+			want:      map[string]any{"mediaId": 21.0, "status": "REPEATING", "progress": 1.0, "scoreRaw": 100.0, "repeat": 2.0},
+		},
+		{
+			name:      "on hold",
+			anilistId: 21,
+			entry:     watchlistEntry{animeId: "one-piece-100", status: statusOnHold, score: 5},
+			want:      map[string]any{"mediaId": 21.0, "status": "PAUSED", "progress": 0.0, "scoreRaw": 50.0, "repeat": 0.0},
+		},
+		{
+			// the score on anilist is left alone
+			name:      "unscored",
+			anilistId: 21,
+			entry:     watchlistEntry{animeId: "one-piece-100", status: statusPlanToWatch},
+			want:      map[string]any{"mediaId": 21.0, "status": "PLANNING", "progress": 0.0, "repeat": 0.0},
+		},
+		{
+			name:    "unknown to anilist",
+			entry:   watchlistEntry{animeId: "one-piece-100", status: statusWatching},
+			wantErr: errNoServiceId,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []anilistRequest
+			useTestDB(t)
+			useAnilistStub(t, `{"data": {"SaveMediaListEntry": {"id": 1}}}`, &requests)
+			useFakeAPI(t, fakeAPI{"/anime/one-piece-100": `{"anime": {"info": {"id": "one-piece-100", "anilistId": ` + strconv.Itoa(tt.anilistId) + `}}}`})
+
+			err := anilistService{}.push(tt.entry, tt.progress)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("push = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(requests) != 0 {
+					t.Errorf("sent %d requests for an anime anilist doesn't know", len(requests))
+				}
+				return
+			}
+			if len(requests) != 1 {
+				t.Fatalf("sent %d requests, want 1", len(requests))
+			}
+			if requests[0].token != "Bearer secret" {
+				t.Errorf("authorization = %q", requests[0].token)
+			}
+			if !reflect.DeepEqual(requests[0].Variables, tt.want) {
+				t.Errorf("variables = %v, want %v", requests[0].Variables, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnilistQueryErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"message of anilist", `{"data": null, "errors": [{"message": "Not Found."}]}`, "anilist: Not Found."},
+		// the pasted token can't be refreshed, the user logs in again
+		{"expired token", `{"data": null, "errors": [{"message": "Invalid token"}]}`, errAnilistTokenInvalid.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []anilistRequest
+			useAnilistStub(t, tt.response, &requests)
+			err := anilistQuery("secret", `query { Viewer { id } }`, nil, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("err = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+// anilistCollection is a MediaListCollection response with Frieren in two lists
+const anilistCollection = `{"data": {"MediaListCollection": {"lists": [
+	{"entries": [{"status": "CURRENT", "progress": 2, "score": 9, "repeat": 1, "notes": "peak", "createdAt": 1735732800,
+		"media": {"id": 154587, "idMal": 52991, "title": {"romaji": "Sousou no Frieren", "english": "Frieren: Beyond Journey's End"}}}]},
+	{"entries": [{"status": "CURRENT", "progress": 2, "score": 9, "repeat": 1, "notes": "peak", "createdAt": 1735732800,
+		"media": {"id": 154587, "idMal": 52991, "title": {"romaji": "Sousou no Frieren", "english": "Frieren: Beyond Journey's End"}}},
+	{"status": "REWATCHING_SOON", "media": {"id": 1, "title": {"romaji": "Nothing Like It"}}}]}
+]}}}`
+
+// frierenAPI are the hianime routes the entries of anilistCollection are matched with
+var frierenAPI = fakeAPI{
+	"/search?q=Frieren%3A+Beyond+Journey%27s+End": `{"animes": [{"id": "frieren-18542", "name": "Frieren: Beyond Journey's End"}]}`,
+	"/anime/frieren-18542":                        `{"anime": {"info": {"id": "frieren-18542", "malId": 52991, "anilistId": 154587}}}`,
+	"/anime/frieren-18542/episodes": `{"episodes": [
+		{"episodeId": "frieren-18542?ep=1", "number": 1},
+		{"episodeId": "frieren-18542?ep=2", "number": 2},
+		{"episodeId": "frieren-18542?ep=3", "number": 3}]}`,
+	"/search?q=Nothing+Like+It": `{"animes": []}`,
+}
+
+func TestConvertAnilistEntries(t *testing.T) {
+	useTestDB(t)
+	var requests []anilistRequest
+	useAnilistStub(t, anilistCollection, &requests)
+	useFakeAPI(t, frierenAPI)
+
+	entries, err := getAnilistEntries(anilistCredentials{Token: "secret", UserID: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want the duplicate left out", len(entries))
+	}
+	if requests[0].Variables["userId"] != 7.0 {
+		t.Errorf("variables = %v, want the user id", requests[0].Variables)
+	}
+
+	data, unmatched, err := convertAnilistEntries(entries, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmatched, []string{"Nothing Like It"}) {
+		t.Errorf("unmatched = %q", unmatched)
+	}
+	if len(data.Entries) != 1 {
+		t.Fatalf("entries = %+v", data.Entries)
+	}
+	e := data.Entries[0]
+	if e.AnimeID != "frieren-18542" || e.Status != statusWatching || e.Score != 9 || e.Rewatches != 1 || e.Notes != "peak" ||
+		e.AddedAt.Unix() != 1735732800 || !reflect.DeepEqual(e.Lists, []string{"Watchlist"}) {
+		t.Errorf("entry = %+v", e)
+	}
+	if len(data.History) != 2 || data.History[1].EpisodeNumber != 2 {
+		t.Errorf("history = %+v, want the first two episodes", data.History)
+	}
+}
+
+func TestAnilistPull(t *testing.T) {
+	var requests []anilistRequest
+	useAnilistStub(t, anilistCollection, &requests)
+	useFakeAPI(t, frierenAPI)
+	useTestDB(t)
+
+	// what's local and left out on anilist stays
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, unmatched, err := anilistPull(false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.entriesAdded != 1 || report.historyAdded != 2 || len(unmatched) != 1 {
+		t.Errorf("report = %+v, unmatched %q", report, unmatched)
+	}
+
+	entries, err := getWatchlist(defaultListId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("watchlist = %+v, want frieren next to one piece", entries)
+	}
+	var progress int
+	if err := db.QueryRow(`SELECT MAX(episode_number) FROM history WHERE anime_id = 'frieren-18542'`).Scan(&progress); err != nil || progress != 2 {
+		t.Errorf("progress = %d, %v, want 2", progress, err)
+	}
+}
+
+func TestAnilistLoggedOut(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if _, _, err := anilistPull(true, nil); !errors.Is(err, errAnilistLoggedOut) {
+		t.Errorf("pulling while logged out = %v, want %v", err, errAnilistLoggedOut)
+	}
+	if (anilistService{}).enabled() {
+		t.Error("anilist is enabled without credentials")
+	}
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"os"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -15,10 +20,20 @@ import (
 // api returns a desc in the home route but doesn't return
 // a desc in the search route
 type anime struct {
-	ID     string   `json:"id"`
-	Name   string   `json:"name"`
-	Body   string   `json:"description"`
-	Genres []string `json:"genres"`
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Body     string        `json:"description"`
+	Genres   []string      `json:"genres"`
+	Poster   string        `json:"poster"`
+	Type     string        `json:"type"`
+	Rating   string        `json:"rating"` // age rating like 18+, search results only
+	Episodes episodeCounts `json:"episodes"`
+}
+
+// episodeCounts is how many episodes of an anime are out in sub and dub
+type episodeCounts struct {
+	Sub int `json:"sub"`
+	Dub int `json:"dub"`
 }
 
 type episode struct {
@@ -43,27 +58,105 @@ type streamingData struct {
 // lol "animes"
 // searchResultsMsg contains anime without a desc
 type (
-	errMsg           struct{ err error }
-	animesMsg        struct{ animes []anime }
-	episodesMsg      struct{ episodes []episode }
+	errMsg struct {
+		err   error
+		retry tea.Cmd // runs the failed command again, set by retryable
+	}
+	animesMsg   struct{ animes []anime }
+	episodesMsg struct {
+		episodes []episode
+		watched  map[int]bool // numbers of the episodes watched at least once
+	}
 	searchResultsMsg struct{ animes []anime }
 	animeInfoMsg     struct{ anime anime }
-	watchlistMsg     struct{ animes []anime }
+	watchlistMsg     struct {
+		lists  []animeList
+		listId int
+		items  []watchlistItem
+	}
+	entryMsg struct{ entry watchlistEntry }
 )
 
+// noticeMsg is a short non fatal message, shown as a toast and then on the status line
+type noticeMsg struct {
+	text string
+	err  error
+	warn bool // text is a warning rather than the result of an action
+}
+
 // list.item implementation
 func (a anime) Title() string {
 	return a.Name
 }
 
 func (a anime) Description() string {
-	return a.Body
+	return cleanDescription(a.Body)
+}
+
+var (
+	lineBreakTag = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+	htmlTag      = regexp.MustCompile(`<[^>]*>`)
+	blankLines   = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+// cleanDescription turns the html bits of api descriptions into plain text,
+// line breaks are kept and the remaining tags dropped
+func cleanDescription(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = lineBreakTag.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = blankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
 }
 
 func (a anime) FilterValue() string {
 	return a.Name
 }
 
+// watchlistItem is an anime shown in the watchlist along with its entry
+type watchlistItem struct {
+	anime
+	watchlistEntry
+	syncing bool // whether the user is logged in to any tracker
+}
+
+// syncLabel is the sync column of the watchlist, empty when there's nothing to sync with
+func (w watchlistItem) syncLabel() string {
+	switch {
+	case !w.syncing:
+		return ""
+	case !w.sync:
+		return "sync off"
+	case w.syncState == syncStateFailed:
+		return "sync failed"
+	case w.syncState == syncStatePending:
+		return "sync pending"
+	default:
+		return "synced"
+	}
+}
+
+func (w watchlistItem) Description() string {
+	desc := []string{w.status.String()}
+	if label := w.syncLabel(); label != "" {
+		desc = append(desc, label)
+	}
+	if w.score != 0 {
+		desc = append(desc, fmt.Sprintf("score %d/10", w.score))
+	}
+	if w.rewatches != 0 {
+		desc = append(desc, fmt.Sprintf("rewatched %dx", w.rewatches))
+	}
+	for _, tag := range w.tags {
+		desc = append(desc, "#"+tag)
+	}
+	if w.notes != "" {
+		desc = append(desc, "notes: "+strings.ReplaceAll(w.notes, "\n", " "))
+	}
+	return strings.Join(desc, " · ")
+}
+
 func (e episode) Title() string {
 	return fmt.Sprintf("%d. %s", e.Number, e.Name)
 }
@@ -88,13 +181,13 @@ const (
 func fetchHome() tea.Msg {
 	res, err := http.Get(url + "/home")
 	if err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
 
 	var response struct {
@@ -103,104 +196,159 @@ func fetchHome() tea.Msg {
 		} `json:"data"`
 	}
 	if err := json.Unmarshal(body, &response); err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
 
 	return animesMsg{response.Data.SpotlightAnimes}
 }
 
-func searchAnime(name string) tea.Msg {
-	res, err := http.Get(url + "/search?q=" + name)
+// getData fetches an api endpoint and decodes the data field of its response into data
+func getData(endpoint string, data any) error {
+	res, err := http.Get(url + endpoint)
 	if err != nil {
-		return errMsg{err}
+		return err
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return errMsg{err}
+		return err
 	}
 
-	var response struct {
-		Data struct {
-			Animes []anime `json:"animes"`
-		} `json:"data"`
-	}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return errMsg{err}
-	}
+	response := struct {
+		Data any `json:"data"`
+	}{data}
+	return json.Unmarshal(body, &response)
+}
 
-	return searchResultsMsg{response.Data.Animes}
+func search(name string) ([]anime, error) {
+	var data struct {
+		Animes []anime `json:"animes"`
+	}
+	err := getData("/search?q="+neturl.QueryEscape(name), &data)
+	return data.Animes, err
 }
 
-func fetchAnimeInfo(id string) tea.Msg {
-	res, err := http.Get(url + "/qtip/" + id)
+func searchAnime(name string) tea.Msg {
+	animes, err := search(name)
 	if err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
-	defer res.Body.Close()
+	return searchResultsMsg{animes}
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return errMsg{err}
+func getAnimeInfo(id string) (anime, error) {
+	var data struct {
+		Anime anime `json:"anime"`
 	}
+	err := getData("/qtip/"+id, &data)
+	return data.Anime, err
+}
 
-	var response struct {
-		Data struct {
-			Anime anime `json:"anime"`
-		} `json:"data"`
+// fetchAnimeInfo loads the info of an anime, qtip has no poster so it keeps the one of the list it was picked from
+func fetchAnimeInfo(id, poster string) tea.Msg {
+	a, err := getAnimeInfo(id)
+	if err != nil {
+		return errMsg{err: err}
 	}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return errMsg{err}
+	if a.Poster == "" {
+		a.Poster = poster
 	}
+	return animeInfoMsg{a}
+}
 
-	return animeInfoMsg{response.Data.Anime}
+func getEpisodes(id string) ([]episode, error) {
+	var data struct {
+		Episodes []episode `json:"episodes"`
+	}
+	err := getData("/anime/"+id+"/episodes", &data)
+	return data.Episodes, err
 }
 
 func fetchEpisodes(id string) tea.Msg {
-	res, err := http.Get(url + "/anime/" + id + "/episodes")
+	episodes, err := getEpisodes(id)
 	if err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
-	defer res.Body.Close()
-
-	body, err := io.ReadAll(res.Body)
+	watched, err := getWatchedEpisodes(id)
 	if err != nil {
-		return errMsg{err}
+		return errMsg{err: err}
 	}
+	return episodesMsg{episodes, watched}
+}
 
-	var response struct {
-		Data struct {
-			Episodes []episode `json:"episodes"`
-		} `json:"data"`
-	}
-	if err := json.Unmarshal(body, &response); err != nil {
-		return errMsg{err}
+// animeDetails is the full info of an anime, unlike the other routes it
+// includes the ids of the anime on myanimelist and anilist
+type animeDetails struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	MalID     int    `json:"malId"`
+	AnilistID int    `json:"anilistId"`
+	Poster    string `json:"poster"`
+	Stats     struct {
+		Type     string `json:"type"`
+		Episodes struct {
+			Sub int `json:"sub"`
+			Dub int `json:"dub"`
+		} `json:"episodes"`
+	} `json:"stats"`
+	// Status tells whether the anime still airs, it is "Finished Airing" once it's over
+	Status string `json:"-"`
+}
+
+func getAnimeDetails(id string) (animeDetails, error) {
+	var data struct {
+		Anime struct {
+			Info     animeDetails `json:"info"`
+			MoreInfo struct {
+				Status string `json:"status"`
+			} `json:"moreInfo"`
+		} `json:"anime"`
 	}
+	err := getData("/anime/"+id, &data)
+	details := data.Anime.Info
+	details.Status = data.Anime.MoreInfo.Status
+	return details, err
+}
 
-	return episodesMsg{response.Data.Episodes}
+// totalEpisodes is how many episodes the anime has in all, 0 while it airs and that isn't known yet
+func (d animeDetails) totalEpisodes() int {
+	if d.Status != "Finished Airing" {
+		return 0
+	}
+	return max(d.Stats.Episodes.Sub, d.Stats.Episodes.Dub)
 }
 
 // since the api doesn't provide an endpoint that allows
 // us to fetch an anime by its id we have to search for animes wih similar id
 // and filter the search result until we get the anime we want and repeat till
 // we have all the animes in the watchlist
-func fetchWatchlist() tea.Msg {
-	animeIds := getWatchlist()
+func fetchWatchlist(listId int) tea.Msg {
+	lists, err := getLists()
+	if err != nil {
+		return errMsg{err: err}
+	}
+
+	entries, err := getWatchlist(listId)
+	if err != nil {
+		return errMsg{err: err}
+	}
 
-	var animesInWatchlist []anime
+	var animesInWatchlist []watchlistItem
+	syncing := len(enabledSyncServices()) > 0
 
 	// iterate over each anime ID in the watchlist
-	for _, animeId := range animeIds {
+	for _, entry := range entries {
+		animeId := entry.animeId
 		res, err := http.Get(fmt.Sprintf("%s/search?q=%s", url, animeId))
 		if err != nil {
-			return errMsg{err}
+			return errMsg{err: err}
 		}
 		defer res.Body.Close()
 
 		body, err := io.ReadAll(res.Body)
 		if err != nil {
-			return errMsg{err}
+			return errMsg{err: err}
 		}
 
 		var response struct {
@@ -210,94 +358,243 @@ func fetchWatchlist() tea.Msg {
 		}
 
 		if err := json.Unmarshal(body, &response); err != nil {
-			return errMsg{err}
+			return errMsg{err: err}
 		}
 
 		// loop through the search results to find the exact match
 		for _, foundAnime := range response.Data.Animes {
 			if foundAnime.ID == animeId {
-				animesInWatchlist = append(animesInWatchlist, foundAnime)
+				animesInWatchlist = append(animesInWatchlist, watchlistItem{foundAnime, entry, syncing})
 				break
 			}
 		}
 	}
 
 	// Return the final slice of animes wrapped in an animesMsg
-	return watchlistMsg{animesInWatchlist}
+	return watchlistMsg{lists: lists, listId: listId, items: animesInWatchlist}
+}
+
+// fetchWatchlistEntry loads the watchlist entry of an anime, nothing is sent when it isn't in the watchlist
+func fetchWatchlistEntry(animeId string) tea.Msg {
+	entry, err := getWatchlistEntry(animeId)
+	if errors.Is(err, errNotInWatchlist) {
+		return nil
+	}
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return entryMsg{entry}
 }
 
-func watchAnime(epId, animeId, lang, client string) tea.Msg {
-	res, err := http.Get(fallbackurl + "/stream?id=" + epId + "&server=HD-2&type=" + lang)
+func fetchStream(epId, lang string) (streamingData, error) {
+	var response streamingData
+
+	res, err := http.Get(fallbackurl + "/stream?id=" + epId + "&server=" + cfg.Server + "&type=" + lang)
 	if err != nil {
-		return errMsg{err}
+		return response, err
 	}
 	defer res.Body.Close()
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return errMsg{err}
+		return response, err
 	}
 
-	var response streamingData
 	if err := json.Unmarshal(body, &response); err != nil {
-		return errMsg{err}
+		return response, err
 	}
 
-	if client == "mpv" {
-		var subFile string
-		headers := "Referer: https://vidwish.live/"
-		sourceFile := response.Data.Sources.Url
+	return response, nil
+}
 
-		// get english subtitles
-		for _, track := range response.Data.Tracks {
-			if track.Lang == "English" {
-				subFile = track.Url
-			}
+// subtitle returns the url of the first track in the given language
+func (s streamingData) subtitle(lang string) string {
+	for _, track := range s.Data.Tracks {
+		if track.Lang == lang {
+			return track.Url
 		}
+	}
+	return ""
+}
+
+// playerCmd is the program streams are played with, any player other than
+// mpv gets its streams through the local proxy
+var playerCmd = "mpv"
+
+// clients in the order they are toggled through
+var clients = []string{"browser", "mpv", "terminal"}
 
-		args := []string{"--http-header-fields=" + headers}
+// playMsg carries a ready to run player, it is run with tea.ExecProcess so the
+// tui gives the terminal to the player and takes it back after it exits
+type playMsg struct {
+	cmd     *exec.Cmd
+	animeId string
+	ep      episode
+	socket  string // mpv ipc socket playback progress is followed through, empty when it can't be
+}
+
+// playerExitMsg is sent once an episode was played, watched tells whether enough of it was played
+// to count. Nothing is recorded before it arrives, a player that failed never sends it
+type playerExitMsg struct {
+	animeId string
+	ep      episode
+	watched bool
+}
 
+func nextClient(client string) string {
+	for i, c := range clients {
+		if c == client {
+			return clients[(i+1)%len(clients)]
+		}
+	}
+	return clients[0]
+}
+
+// terminalVideoOutput picks the best mpv video output the terminal can draw
+func terminalVideoOutput() string {
+	if os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(os.Getenv("TERM"), "kitty") {
+		return "--vo=kitty"
+	}
+	return "--vo=tct"
+}
+
+func streamCommand(sourceFile, subFile, client, socket string) (*exec.Cmd, error) {
+	proxied := useProxy || playerCmd != "mpv"
+	if proxied {
+		p, err := getProxy()
+		if err != nil {
+			return nil, err
+		}
+		sourceFile = p.wrap(sourceFile)
+		if subFile != "" {
+			subFile = p.wrap(subFile)
+		}
+	}
+
+	var args []string
+	if playerCmd == "mpv" {
+		if !proxied {
+			args = append(args, "--http-header-fields=Referer: "+streamReferer)
+		}
 		if subFile != "" {
 			args = append(args, "--sub-file="+subFile)
 		}
+		if client == "terminal" {
+			args = append(args, terminalVideoOutput(), "--really-quiet")
+		}
+		if socket != "" {
+			args = append(args, "--input-ipc-server="+socket)
+		}
+	}
 
-		args = append(args, sourceFile)
+	args = append(args, sourceFile)
 
-		mpvCmd := exec.Command("mpv", args...)
+	return exec.Command(playerCmd, args...), nil
+}
+
+func runPlayer(msg playMsg) tea.Cmd {
+	var tracker *playbackTracker
+	if msg.socket != "" {
+		tracker = startTracker(msg.socket)
+	}
 
-		if err := mpvCmd.Run(); err != nil {
-			return errMsg{err}
+	return tea.ExecProcess(msg.cmd, func(err error) tea.Msg {
+		watched := true
+		if tracker != nil {
+			watched = tracker.finish()
 		}
-	} else {
-		// get episode ID
-		parts := strings.Split(epId, "ep=")
-		if len(parts) < 2 {
-			return errMsg{err}
+		if err != nil {
+			return errMsg{err: err}
 		}
-		epIdNum := parts[1]
-
-		animeUrl := fmt.Sprintf("https://megaplay.buzz/stream/s-2/%s/%s", epIdNum, lang)
-		fullUrl := fmt.Sprintf("https://anigarden-player.netlify.app/?iframeLink=%s", animeUrl)
-
-		// Open the browser
-		var cmd string
-		var args []string
-		switch runtime.GOOS {
-		case "linux":
-			cmd = "xdg-open"
-			args = []string{fullUrl}
-		case "windows":
-			cmd = "rundll32"
-			args = []string{"url.dll,FileProtocolHandler", fullUrl}
-		case "darwin":
-			cmd = "open"
-			args = []string{fullUrl}
-		default:
-			return fmt.Errorf("unsupported platform")
+		return playerExitMsg{msg.animeId, msg.ep, watched}
+	})
+}
+
+// playerSocketFor returns the socket to follow playback through, empty when the client can't be followed
+func playerSocketFor(client string) string {
+	if trackable(client) {
+		return playerSocket()
+	}
+	return ""
+}
+
+func watchAnime(ep episode, animeId, lang, client string) tea.Msg {
+	if client == "browser" {
+		return openInBrowser(ep, animeId, lang)
+	}
+
+	stream, err := fetchStream(ep.ID, lang)
+	if err != nil {
+		return errMsg{err: err}
+	}
+
+	sourceFile := stream.Data.Sources.Url
+
+	// pick the variant matching the preferred quality, mpv picks itself on auto
+	maxHeight, err := parseQuality(defaultQuality)
+	if err != nil {
+		return errMsg{err: err}
+	}
+	if maxHeight != 0 {
+		if variants, err := fetchVariants(sourceFile); err == nil {
+			if v, ok := pickVariant(variants, maxHeight); ok {
+				sourceFile = v.URL
+			}
 		}
+	}
+
+	socket := playerSocketFor(client)
+	cmd, err := streamCommand(sourceFile, stream.subtitle(cfg.SubtitleLang), client, socket)
+	if err != nil {
+		return errMsg{err: err}
+	}
+
+	return playMsg{cmd, animeId, ep, socket}
+}
+
+// openInBrowser opens the episode on the web player, the browser can't be followed
+// so the episode counts as watched once it opened
+func openInBrowser(ep episode, animeId, lang string) tea.Msg {
+	// get episode ID
+	parts := strings.Split(ep.ID, "ep=")
+	if len(parts) < 2 {
+		return errMsg{err: fmt.Errorf("invalid episode id %s", ep.ID)}
+	}
+	epIdNum := parts[1]
+
+	animeUrl := fmt.Sprintf("https://megaplay.buzz/stream/s-2/%s/%s", epIdNum, lang)
+	fullUrl := fmt.Sprintf("https://anigarden-player.netlify.app/?iframeLink=%s", animeUrl)
+
+	// Open the browser
+	var cmd string
+	var args []string
+	switch runtime.GOOS {
+	case "linux":
+		cmd = "xdg-open"
+		args = []string{fullUrl}
+	case "windows":
+		cmd = "rundll32"
+		args = []string{"url.dll,FileProtocolHandler", fullUrl}
+	case "darwin":
+		cmd = "open"
+		args = []string{fullUrl}
+	default:
+		return errMsg{err: fmt.Errorf("unsupported platform")}
+	}
 
-		exec.Command(cmd, args...).Start()
+	if err := exec.Command(cmd, args...).Start(); err != nil {
+		return errMsg{err: fmt.Errorf("open browser: %w", err)}
 	}
 
-	return fetchEpisodes(animeId) // refetch epiodes after finish watching
+	return playerExitMsg{animeId, ep, true}
+}
+
+// watchVariant plays a variant picked in the quality picker
+func watchVariant(v variant, subFile, animeId string, ep episode, client string) tea.Msg {
+	socket := playerSocketFor(client)
+	cmd, err := streamCommand(v.URL, subFile, client, socket)
+	if err != nil {
+		return errMsg{err: err}
+	}
+	return playMsg{cmd, animeId, ep, socket}
 }
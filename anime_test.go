@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNextClient(t *testing.T) {
+	tests := []struct{ client, want string }{
+		{"browser", "mpv"},
+		{"mpv", "terminal"},
+		{"terminal", "browser"},
+		{"vlc", "browser"},
+	}
+	for _, tt := range tests {
+		if got := nextClient(tt.client); got != tt.want {
+			t.Errorf("nextClient(%q) = %q, want %q", tt.client, got, tt.want)
+		}
+	}
+}
+
+func TestStreamCommand(t *testing.T) {
+	t.Setenv("KITTY_WINDOW_ID", "")
+	t.Setenv("TERM", "xterm-256color")
+
+	referer := "--http-header-fields=Referer: " + streamReferer
+	tests := []struct {
+		name    string
+		subFile string
+		client  string
+		socket  string
+		want    []string
+	}{
+		{"mpv", "", "mpv", "", []string{"mpv", referer, "https://cdn.example/index.m3u8"}},
+		{"subtitles", "https://cdn.example/en.vtt", "mpv", "", []string{"mpv", referer, "--sub-file=https://cdn.example/en.vtt", "https://cdn.example/index.m3u8"}},
+		{"terminal", "", "terminal", "", []string{"mpv", referer, "--vo=tct", "--really-quiet", "https://cdn.example/index.m3u8"}},
+		{"tracked", "", "mpv", "/tmp/mpv.sock", []string{"mpv", referer, "--input-ipc-server=/tmp/mpv.sock", "https://cdn.example/index.m3u8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := streamCommand("https://cdn.example/index.m3u8", tt.subFile, tt.client, tt.socket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cmd.Args, tt.want) {
+				t.Errorf("args = %q, want %q", cmd.Args, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalVideoOutput(t *testing.T) {
+	tests := []struct {
+		name, kitty, term, want string
+	}{
+		{"kitty window", "1", "xterm-256color", "--vo=kitty"},
+		{"kitty term", "", "xterm-kitty", "--vo=kitty"},
+		{"anything else", "", "xterm-256color", "--vo=tct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KITTY_WINDOW_ID", tt.kitty)
+			t.Setenv("TERM", tt.term)
+			if got := terminalVideoOutput(); got != tt.want {
+				t.Errorf("terminalVideoOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanDescription(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "A pirate sets sail.", "A pirate sets sail."},
+		{"line breaks", "First.<br>Second.<BR />Third.<br/>", "First.\nSecond.\nThird."},
+		{"paragraphs", "<p>One.</p><p>Two.</p>", "One.\nTwo."},
+		{"other tags", "<i>Frieren</i> is an <b>elf</b>.", "Frieren is an elf."},
+		{"entities", "Tom &amp; Jerry &quot;again&quot; &#39;s", `Tom & Jerry "again" 's`},
+		{"windows line endings", "One.\r\nTwo.", "One.\nTwo."},
+		{"blank lines", "One.<br><br><br><br>Two.", "One.\n\nTwo."},
+		{"surrounding space", "  \n<br>One.<br>\n ", "One."},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanDescription(tt.input); got != tt.want {
+				t.Errorf("cleanDescription(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// cellSize is the size of a terminal cell in pixels, it can only be asked for on unix
+func cellSize() (int, int) {
+	return defaultCellW, defaultCellH
+}
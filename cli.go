@@ -0,0 +1,419 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runCommand runs a subcommand instead of the tui, args start with the subcommand name
+func runCommand(args []string) error {
+	switch args[0] {
+	case "search":
+		return runSearch(args[1:])
+	case "info":
+		return runInfo(args[1:])
+	case "episodes":
+		return runEpisodes(args[1:])
+	case "watch":
+		return runWatch(args[1:])
+	case "watchlist":
+		return runWatchlist(args[1:])
+	case "stream-url":
+		return runStreamURL(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "import":
+		return runImport(args[1:])
+	case "mal":
+		return runMal(args[1:])
+	case "anilist":
+		return runAnilist(args[1:])
+	case "ids":
+		return runIds(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv, guessed from the output file by default")
+	output := fs.String("o", "", "file to write to, stdout by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: anigarden export [-format json|csv] [-o file]")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	data, err := loadExport()
+	if err != nil {
+		return err
+	}
+
+	if *format == "" {
+		*format = formatFromPath(*output)
+	}
+
+	if *output == "" {
+		return writeExport(os.Stdout, data, *format)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeExport(file, data, *format); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "json or csv, guessed from the file extension by default")
+	mode := fs.String("mode", string(importMerge), "merge into the existing data or replace it")
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: anigarden import [-mode merge|replace] [-dry-run] [-format json|csv] file")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return usageError(fs)
+	}
+	path := fs.Arg(0)
+
+	if *format == "" {
+		*format = formatFromPath(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := readExport(file, *format)
+	if err != nil {
+		return err
+	}
+
+	report, err := importData(data, importMode(*mode), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(report)
+	return nil
+}
+
+func runMal(args []string) error {
+	usage := "usage: anigarden mal import [-mode merge|replace] [-dry-run] [-map file] file.xml\n       anigarden mal export [-o file.xml]\n" +
+		"       anigarden mal login [-client-id id] [-redirect uri]\n       anigarden mal logout\n       anigarden mal sync"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "import":
+		return runMalImport(args[1:])
+	case "export":
+		return runMalExport(args[1:])
+	case "login":
+		return runMalLogin(args[1:])
+	case "logout":
+		return malLogout()
+	case "sync":
+		return runSync()
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runMalLogin(args []string) error {
+	fs := flag.NewFlagSet("mal login", flag.ContinueOnError)
+	clientId := fs.String("client-id", os.Getenv("ANIGARDEN_MAL_CLIENT_ID"), "id of your myanimelist api client")
+	redirect := fs.String("redirect", defaultMalRedirect, "app redirect url of the api client, anigarden listens on it for the login")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *clientId == "" {
+		return fmt.Errorf("create an api client at https://myanimelist.net/apiconfig with %s as app redirect url and pass its id with -client-id", *redirect)
+	}
+
+	err := malLogin(*clientId, *redirect, func(loginURL string) {
+		fmt.Printf("open %s and authorize anigarden\n", loginURL)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("logged in to myanimelist")
+	return nil
+}
+
+func runMalImport(args []string) error {
+	fs := flag.NewFlagSet("mal import", flag.ContinueOnError)
+	mode := fs.String("mode", string(importMerge), "merge into the existing data or replace it")
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing anything")
+	mapPath := fs.String("map", "", "csv of mal_id,hianime_id rows resolving anime that couldn't be matched")
+	unmatchedPath := fs.String("unmatched", "", "where to write unmatched anime, defaults to <file>.unmatched.csv")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: anigarden mal import [-mode merge|replace] [-dry-run] [-map file] file.xml")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return usageError(fs)
+	}
+	path := fs.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	mal, err := readMalExport(file)
+	if err != nil {
+		return err
+	}
+
+	mappings := make(map[int]string)
+	if *mapPath != "" {
+		if mappings, err = readMalMappings(*mapPath); err != nil {
+			return err
+		}
+	}
+
+	data, unmatched, err := convertMalExport(mal, mappings, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\rmatching anime %d/%d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	report, err := importData(data, importMode(*mode), *dryRun)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+
+	if len(unmatched) == 0 {
+		return nil
+	}
+
+	if *unmatchedPath == "" {
+		*unmatchedPath = strings.TrimSuffix(path, filepath.Ext(path)) + ".unmatched.csv"
+	}
+
+	fmt.Printf("\n%d anime couldn't be matched:\n", len(unmatched))
+	for _, u := range unmatched {
+		fmt.Printf("  %d %s\n", u.malId, u.title)
+	}
+
+	out, err := os.Create(*unmatchedPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := writeMalUnmatched(out, unmatched); err != nil {
+		return err
+	}
+	fmt.Printf("\nfill in the hianime_id column of %s and import again with -map %s\n", *unmatchedPath, *unmatchedPath)
+	return out.Close()
+}
+
+func runMalExport(args []string) error {
+	fs := flag.NewFlagSet("mal export", flag.ContinueOnError)
+	output := fs.String("o", "", "file to write to, stdout by default")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	data, err := loadExport()
+	if err != nil {
+		return err
+	}
+
+	mal, skipped, err := buildMalExport(data)
+	if err != nil {
+		return err
+	}
+	for _, id := range skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s, it has no myanimelist id\n", id)
+	}
+
+	if *output == "" {
+		return writeMalExport(os.Stdout, mal)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeMalExport(file, mal); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func runAnilist(args []string) error {
+	usage := "usage: anigarden anilist login [-token token]\n       anigarden anilist logout\n       anigarden anilist pull [-dry-run]\n       anigarden anilist sync"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "login":
+		return runAnilistLogin(args[1:])
+	case "logout":
+		return anilistLogout()
+	case "pull":
+		return runAnilistPull(args[1:])
+	case "sync":
+		return runSync()
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runAnilistLogin(args []string) error {
+	fs := flag.NewFlagSet("anilist login", flag.ContinueOnError)
+	token := fs.String("token", "", "access token, asked for when not given")
+	clientId := fs.String("client-id", os.Getenv("ANIGARDEN_ANILIST_CLIENT_ID"), "id of your anilist api client, used to build the login url")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *token == "" {
+		if *clientId == "" {
+			return errors.New("create an api client at https://anilist.co/settings/developer with https://anilist.co/api/v2/oauth/pin as redirect url and pass its id with -client-id")
+		}
+		fmt.Printf("open %s, authorize anigarden and paste the token here\n> ", anilistLoginURL(*clientId))
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		*token = strings.TrimSpace(line)
+	}
+
+	creds, err := anilistLogin(*token)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("logged in to anilist as %s\n", creds.UserName)
+	return nil
+}
+
+func runAnilistPull(args []string) error {
+	fs := flag.NewFlagSet("anilist pull", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would change without changing anything")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	report, unmatched, err := anilistPull(*dryRun, func(done, total int) {
+		fmt.Fprintf(os.Stderr, "\rmatching anime %d/%d", done, total)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+
+	if len(unmatched) > 0 {
+		fmt.Printf("\n%d anime couldn't be matched:\n", len(unmatched))
+		for _, title := range unmatched {
+			fmt.Printf("  %s\n", title)
+		}
+	}
+	return nil
+}
+
+// runSync pushes updates that were queued while offline
+func runSync() error {
+	if len(enabledSyncServices()) == 0 {
+		return errors.New("not logged in to any service")
+	}
+	result, err := processSyncQueue()
+	if err != nil {
+		return err
+	}
+	fmt.Println(result)
+	return nil
+}
+
+func runIds(args []string) error {
+	usage := "usage: anigarden ids show anime-id\n       anigarden ids set [-mal id] [-anilist id] [-kitsu id] anime-id\n" +
+		"       anigarden ids reset anime-id\n       anigarden ids import-offline anime-offline-database.json"
+	if len(args) < 2 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "show":
+		ids, err := lookupIds(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(ids)
+		return nil
+
+	case "set":
+		fs := flag.NewFlagSet("ids set", flag.ContinueOnError)
+		mal := fs.Int("mal", 0, "myanimelist id")
+		anilist := fs.Int("anilist", 0, "anilist id")
+		kitsu := fs.Int("kitsu", 0, "kitsu id")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(usage)
+		}
+		ids := animeIds{animeId: fs.Arg(0), mal: *mal, anilist: *anilist, kitsu: *kitsu}
+		if err := setMappingOverride(ids); err != nil {
+			return err
+		}
+		return queueSync(ids.animeId)
+
+	case "reset":
+		return clearMappingOverride(args[1])
+
+	case "import-offline":
+		file, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		imported, err := importOfflineDatabase(file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported tracker ids of %d anime\n", imported)
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// the commands in this file print plain tab separated lines by default, so the first
+// column can be cut out in shell pipelines and launchers, or json with --json
+
+// parseArgs parses flags wherever they appear among the positional args and returns the positional ones,
+// everything after -- is positional
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := parseFlags(fs, args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		// the flag package stops after --, the args after it are all positional
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// errUsage is returned once a command printed its usage because it was called wrong,
+// main exits with 2 like the flag package does after the database is closed
+var errUsage = errors.New("usage")
+
+// usageError prints the usage of a command
+func usageError(fs *flag.FlagSet) error {
+	fs.Usage()
+	return errUsage
+}
+
+// parseFlags parses the flags of a command, the flag package already printed what was wrong with them
+// and the usage. -h returns flag.ErrHelp
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	return err
+}
+
+func newCommand(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: anigarden "+usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runSearch(args []string) error {
+	fs := newCommand("search", "search [--json] query")
+	asJSON := fs.Bool("json", false, "print json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	query := strings.Join(positional, " ")
+	if query == "" {
+		return usageError(fs)
+	}
+
+	results, err := search(query)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(results)
+	}
+	for _, a := range results {
+		fmt.Printf("%s\t%s\n", a.ID, a.Name)
+	}
+	return nil
+}
+
+// animeInfo is what the info command prints, the info page and the details of an anime together
+type animeInfo struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Genres      []string `json:"genres"`
+	Type        string   `json:"type"`
+	SubEpisodes int      `json:"sub_episodes"`
+	DubEpisodes int      `json:"dub_episodes"`
+	MalID       int      `json:"mal_id"`
+	AnilistID   int      `json:"anilist_id"`
+	KitsuID     int      `json:"kitsu_id"`
+}
+
+func runInfo(args []string) error {
+	fs := newCommand("info", "info [--json] anime-id")
+	asJSON := fs.Bool("json", false, "print json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fs)
+	}
+	id := positional[0]
+
+	a, err := getAnimeInfo(id)
+	if err != nil {
+		return err
+	}
+	details, err := getAnimeDetails(id)
+	if err != nil {
+		return err
+	}
+	ids, err := lookupIds(id)
+	if err != nil {
+		return err
+	}
+
+	info := animeInfo{
+		ID:          id,
+		Name:        a.Name,
+		Description: cleanDescription(a.Body),
+		Genres:      a.Genres,
+		Type:        details.Stats.Type,
+		SubEpisodes: details.Stats.Episodes.Sub,
+		DubEpisodes: details.Stats.Episodes.Dub,
+		MalID:       ids.mal,
+		AnilistID:   ids.anilist,
+		KitsuID:     ids.kitsu,
+	}
+	if *asJSON {
+		return printJSON(info)
+	}
+
+	fmt.Printf("%s\n%s · %d sub · %d dub\nGenres: %s\n%s\n\n%s\n", info.Name, info.Type, info.SubEpisodes, info.DubEpisodes,
+		strings.Join(info.Genres, ", "), ids, info.Description)
+	return nil
+}
+
+func runEpisodes(args []string) error {
+	fs := newCommand("episodes", "episodes [--json] anime-id")
+	asJSON := fs.Bool("json", false, "print json")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fs)
+	}
+
+	episodes, err := getEpisodes(positional[0])
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(episodes)
+	}
+	for _, ep := range episodes {
+		filler := ""
+		if ep.IsFiller {
+			filler = "\tfiller"
+		}
+		fmt.Printf("%d\t%s\t%s%s\n", ep.Number, ep.ID, ep.Name, filler)
+	}
+	return nil
+}
+
+// findEpisode returns the episode of an anime with the given number
+func findEpisode(animeId string, number int) (episode, error) {
+	episodes, err := getEpisodes(animeId)
+	if err != nil {
+		return episode{}, err
+	}
+	for _, ep := range episodes {
+		if ep.Number == number {
+			return ep, nil
+		}
+	}
+	return episode{}, fmt.Errorf("%s has no episode %d", animeId, number)
+}
+
+// watchOutput is the playback watch recorded, status is left out when the anime isn't in the watchlist
+type watchOutput struct {
+	AnimeID   string      `json:"anime_id"`
+	Episode   int         `json:"episode"`
+	EpisodeID string      `json:"episode_id"`
+	Watched   bool        `json:"watched"`
+	Status    watchStatus `json:"status,omitempty"`
+}
+
+func runWatch(args []string) error {
+	fs := newCommand("watch", "watch [--json] [--dub] [--client mpv|terminal|browser] [--player mpv] [--quality 720p] anime-id episode")
+	asJSON := fs.Bool("json", false, "print the recorded playback as json once the player exits")
+	dub := fs.Bool("dub", cfg.Lang == "dub", "watch the dub")
+	client := fs.String("client", cfg.Client, "mpv, terminal or browser")
+	fs.StringVar(&playerCmd, "player", playerCmd, "player used by the mpv and terminal clients")
+	fs.StringVar(&defaultQuality, "quality", defaultQuality, "max quality, e.g. 720p or auto")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return usageError(fs)
+	}
+	animeId := positional[0]
+	number, err := strconv.Atoi(positional[1])
+	if err != nil {
+		return fmt.Errorf("invalid episode number %q", positional[1])
+	}
+	if _, err := parseQuality(defaultQuality); err != nil {
+		return err
+	}
+	if !slices.Contains(clients, *client) {
+		return fmt.Errorf("unknown client %q, expected one of %s", *client, strings.Join(clients, ", "))
+	}
+
+	lang := "sub"
+	if *dub {
+		lang = "dub"
+	}
+
+	ep, err := findEpisode(animeId, number)
+	if err != nil {
+		return err
+	}
+
+	// the json stays alone on stdout, except in the terminal where the video is drawn on it
+	stdout := io.Writer(os.Stdout)
+	if *asJSON && *client != "terminal" {
+		stdout = os.Stderr
+	}
+
+	var played playerExitMsg
+	switch msg := watchAnime(ep, animeId, lang, *client).(type) {
+	case errMsg:
+		return msg.err
+	case playMsg:
+		if played, err = playInForeground(msg, stdout); err != nil {
+			return err
+		}
+	case playerExitMsg:
+		played = msg
+	}
+
+	// the playback is only recorded once the player exited fine
+	if err := savePlayback(animeId, ep, played.watched); err != nil {
+		return err
+	}
+	if played.watched {
+		if err := syncPlayback(animeId); err != nil {
+			return err
+		}
+	}
+
+	if *asJSON {
+		out := watchOutput{AnimeID: animeId, Episode: ep.Number, EpisodeID: ep.ID, Watched: played.watched}
+		if entry, err := getWatchlistEntry(animeId); err == nil {
+			out.Status = entry.status
+		} else if !errors.Is(err, errNotInWatchlist) {
+			return err
+		}
+		return printJSON(out)
+	}
+	return nil
+}
+
+// syncPlayback queues a watched episode and pushes it right away, failures stay queued for later
+func syncPlayback(animeId string) error {
+	if err := queueSync(animeId); err != nil {
+		return err
+	}
+	if len(enabledSyncServices()) == 0 {
+		return nil
+	}
+	result, err := processSyncQueue()
+	if err != nil {
+		return err
+	}
+	if len(result.failed) > 0 || len(result.skipped) > 0 {
+		fmt.Fprintln(os.Stderr, result)
+	}
+	return nil
+}
+
+// playInForeground runs a player on the terminal outside of the tui, following its progress like runPlayer
+func playInForeground(msg playMsg, stdout io.Writer) (playerExitMsg, error) {
+	var tracker *playbackTracker
+	if msg.socket != "" {
+		tracker = startTracker(msg.socket)
+	}
+
+	msg.cmd.Stdin, msg.cmd.Stdout, msg.cmd.Stderr = os.Stdin, stdout, os.Stderr
+	err := msg.cmd.Run()
+
+	watched := true
+	if tracker != nil {
+		watched = tracker.finish()
+	}
+	return playerExitMsg{msg.animeId, msg.ep, watched}, err
+}
+
+// streamInfo is what stream-url prints, streams only play with the referer header set
+type streamInfo struct {
+	URL      string `json:"url"`
+	Subtitle string `json:"subtitle,omitempty"`
+	Referer  string `json:"referer"`
+}
+
+func runStreamURL(args []string) error {
+	fs := newCommand("stream-url", "stream-url [--json] [--dub] [--quality 720p] episode-id")
+	asJSON := fs.Bool("json", false, "print json")
+	dub := fs.Bool("dub", cfg.Lang == "dub", "stream of the dub")
+	fs.StringVar(&defaultQuality, "quality", defaultQuality, "max quality, e.g. 720p or auto")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError(fs)
+	}
+	maxHeight, err := parseQuality(defaultQuality)
+	if err != nil {
+		return err
+	}
+
+	lang := "sub"
+	if *dub {
+		lang = "dub"
+	}
+
+	stream, err := fetchStream(positional[0], lang)
+	if err != nil {
+		return err
+	}
+	info := streamInfo{URL: stream.Data.Sources.Url, Subtitle: stream.subtitle(cfg.SubtitleLang), Referer: streamReferer}
+	if info.URL == "" {
+		return fmt.Errorf("no stream found for %s", positional[0])
+	}
+
+	if maxHeight != 0 {
+		if variants, err := fetchVariants(info.URL); err == nil {
+			if v, ok := pickVariant(variants, maxHeight); ok {
+				info.URL = v.URL
+			}
+		}
+	}
+
+	if *asJSON {
+		return printJSON(info)
+	}
+	fmt.Println(info.URL)
+	return nil
+}
+
+// watchlistOutput is an anime of the watchlist as printed by watchlist list
+type watchlistOutput struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Status    watchStatus `json:"status"`
+	Score     int         `json:"score"`
+	Rewatches int         `json:"rewatches"`
+	Tags      []string    `json:"tags"`
+	Notes     string      `json:"notes"`
+}
+
+// listChangeOutput is what watchlist add and rm print with --json
+type listChangeOutput struct {
+	AnimeID string `json:"anime_id"`
+	List    string `json:"list"`
+	InList  bool   `json:"in_list"`
+}
+
+// findList returns the list with the given name, the watchlist when name is empty
+func findList(name string) (animeList, error) {
+	lists, err := getLists()
+	if err != nil {
+		return animeList{}, err
+	}
+	for _, l := range lists {
+		if (name == "" && l.id == defaultListId) || strings.EqualFold(l.name, name) {
+			return l, nil
+		}
+	}
+	return animeList{}, fmt.Errorf("no list named %q", name)
+}
+
+func runWatchlist(args []string) error {
+	usage := "usage: anigarden watchlist list [--json] [--list name] [--status status]\n" +
+		"       anigarden watchlist add [--json] [--list name] anime-id\n       anigarden watchlist rm [--json] [--list name] anime-id"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	fs := newCommand("watchlist "+args[0], "watchlist "+args[0]+" [flags]")
+	listName := fs.String("list", "", "name of the list, the watchlist by default")
+
+	switch args[0] {
+	case "list":
+		asJSON := fs.Bool("json", false, "print json")
+		status := fs.String("status", "", "only anime with this status")
+		positional, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 0 {
+			return usageError(fs)
+		}
+
+		l, err := findList(*listName)
+		if err != nil {
+			return err
+		}
+		msg := fetchWatchlist(l.id)
+		if msg, ok := msg.(errMsg); ok {
+			return msg.err
+		}
+
+		items := []watchlistOutput{}
+		for _, item := range msg.(watchlistMsg).items {
+			if *status != "" && string(item.status) != *status {
+				continue
+			}
+			items = append(items, watchlistOutput{item.ID, item.Name, item.status, item.score, item.rewatches, item.tags, item.notes})
+		}
+		if *asJSON {
+			return printJSON(items)
+		}
+		for _, item := range items {
+			fmt.Printf("%s\t%s\t%s\n", item.ID, item.Name, item.Status)
+		}
+		return nil
+
+	case "add", "rm":
+		asJSON := fs.Bool("json", false, "print the result as json")
+		positional, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return usageError(fs)
+		}
+
+		l, err := findList(*listName)
+		if err != nil {
+			return err
+		}
+		add := args[0] == "add"
+		if add {
+			err = addAnimeToList(l.id, positional[0])
+		} else {
+			err = removeAnimeFromList(l.id, positional[0])
+		}
+		if err != nil || !*asJSON {
+			return err
+		}
+		return printJSON(listChangeOutput{positional[0], l.name, add})
+
+	default:
+		return errors.New(usage)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		want       []string
+		wantJSON   bool
+		wantClient string
+	}{
+		{"flags first", []string{"--json", "--client", "browser", "one-piece-100", "3"}, []string{"one-piece-100", "3"}, true, "browser"},
+		{"flags last", []string{"one-piece-100", "3", "--json"}, []string{"one-piece-100", "3"}, true, "mpv"},
+		{"flags between", []string{"one-piece-100", "--client=terminal", "3"}, []string{"one-piece-100", "3"}, false, "terminal"},
+		{"no flags", []string{"frieren"}, []string{"frieren"}, false, "mpv"},
+		{"nothing", nil, nil, false, "mpv"},
+		{"everything after --", []string{"--", "--json"}, []string{"--json"}, false, "mpv"},
+		{"flags after -- are positional", []string{"--", "a", "--json"}, []string{"a", "--json"}, false, "mpv"},
+		{"-- after a positional", []string{"a", "--client", "browser", "--", "--json", "b"}, []string{"a", "--json", "b"}, false, "browser"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			asJSON := fs.Bool("json", false, "")
+			client := fs.String("client", "mpv", "")
+
+			got, err := parseArgs(fs, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("positional = %q, want %q", got, tt.want)
+			}
+			if *asJSON != tt.wantJSON || *client != tt.wantClient {
+				t.Errorf("json = %v, client = %q, want %v, %q", *asJSON, *client, tt.wantJSON, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"missing anime id", func() error { return runInfo(nil) }, errUsage},
+		{"unknown flag", func() error { return runWatch([]string{"--bogus", "one-piece-100", "1"}) }, errUsage},
+		{"help", func() error { return runSearch([]string{"-h"}) }, flag.ErrHelp},
+		{"import without a file", func() error { return runImport(nil) }, errUsage},
+		{"bad flag of a subcommand", func() error { return runWatchlist([]string{"add", "--bogus"}) }, errUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the usage goes to stderr
+			old := os.Stderr
+			os.Stderr, _ = os.Open(os.DevNull)
+			t.Cleanup(func() { os.Stderr = old })
+
+			if err := tt.run(); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindEpisode(t *testing.T) {
+	useFakeAPI(t, fakeAPI{
+		"/anime/one-piece-100/episodes": `{"episodes": [
+			{"episodeId": "one-piece-100?ep=1", "number": 1},
+			{"episodeId": "one-piece-100?ep=2", "number": 2}]}`,
+	})
+
+	tests := []struct {
+		name    string
+		animeId string
+		number  int
+		want    string
+		wantErr bool
+	}{
+		{"found", "one-piece-100", 2, "one-piece-100?ep=2", false},
+		{"past the last episode", "one-piece-100", 3, "", true},
+		{"unknown anime", "naruto-677", 1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep, err := findEpisode(tt.animeId, tt.number)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ep.ID != tt.want {
+				t.Errorf("episode = %q, want %q", ep.ID, tt.want)
+			}
+		})
+	}
+}
+
+// captureStdout returns what run printed
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := os.Stdout
+	os.Stdout = w
+	runErr := run()
+	os.Stdout = old
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runErr != nil {
+		t.Fatal(runErr)
+	}
+	return string(out)
+}
+
+func TestRunSearch(t *testing.T) {
+	useFakeAPI(t, fakeAPI{
+		"/search?q=one+piece": `{"animes": [{"id": "one-piece-100", "name": "One Piece"}, {"id": "one-piece-film-red-18236", "name": "One Piece Film: Red"}]}`,
+	})
+
+	got := captureStdout(t, func() error { return runSearch([]string{"one", "piece"}) })
+	want := "one-piece-100\tOne Piece\none-piece-film-red-18236\tOne Piece Film: Red\n"
+	if got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	var results []anime
+	out := captureStdout(t, func() error { return runSearch([]string{"one", "piece", "--json"}) })
+	if err := json.Unmarshal([]byte(out), &results); err != nil || len(results) != 2 || results[0].ID != "one-piece-100" {
+		t.Errorf("json = %s, %v, want both results", out, err)
+	}
+}
+
+func TestRunWatchlist(t *testing.T) {
+	useTestDB(t)
+	useFakeAPI(t, fakeAPI{"/search?q=one-piece-100": `{"animes": [{"id": "one-piece-100", "name": "One Piece"}]}`})
+
+	captureStdout(t, func() error { return runWatchlist([]string{"add", "one-piece-100"}) })
+	if err := setScore("one-piece-100", 9); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []watchlistOutput
+	out := captureStdout(t, func() error { return runWatchlist([]string{"list", "--json"}) })
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatal(err)
+	}
+	want := []watchlistOutput{{ID: "one-piece-100", Name: "One Piece", Status: statusPlanToWatch, Score: 9}}
+	if !reflect.DeepEqual(items, want) {
+		t.Errorf("watchlist = %+v, want %+v", items, want)
+	}
+
+	if out := captureStdout(t, func() error { return runWatchlist([]string{"list", "--status", "watching"}) }); out != "" {
+		t.Errorf("watching anime = %q, want none", out)
+	}
+
+	captureStdout(t, func() error { return runWatchlist([]string{"rm", "one-piece-100"}) })
+	if out := captureStdout(t, func() error { return runWatchlist([]string{"list"}) }); out != "" {
+		t.Errorf("watchlist after rm = %q, want it empty", out)
+	}
+}
+
+func TestRunWatchlistChangeJSON(t *testing.T) {
+	useTestDB(t)
+	tests := []struct {
+		args []string
+		want listChangeOutput
+	}{
+		{[]string{"add", "one-piece-100", "--json"}, listChangeOutput{"one-piece-100", "Watchlist", true}},
+		{[]string{"rm", "--json", "one-piece-100"}, listChangeOutput{"one-piece-100", "Watchlist", false}},
+	}
+	for _, tt := range tests {
+		var got listChangeOutput
+		out := captureStdout(t, func() error { return runWatchlist(tt.args) })
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("%v printed %q: %v", tt.args, out, err)
+		}
+		if got != tt.want {
+			t.Errorf("%v printed %+v, want %+v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// config is read from config.toml in the app dir, every key is optional
+type config struct {
+	Lang         string `toml:"lang"`          // sub or dub
+	Client       string `toml:"client"`        // browser, mpv or terminal
+	Player       string `toml:"player"`        // program the mpv and terminal clients play with
+	Server       string `toml:"server"`        // streaming server episodes are fetched from
+	SubtitleLang string `toml:"subtitle_lang"` // label of the subtitle track loaded with the stream
+	Quality      string `toml:"quality"`       // max quality, e.g. 720p or auto
+	Proxy        bool   `toml:"proxy"`         // serve streams through the local proxy
+	DataDir      string `toml:"data_dir"`      // where the database and exports are kept
+	StartupPage  string `toml:"startup_page"`  // home, search or watchlist
+	Theme        string `toml:"theme"`         // a built-in theme or one of themes
+	Images       string `toml:"images"`        // how posters are drawn: auto, kitty, sixel, halfblocks or off
+
+	// user themes, [themes.name] tables
+	Themes map[string]Theme `toml:"themes"`
+
+	// keys of actions, e.g. watch = ["enter", "p"]
+	Keys map[string][]string `toml:"keys"`
+}
+
+var (
+	servers      = []string{"HD-1", "HD-2", "HD-3"}
+	startupPages = []string{"home", "search", "watchlist"}
+)
+
+func defaultConfig() config {
+	return config{
+		Lang:         "sub",
+		Client:       "browser",
+		Player:       "mpv",
+		Server:       "HD-2",
+		SubtitleLang: "English",
+		Quality:      "auto",
+		StartupPage:  "home",
+		Theme:        "default",
+		Images:       "auto",
+	}
+}
+
+// cfg is the loaded config, flags given on the command line take precedence over it
+var cfg = defaultConfig()
+
+// flagOverrides are the flags given on the command line, they keep winning when the config is reloaded
+var flagOverrides = map[string]bool{}
+
+// configPath is the config given with --config, config.toml in the app dir when empty
+var configPath string
+
+// configReloadedMsg is sent once the config is reloaded, a changed data_dir is left for the next start
+type configReloadedMsg struct {
+	dataDirChanged bool
+}
+
+func getConfigPath() (string, error) {
+	if configPath != "" {
+		return expandHome(configPath), nil
+	}
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// validationErrors collects every problem of a config so they can be fixed in one go
+type validationErrors []string
+
+func (v validationErrors) Error() string {
+	return "invalid config:\n  " + strings.Join(v, "\n  ")
+}
+
+func (c config) validate() error {
+	var errs validationErrors
+	if c.Lang != "sub" && c.Lang != "dub" {
+		errs = append(errs, fmt.Sprintf("lang must be sub or dub, got %q", c.Lang))
+	}
+	if !slices.Contains(clients, c.Client) {
+		errs = append(errs, fmt.Sprintf("client must be one of %s, got %q", strings.Join(clients, ", "), c.Client))
+	}
+	if c.Player == "" {
+		errs = append(errs, "player can't be empty")
+	}
+	if !slices.Contains(servers, c.Server) {
+		errs = append(errs, fmt.Sprintf("server must be one of %s, got %q", strings.Join(servers, ", "), c.Server))
+	}
+	if c.SubtitleLang == "" {
+		errs = append(errs, "subtitle_lang can't be empty")
+	}
+	if _, err := parseQuality(c.Quality); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if !slices.Contains(startupPages, c.StartupPage) {
+		errs = append(errs, fmt.Sprintf("startup_page must be one of %s, got %q", strings.Join(startupPages, ", "), c.StartupPage))
+	}
+	if !slices.Contains(imageModes, c.Images) {
+		errs = append(errs, fmt.Sprintf("images must be one of %s, got %q", strings.Join(imageModes, ", "), c.Images))
+	}
+	errs = append(errs, c.validateThemes()...)
+	if _, keyErrs := c.keyMap(); len(keyErrs) > 0 {
+		errs = append(errs, keyErrs...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// loadConfig reads the config file on top of the defaults, a missing file is the same as an empty one
+// unless it was given with --config
+func loadConfig() (config, error) {
+	c := defaultConfig()
+
+	path, err := getConfigPath()
+	if err != nil {
+		return c, err
+	}
+
+	meta, err := toml.DecodeFile(path, &c)
+	if errors.Is(err, os.ErrNotExist) && configPath == "" {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var errs validationErrors
+	for _, key := range meta.Undecoded() {
+		errs = append(errs, fmt.Sprintf("unknown key %q", key.String()))
+	}
+	if err := c.validate(); err != nil {
+		errs = append(errs, err.(validationErrors)...)
+	}
+	if len(errs) > 0 {
+		return c, fmt.Errorf("%s: %w", path, errs)
+	}
+
+	c.DataDir = expandHome(c.DataDir)
+	return c, nil
+}
+
+// applyConfig makes c the current config, settings also given as flags are left alone
+func applyConfig(c config) {
+	cfg = c
+	keys, _ = c.keyMap()
+	if !flagOverrides["quality"] {
+		defaultQuality = c.Quality
+	}
+	if !flagOverrides["proxy"] {
+		useProxy = c.Proxy
+	}
+	if !flagOverrides["player"] {
+		playerCmd = c.Player
+	}
+	if !flagOverrides["theme"] {
+		themeName = c.Theme
+	}
+	// a theme given as flag may be gone from the reloaded config
+	if setTheme(themeName) != nil {
+		setTheme(c.Theme)
+	}
+}
+
+// reloadConfig reads the config again, the current one is kept when the new one is invalid.
+// The database stays open in the data dir it was opened in, a new data_dir waits for a restart
+func reloadConfig() tea.Msg {
+	c, err := loadConfig()
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	var msg configReloadedMsg
+	if c.DataDir != cfg.DataDir {
+		msg.dataDirChanged = true
+		c.DataDir = cfg.DataDir
+	}
+	applyConfig(c)
+	return msg
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *config)
+		// want are parts of the errors expected, none means the config is valid
+		want []string
+	}{
+		{"defaults", func(c *config) {}, nil},
+		{"every field set", func(c *config) {
+			c.Lang, c.Client, c.Server, c.Quality, c.StartupPage, c.Images = "dub", "mpv", "HD-1", "1080p", "watchlist", "off"
+		}, nil},
+		{"bad lang", func(c *config) { c.Lang = "raw" }, []string{"lang must be sub or dub"}},
+		{"bad client", func(c *config) { c.Client = "vlc" }, []string{"client must be one of"}},
+		{"empty player", func(c *config) { c.Player = "" }, []string{"player can't be empty"}},
+		{"bad server", func(c *config) { c.Server = "HD-9" }, []string{"server must be one of"}},
+		{"empty subtitle lang", func(c *config) { c.SubtitleLang = "" }, []string{"subtitle_lang can't be empty"}},
+		{"bad quality", func(c *config) { c.Quality = "high" }, []string{"invalid quality"}},
+		{"bad startup page", func(c *config) { c.StartupPage = "info" }, []string{"startup_page must be one of"}},
+		{"bad images", func(c *config) { c.Images = "ascii" }, []string{"images must be one of"}},
+		{"unknown theme", func(c *config) { c.Theme = "nope" }, []string{"nope"}},
+		{"bad key", func(c *config) { c.Keys = map[string][]string{"jump": {"j"}} }, []string{"keys.jump is not an action"}},
+		{"every problem at once", func(c *config) {
+			c.Lang, c.Player, c.Quality = "raw", "", "0p"
+		}, []string{"lang must be", "player can't be empty", "invalid quality"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			tt.edit(&c)
+			err := c.validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("validate() = %v, want no error", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("validate() = nil, want an error")
+			}
+			errs := err.(validationErrors)
+			if len(errs) != len(tt.want) {
+				t.Errorf("got %d errors, want %d: %v", len(errs), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("validate() = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+// writeConfig points the app dir at a temporary directory holding a config.toml with contents
+func writeConfig(t *testing.T, contents string) {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	path, err := getConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		contents string
+		edit     func(c *config)
+		wantErr  string
+	}{
+		{"empty", "", func(c *config) {}, ""},
+		{"settings", "lang = \"dub\"\nproxy = true\nquality = \"720p\"\n", func(c *config) {
+			c.Lang, c.Proxy, c.Quality = "dub", true, "720p"
+		}, ""},
+		{"data dir in home", "data_dir = \"~/anime\"\n", func(c *config) { c.DataDir = filepath.Join(home, "anime") }, ""},
+		{"unknown key", "langauge = \"dub\"\n", nil, `unknown key "langauge"`},
+		{"invalid value", "client = \"vlc\"\n", nil, "client must be one of"},
+		{"not toml", "lang = \n", nil, "failed to read"},
+		{"user theme", "theme = \"mine\"\n[themes.mine]\nbase = \"nord\"\naccent = \"#ff0000\"\n", func(c *config) {
+			c.Theme, c.Themes = "mine", map[string]Theme{"mine": {Base: "nord", Accent: "#ff0000"}}
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfig(t, tt.contents)
+			got, err := loadConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadConfig() = %v, want an error mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := defaultConfig()
+			tt.edit(&want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("loadConfig() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissing(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if got, err := loadConfig(); err != nil || !reflect.DeepEqual(got, defaultConfig()) {
+		t.Errorf("loadConfig() = %+v, %v, want the defaults", got, err)
+	}
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	t.Cleanup(func() { configPath = "" })
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	configPath = filepath.Join(t.TempDir(), "other.toml")
+	if err := os.WriteFile(configPath, []byte("lang = \"dub\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadConfig(); err != nil || got.Lang != "dub" {
+		t.Errorf("loadConfig() = %+v, %v, want the config given with --config", got, err)
+	}
+
+	// a config given on purpose has to be there
+	configPath = filepath.Join(t.TempDir(), "missing.toml")
+	if _, err := loadConfig(); err == nil {
+		t.Errorf("loadConfig() read a missing --config")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	oldCfg, oldQuality, oldProxy, oldPlayer, oldOverrides := cfg, defaultQuality, useProxy, playerCmd, flagOverrides
+	t.Cleanup(func() {
+		cfg, defaultQuality, useProxy, playerCmd, flagOverrides = oldCfg, oldQuality, oldProxy, oldPlayer, oldOverrides
+		setTheme("default")
+		keys = defaultKeys
+	})
+
+	// --quality was given on the command line so it wins over the config
+	applyConfig(defaultConfig())
+	defaultQuality = "480p"
+	flagOverrides = map[string]bool{"quality": true}
+
+	writeConfig(t, "quality = \"1080p\"\nproxy = true\nlang = \"dub\"\n[keys]\nwatch = [\"p\"]\n")
+	if msg := reloadConfig(); msg != (configReloadedMsg{}) {
+		t.Fatalf("reloadConfig() = %#v", msg)
+	}
+	if cfg.Lang != "dub" || !useProxy || defaultQuality != "480p" {
+		t.Errorf("lang = %q, proxy = %v, quality = %q, want dub, true and the flag kept", cfg.Lang, useProxy, defaultQuality)
+	}
+	if got := keys.Watch.Keys(); !reflect.DeepEqual(got, []string{"p"}) {
+		t.Errorf("watch keys = %q, want the remapped ones", got)
+	}
+
+	// an invalid config leaves the current one alone
+	writeConfig(t, "lang = \"raw\"\n")
+	msg, ok := reloadConfig().(noticeMsg)
+	if !ok || msg.err == nil {
+		t.Fatalf("reloadConfig() = %#v, want a notice with the error", msg)
+	}
+	if cfg.Lang != "dub" {
+		t.Errorf("lang = %q, want the config from before", cfg.Lang)
+	}
+}
+
+func TestReloadConfigDataDir(t *testing.T) {
+	oldCfg := cfg
+	t.Cleanup(func() {
+		cfg = oldCfg
+		setTheme("default")
+		keys = defaultKeys
+	})
+	applyConfig(defaultConfig())
+
+	// the database stays where it was opened, so the new data_dir waits for a restart
+	dir := t.TempDir()
+	writeConfig(t, fmt.Sprintf("lang = \"dub\"\ndata_dir = %q\n", dir))
+	msg, ok := reloadConfig().(configReloadedMsg)
+	if !ok || !msg.dataDirChanged {
+		t.Fatalf("reloadConfig() = %#v, want the data_dir change reported", msg)
+	}
+	if cfg.Lang != "dub" || cfg.DataDir != "" {
+		t.Errorf("lang = %q, data_dir = %q, want dub and the data_dir from before", cfg.Lang, cfg.DataDir)
+	}
+
+	updated, _ := model{}.Update(msg)
+	if toasts := updated.(model).toasts; len(toasts) != 1 || !strings.Contains(toasts[0].text, "restart") {
+		t.Errorf("toasts = %+v, want one asking for a restart", toasts)
+	}
+}
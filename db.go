@@ -2,17 +2,148 @@ package main
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 var db *sql.DB
 
-func getDbPath() (string, error) {
+var (
+	errAlreadyInList  = errors.New("anime is already in the list")
+	errNotInWatchlist = errors.New("anime is not in the watchlist")
+	errListExists     = errors.New("a list with that name already exists")
+	errDefaultList    = errors.New("the default watchlist can't be deleted")
+)
+
+// defaultListId is the list every existing watchlist entry was moved into
+const defaultListId = 1
+
+type watchStatus string
+
+const (
+	statusWatching    watchStatus = "watching"
+	statusCompleted   watchStatus = "completed"
+	statusOnHold      watchStatus = "on_hold"
+	statusDropped     watchStatus = "dropped"
+	statusPlanToWatch watchStatus = "plan_to_watch"
+)
+
+// watchStatuses in the order they are shown and cycled through
+var watchStatuses = []watchStatus{statusWatching, statusCompleted, statusOnHold, statusDropped, statusPlanToWatch}
+
+func (s watchStatus) String() string {
+	switch s {
+	case statusWatching:
+		return "Watching"
+	case statusCompleted:
+		return "Completed"
+	case statusOnHold:
+		return "On Hold"
+	case statusDropped:
+		return "Dropped"
+	case statusPlanToWatch:
+		return "Plan to Watch"
+	default:
+		return string(s)
+	}
+}
+
+func (s watchStatus) next() watchStatus {
+	for i, status := range watchStatuses {
+		if status == s {
+			return watchStatuses[(i+1)%len(watchStatuses)]
+		}
+	}
+	return watchStatuses[0]
+}
+
+// watchlistEntry is what we know about an anime that is in at least one list,
+// lists only group entries so an entry is shared by every list it's in
+type watchlistEntry struct {
+	animeId   string
+	status    watchStatus
+	score     int // 1-10, 0 when not scored
+	notes     string
+	rewatches int
+	tags      []string
+	sync      bool // false when the user opted out of syncing the anime to trackers
+	syncState syncState
+}
+
+// syncState tells whether the latest changes of an entry reached the trackers
+type syncState int
+
+const (
+	syncStateDone syncState = iota
+	syncStatePending
+	syncStateFailed
+)
+
+type animeList struct {
+	id    int
+	name  string
+	count int
+}
+
+// tags are stored one per row and joined with commas, which is why tags can't contain one
+const watchlistColumns = `w.anime_id, w.status, w.score, w.notes, w.rewatches,
+	COALESCE((SELECT GROUP_CONCAT(t.tag, ',') FROM tags t WHERE t.anime_id = w.anime_id), ''),
+	w.sync, (SELECT MAX(q.attempts) FROM sync_queue q WHERE q.anime_id = w.anime_id)`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEntry(row rowScanner) (watchlistEntry, error) {
+	var entry watchlistEntry
+	var tags string
+	var attempts sql.NullInt64
+	err := row.Scan(&entry.animeId, &entry.status, &entry.score, &entry.notes, &entry.rewatches, &tags, &entry.sync, &attempts)
+	switch {
+	case attempts.Valid && attempts.Int64 > 0:
+		entry.syncState = syncStateFailed
+	case attempts.Valid:
+		entry.syncState = syncStatePending
+	}
+	if tags != "" {
+		entry.tags = strings.Split(tags, ",")
+		sort.Strings(entry.tags)
+	}
+	return entry, err
+}
+
+// storageError wraps a failed database operation with what we were trying to do
+type storageError struct {
+	op  string
+	err error
+}
+
+func (e *storageError) Error() string {
+	return fmt.Sprintf("failed to %s: %v", e.op, e.err)
+}
+
+func (e *storageError) Unwrap() error {
+	return e.err
+}
+
+// isUniqueViolation reports whether err comes from a UNIQUE or PRIMARY KEY constraint
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// getAppDir returns the directory anigarden keeps its data in, creating it if needed
+func getAppDir() (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
 		return "", err
@@ -23,70 +154,396 @@ func getDbPath() (string, error) {
 		return "", err
 	}
 
-	return filepath.Join(appDir, "watchlist.db"), nil
+	return appDir, nil
 }
 
-func initDB() {
-	var err error
-	var dbPath string
+// getDataDir is where the database and exports are kept, the app dir unless data_dir is set
+func getDataDir() (string, error) {
+	if cfg.DataDir == "" {
+		return getAppDir()
+	}
+	if err := os.MkdirAll(cfg.DataDir, 0775); err != nil {
+		return "", err
+	}
+	return cfg.DataDir, nil
+}
 
-	dbPath, err = getDbPath()
+func getDbPath() (string, error) {
+	dataDir, err := getDataDir()
 	if err != nil {
-		log.Fatalf("failed to get db path: %v\n", err)
+		return "", err
+	}
+
+	return filepath.Join(dataDir, "watchlist.db"), nil
+}
+
+func initDB() error {
+	dbPath, err := getDbPath()
+	if err != nil {
+		return fmt.Errorf("failed to get db path: %w", err)
 	}
 
 	db, err = sql.Open("sqlite3", dbPath)
 	if err != nil {
-		log.Fatalf("failed to init db: %v\n", err)
+		return fmt.Errorf("failed to init db: %w", err)
 	}
 
-	_, err = db.Exec(`
-	CREATE TABLE IF NOT EXISTS watchlist (
-		anime_id TEXT NOT NULL UNIQUE,
-		added_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)
-	`)
+	if err := migrate(db, dbPath); err != nil {
+		return fmt.Errorf("failed to migrate db: %w", err)
+	}
+
+	return nil
+}
+
+// getWatchlist returns the entries in a list, newest first
+func getWatchlist(listId int) ([]watchlistEntry, error) {
+	rows, err := db.Query(`
+	SELECT `+watchlistColumns+`
+	FROM list_items li JOIN watchlist w ON w.anime_id = li.anime_id
+	WHERE li.list_id = ?
+	ORDER BY li.added_at DESC
+	`, listId)
 	if err != nil {
-		log.Fatalf("failed to create watchlist table: %v\n", err)
+		return nil, &storageError{"get watchlist", err}
+	}
+	defer rows.Close()
+
+	var entries []watchlistEntry
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, &storageError{"scan rows from watchlist", err}
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &storageError{"iterate watchlist rows", err}
 	}
+
+	return entries, nil
 }
 
-func getWatchlist() []string {
-	rows, err := db.Query(`SELECT anime_id FROM watchlist ORDER BY added_at DESC`)
+// getWatchlistEntries returns the entry of every anime in the watchlist, whatever list it's in
+func getWatchlistEntries() ([]watchlistEntry, error) {
+	rows, err := db.Query(`SELECT ` + watchlistColumns + ` FROM watchlist w`)
 	if err != nil {
-		log.Fatalf("failed to get watchlist: %v\n", err)
+		return nil, &storageError{"get watchlist entries", err}
 	}
 	defer rows.Close()
 
-	var animeIds []string
+	var entries []watchlistEntry
 	for rows.Next() {
-		var animeId string
-		if err := rows.Scan(&animeId); err != nil {
-			log.Fatalf("failed to scan rows from watchlist: %v\n", err)
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, &storageError{"scan rows from watchlist", err}
 		}
-		animeIds = append(animeIds, animeId)
+		entries = append(entries, entry)
 	}
 
 	if err := rows.Err(); err != nil {
-		log.Fatalf("error iterating watchlist rows: %v\n", err)
+		return nil, &storageError{"iterate watchlist rows", err}
 	}
 
-	return animeIds
+	return entries, nil
+}
+
+func getWatchlistEntry(animeId string) (watchlistEntry, error) {
+	row := db.QueryRow(`SELECT `+watchlistColumns+` FROM watchlist w WHERE w.anime_id = ?`, animeId)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entry, errNotInWatchlist
+	}
+	if err != nil {
+		return entry, &storageError{"get " + animeId + " from watchlist", err}
+	}
+	return entry, nil
 }
 
-func addAnimeToWatchlist(animeId string) {
-	_, err := db.Exec(`INSERT INTO watchlist (anime_id) VALUES (?)`, animeId)
+// addAnimeToList adds an anime to a list, creating its watchlist entry when it's in no list yet
+func addAnimeToList(listId int, animeId string) error {
+	tx, err := db.Begin()
 	if err != nil {
-		if strings.Contains(err.Error(), "UNIQUE") {
-			return
+		return &storageError{"add " + animeId + " to list", err}
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO watchlist (anime_id) VALUES (?)`, animeId); err != nil {
+		return &storageError{"add " + animeId + " to watchlist", err}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO list_items (list_id, anime_id) VALUES (?, ?)`, listId, animeId); err != nil {
+		if isUniqueViolation(err) {
+			return errAlreadyInList
 		}
-		log.Fatalf("failed to add %s to watchlist: %v\n", animeId, err)
+		return &storageError{"add " + animeId + " to list", err}
 	}
+
+	if err := tx.Commit(); err != nil {
+		return &storageError{"add " + animeId + " to list", err}
+	}
+	return nil
 }
 
-func removeAnimeFromWatchlist(animeId string) {
-	_, err := db.Exec(`DELETE FROM watchlist WHERE anime_id = (?)`, animeId)
+// removeAnimeFromList removes an anime from a list, once it's in no list at all
+// its entry and tags are removed too
+func removeAnimeFromList(listId int, animeId string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return &storageError{"remove " + animeId + " from list", err}
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM list_items WHERE list_id = ? AND anime_id = ?`, listId, animeId)
+	if err != nil {
+		return &storageError{"remove " + animeId + " from list", err}
+	}
+
+	removed, err := res.RowsAffected()
 	if err != nil {
-		log.Fatalf("failed to remove %s from watchlist: %v\n", animeId, err)
+		return &storageError{"remove " + animeId + " from list", err}
+	}
+	if removed == 0 {
+		return errNotInWatchlist
 	}
+
+	if err := removeOrphans(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &storageError{"remove " + animeId + " from list", err}
+	}
+	return nil
+}
+
+// removeOrphans deletes entries and tags of anime that are no longer in any list
+func removeOrphans(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM watchlist WHERE anime_id NOT IN (SELECT anime_id FROM list_items)`)
+	if err != nil {
+		return &storageError{"clean up watchlist", err}
+	}
+	_, err = tx.Exec(`DELETE FROM tags WHERE anime_id NOT IN (SELECT anime_id FROM list_items)`)
+	if err != nil {
+		return &storageError{"clean up tags", err}
+	}
+	return nil
+}
+
+func getLists() ([]animeList, error) {
+	rows, err := db.Query(`
+	SELECT l.id, l.name, COUNT(li.anime_id)
+	FROM lists l LEFT JOIN list_items li ON li.list_id = l.id
+	GROUP BY l.id
+	ORDER BY l.id
+	`)
+	if err != nil {
+		return nil, &storageError{"get lists", err}
+	}
+	defer rows.Close()
+
+	var lists []animeList
+	for rows.Next() {
+		var l animeList
+		if err := rows.Scan(&l.id, &l.name, &l.count); err != nil {
+			return nil, &storageError{"scan rows from lists", err}
+		}
+		lists = append(lists, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &storageError{"iterate list rows", err}
+	}
+
+	return lists, nil
+}
+
+func createList(name string) (int, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, errors.New("list name can't be empty")
+	}
+
+	res, err := db.Exec(`INSERT INTO lists (name) VALUES (?)`, name)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return 0, errListExists
+		}
+		return 0, &storageError{"create list " + name, err}
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, &storageError{"create list " + name, err}
+	}
+	return int(id), nil
+}
+
+func deleteList(listId int) error {
+	if listId == defaultListId {
+		return errDefaultList
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return &storageError{"delete list", err}
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM list_items WHERE list_id = ?`, listId); err != nil {
+		return &storageError{"delete list", err}
+	}
+	if _, err := tx.Exec(`DELETE FROM lists WHERE id = ?`, listId); err != nil {
+		return &storageError{"delete list", err}
+	}
+	if err := removeOrphans(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &storageError{"delete list", err}
+	}
+	return nil
+}
+
+// parseTags splits a comma separated list of tags, tags are trimmed, lowercased and deduplicated
+func parseTags(input string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// setTags replaces the tags of a watchlist entry
+func setTags(animeId string, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return &storageError{"update tags of " + animeId, err}
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM watchlist WHERE anime_id = ?)`, animeId).Scan(&exists); err != nil {
+		return &storageError{"update tags of " + animeId, err}
+	}
+	if !exists {
+		return errNotInWatchlist
+	}
+
+	if _, err := tx.Exec(`DELETE FROM tags WHERE anime_id = ?`, animeId); err != nil {
+		return &storageError{"update tags of " + animeId, err}
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(`INSERT INTO tags (anime_id, tag) VALUES (?, ?)`, animeId, tag); err != nil {
+			return &storageError{"update tags of " + animeId, err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &storageError{"update tags of " + animeId, err}
+	}
+	return nil
+}
+
+// updateEntry runs an update on a single watchlist entry
+func updateEntry(animeId, op, query string, args ...any) error {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return &storageError{op + " of " + animeId, err}
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return &storageError{op + " of " + animeId, err}
+	}
+	if updated == 0 {
+		return errNotInWatchlist
+	}
+	return nil
+}
+
+func setWatchStatus(animeId string, status watchStatus) error {
+	return updateEntry(animeId, "update status", `UPDATE watchlist SET status = ? WHERE anime_id = ?`, status, animeId)
+}
+
+func setScore(animeId string, score int) error {
+	if score < 0 || score > 10 {
+		return fmt.Errorf("score must be between 0 and 10 (0 = unscored), got %d", score)
+	}
+	return updateEntry(animeId, "update score", `UPDATE watchlist SET score = ? WHERE anime_id = ?`, score, animeId)
+}
+
+func setNotes(animeId, notes string) error {
+	return updateEntry(animeId, "update notes", `UPDATE watchlist SET notes = ? WHERE anime_id = ?`, notes, animeId)
+}
+
+func incrementRewatches(animeId string) error {
+	return updateEntry(animeId, "update rewatches", `UPDATE watchlist SET rewatches = rewatches + 1 WHERE anime_id = ?`, animeId)
+}
+
+func setSync(animeId string, sync bool) error {
+	return updateEntry(animeId, "update sync", `UPDATE watchlist SET sync = ? WHERE anime_id = ?`, sync, animeId)
+}
+
+// recordPlayback adds an episode to the watch history and moves the anime along in the watchlist,
+// planned anime become watching on first playback and completed moves a watching or planned anime
+// to completed, dropped and on hold ones keep their status
+func recordPlayback(animeId string, ep episode, completed, watched bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return &storageError{"record playback", err}
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO history (anime_id, episode_id, episode_number, watched) VALUES (?, ?, ?, ?)`, animeId, ep.ID, ep.Number, watched)
+	if err != nil {
+		return &storageError{"record playback", err}
+	}
+
+	if completed {
+		_, err = tx.Exec(`UPDATE watchlist SET status = ? WHERE anime_id = ? AND status IN (?, ?)`,
+			statusCompleted, animeId, statusWatching, statusPlanToWatch)
+	} else {
+		_, err = tx.Exec(`UPDATE watchlist SET status = ? WHERE anime_id = ? AND status = ?`, statusWatching, animeId, statusPlanToWatch)
+	}
+	if err != nil {
+		return &storageError{"update status of " + animeId, err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &storageError{"record playback", err}
+	}
+	return nil
+}
+
+// getWatchedEpisodes returns the numbers of the episodes of an anime that were watched at least once
+func getWatchedEpisodes(animeId string) (map[int]bool, error) {
+	rows, err := db.Query(`SELECT DISTINCT episode_number FROM history WHERE anime_id = ? AND watched = 1`, animeId)
+	if err != nil {
+		return nil, &storageError{"get watch history of " + animeId, err}
+	}
+	defer rows.Close()
+
+	watched := map[int]bool{}
+	for rows.Next() {
+		var number int
+		if err := rows.Scan(&number); err != nil {
+			return nil, &storageError{"scan watch history", err}
+		}
+		watched[number] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &storageError{"iterate watch history rows", err}
+	}
+
+	return watched, nil
 }
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWatchlistErrors(t *testing.T) {
+	useTestDB(t)
+
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := addAnimeToList(defaultListId, "one-piece-100"); !errors.Is(err, errAlreadyInList) {
+		t.Errorf("adding twice = %v, want %v", err, errAlreadyInList)
+	}
+	if err := removeAnimeFromList(defaultListId, "frieren-18542"); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("removing a missing anime = %v, want %v", err, errNotInWatchlist)
+	}
+	if err := removeAnimeFromList(defaultListId, "one-piece-100"); err != nil {
+		t.Errorf("removing = %v", err)
+	}
+	ids, err := getWatchlist(defaultListId)
+	if err != nil || len(ids) != 0 {
+		t.Errorf("watchlist = %v, %v, want it empty", ids, err)
+	}
+}
+
+func TestStorageError(t *testing.T) {
+	useTestDB(t)
+	db.Close()
+
+	_, err := getWatchlist(defaultListId)
+	var storageErr *storageError
+	if !errors.As(err, &storageErr) {
+		t.Fatalf("err = %v, want a storage error", err)
+	}
+	if !strings.HasPrefix(err.Error(), "failed to get watchlist: ") || errors.Unwrap(err) == nil {
+		t.Errorf("err = %q, want it to say what failed and wrap the cause", err)
+	}
+	if isUniqueViolation(err) {
+		t.Error("a closed database isn't a unique violation")
+	}
+}
+
+func TestWatchStatusNext(t *testing.T) {
+	status := statusWatching
+	for range watchStatuses {
+		status = status.next()
+	}
+	if status != statusWatching {
+		t.Errorf("cycling through every status ended on %s", status)
+	}
+	if got := watchStatus("binging").next(); got != watchStatuses[0] {
+		t.Errorf("next of an unknown status = %s, want %s", got, watchStatuses[0])
+	}
+}
+
+func TestRecordPlayback(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    watchStatus
+		completed bool
+		want      watchStatus
+	}{
+		{"planned starts watching", statusPlanToWatch, false, statusWatching},
+		{"watching keeps watching", statusWatching, false, statusWatching},
+		{"on hold stays on hold", statusOnHold, false, statusOnHold},
+		{"last episode completes", statusWatching, true, statusCompleted},
+		{"dropped stays dropped", statusDropped, true, statusDropped},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+				t.Fatal(err)
+			}
+			if err := setWatchStatus("one-piece-100", tt.status); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := recordPlayback("one-piece-100", episode{ID: "one-piece-100?ep=1", Number: 1}, tt.completed, true); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := getWatchlist(defaultListId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].status != tt.want {
+				t.Errorf("watchlist = %+v, want one anime %s", entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordPlaybackOutsideWatchlist(t *testing.T) {
+	useTestDB(t)
+	if err := recordPlayback("one-piece-100", episode{ID: "one-piece-100?ep=1", Number: 1}, true, true); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := getWatchlist(defaultListId)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("watchlist = %+v, %v, want playback to leave it alone", entries, err)
+	}
+	if err := setWatchStatus("one-piece-100", statusDropped); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("setting the status = %v, want %v", err, errNotInWatchlist)
+	}
+}
+
+func TestEntryUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		update  func(animeId string) error
+		want    watchlistEntry
+		wantErr bool
+	}{
+		{"status", func(id string) error { return setWatchStatus(id, statusOnHold) }, watchlistEntry{sync: true, status: statusOnHold}, false},
+		{"score", func(id string) error { return setScore(id, 9) }, watchlistEntry{sync: true, status: statusPlanToWatch, score: 9}, false},
+		{"unscore", func(id string) error { return setScore(id, 0) }, watchlistEntry{sync: true, status: statusPlanToWatch}, false},
+		{"score too high", func(id string) error { return setScore(id, 11) }, watchlistEntry{sync: true, status: statusPlanToWatch}, true},
+		{"negative score", func(id string) error { return setScore(id, -1) }, watchlistEntry{sync: true, status: statusPlanToWatch}, true},
+		{"notes", func(id string) error { return setNotes(id, "peak\nfiction") }, watchlistEntry{sync: true, status: statusPlanToWatch, notes: "peak\nfiction"}, false},
+		{"rewatches", func(id string) error {
+			if err := incrementRewatches(id); err != nil {
+				return err
+			}
+			return incrementRewatches(id)
+		}, watchlistEntry{sync: true, status: statusPlanToWatch, rewatches: 2}, false},
+		{"opt out of syncing", func(id string) error { return setSync(id, false) }, watchlistEntry{status: statusPlanToWatch}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.update("one-piece-100"); (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, err := getWatchlistEntry("one-piece-100")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.animeId = "one-piece-100"
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entry = %+v, want %+v", got, tt.want)
+			}
+
+			// the anime of the info page may not be in the watchlist
+			if err := tt.update("frieren-18542"); !errors.Is(err, errNotInWatchlist) && !tt.wantErr {
+				t.Errorf("updating an anime outside the watchlist = %v, want %v", err, errNotInWatchlist)
+			}
+		})
+	}
+}
+
+func TestWatchlistItemDescription(t *testing.T) {
+	tests := []struct {
+		entry watchlistEntry
+		want  string
+	}{
+		{watchlistEntry{status: statusWatching}, "Watching"},
+		{watchlistEntry{status: statusCompleted, score: 8, rewatches: 1, notes: "two\nlines"}, "Completed · score 8/10 · rewatched 1x · notes: two lines"},
+	}
+	for _, tt := range tests {
+		if got := (watchlistItem{watchlistEntry: tt.entry}).Description(); got != tt.want {
+			t.Errorf("Description() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestListMembership(t *testing.T) {
+	useTestDB(t)
+	friday, err := createList("Friday night")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, listId := range []int{defaultListId, friday} {
+		if err := addAnimeToList(listId, "one-piece-100"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addAnimeToList(friday, "one-piece-100"); !errors.Is(err, errAlreadyInList) {
+		t.Errorf("adding twice = %v, want %v", err, errAlreadyInList)
+	}
+	if err := setScore("one-piece-100", 9); err != nil {
+		t.Fatal(err)
+	}
+	if err := setTags("one-piece-100", []string{"comfy"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the entry is shared, leaving one list keeps it
+	if err := removeAnimeFromList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := getWatchlistEntry("one-piece-100")
+	if err != nil || entry.score != 9 || !reflect.DeepEqual(entry.tags, []string{"comfy"}) {
+		t.Errorf("entry after leaving one list = %+v, %v", entry, err)
+	}
+	if err := removeAnimeFromList(defaultListId, "one-piece-100"); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("removing twice = %v, want %v", err, errNotInWatchlist)
+	}
+
+	// leaving the last one removes the entry and its tags
+	if err := removeAnimeFromList(friday, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getWatchlistEntry("one-piece-100"); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("entry after leaving every list = %v, want %v", err, errNotInWatchlist)
+	}
+	if err := addAnimeToList(friday, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if entry, _ := getWatchlistEntry("one-piece-100"); entry.score != 0 || entry.tags != nil {
+		t.Errorf("re-added entry = %+v, want a fresh one", entry)
+	}
+}
+
+func TestLists(t *testing.T) {
+	useTestDB(t)
+	friday, err := createList("  Friday night ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createList("Friday night"); !errors.Is(err, errListExists) {
+		t.Errorf("creating a list twice = %v, want %v", err, errListExists)
+	}
+	if _, err := createList("   "); err == nil {
+		t.Error("created a list without a name")
+	}
+	if err := deleteList(defaultListId); !errors.Is(err, errDefaultList) {
+		t.Errorf("deleting the watchlist = %v, want %v", err, errDefaultList)
+	}
+
+	for _, id := range []string{"one-piece-100", "frieren-18542"} {
+		if err := addAnimeToList(friday, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addAnimeToList(defaultListId, "frieren-18542"); err != nil {
+		t.Fatal(err)
+	}
+
+	lists, err := getLists()
+	want := []animeList{{defaultListId, "Watchlist", 1}, {friday, "Friday night", 2}}
+	if err != nil || !reflect.DeepEqual(lists, want) {
+		t.Errorf("lists = %+v, %v, want %+v", lists, err, want)
+	}
+
+	// deleting a list only removes the anime that were in no other list
+	if err := deleteList(friday); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getWatchlistEntry("one-piece-100"); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("anime only in the deleted list = %v, want %v", err, errNotInWatchlist)
+	}
+	if _, err := getWatchlistEntry("frieren-18542"); err != nil {
+		t.Errorf("anime in another list = %v, want it kept", err)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"comfy, Long ,comfy", []string{"comfy", "long"}},
+		{"zeta,alpha", []string{"alpha", "zeta"}},
+		{" , ,", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseTags(tt.input); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTags(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSetTags(t *testing.T) {
+	useTestDB(t)
+	if err := setTags("one-piece-100", []string{"comfy"}); !errors.Is(err, errNotInWatchlist) {
+		t.Errorf("tagging an anime outside the watchlist = %v, want %v", err, errNotInWatchlist)
+	}
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tags := range [][]string{{"zeta", "alpha"}, {"long"}, nil} {
+		if err := setTags("one-piece-100", tags); err != nil {
+			t.Fatal(err)
+		}
+		entry, err := getWatchlistEntry("one-piece-100")
+		want := slices.Sorted(slices.Values(tags))
+		if err != nil || !reflect.DeepEqual(entry.tags, want) {
+			t.Errorf("tags = %q, %v, want %q", entry.tags, err, want)
+		}
+	}
+}
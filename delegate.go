@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// watchlistEntries are the entries of every anime in the watchlist by anime id, the anime
+// lists mark the anime found in it. The root model refreshes them whenever the watchlist changes
+var watchlistEntries = map[string]watchlistEntry{}
+
+type watchlistEntriesMsg struct{ entries map[string]watchlistEntry }
+
+func fetchWatchlistEntries() tea.Msg {
+	entries, err := getWatchlistEntries()
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	byId := make(map[string]watchlistEntry, len(entries))
+	for _, entry := range entries {
+		byId[entry.animeId] = entry
+	}
+	return watchlistEntriesMsg{byId}
+}
+
+// animeDelegate draws anime and watchlist items with badges. Compact rows are the name and the
+// badges on one line, detailed rows put the badges and the description under the name
+type animeDelegate struct {
+	compact bool
+	styles  list.DefaultItemStyles
+}
+
+func newAnimeDelegate(compact bool) animeDelegate {
+	return animeDelegate{compact, newDelegate().Styles}
+}
+
+// newAnimeList creates a list of anime or watchlist items, sized later with SetSize
+func newAnimeList(items []list.Item, compact bool) list.Model {
+	l := newList(items)
+	l.SetDelegate(newAnimeDelegate(compact))
+	return l
+}
+
+func (d animeDelegate) Height() int {
+	if d.compact {
+		return 1
+	}
+	return 2
+}
+
+func (d animeDelegate) Spacing() int {
+	if d.compact {
+		return 0
+	}
+	return 1
+}
+
+func (d animeDelegate) Update(tea.Msg, *list.Model) tea.Cmd {
+	return nil
+}
+
+func (d animeDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	a, ok := itemAnime(item)
+	if !ok || m.Width() <= 0 {
+		return
+	}
+
+	var (
+		s           = &d.styles
+		emptyFilter = m.FilterState() == list.Filtering && m.FilterValue() == ""
+		isFiltered  = m.FilterState() != list.Unfiltered
+		isSelected  = index == m.Index() && m.FilterState() != list.Filtering
+	)
+
+	nameStyle, descStyle := s.NormalTitle, s.NormalDesc
+	switch {
+	case emptyFilter:
+		nameStyle, descStyle = s.DimmedTitle, s.DimmedDesc
+	case isSelected:
+		nameStyle, descStyle = s.SelectedTitle, s.SelectedDesc
+	}
+	width := m.Width() - nameStyle.GetHorizontalFrameSize()
+
+	// watchlist rows describe their entry, detailed ones leave it out of the badges
+	var entry *watchlistEntry
+	desc := ""
+	switch item := item.(type) {
+	case watchlistItem:
+		desc = item.Description()
+		if d.compact {
+			entry = &item.watchlistEntry
+		}
+	case anime:
+		desc = item.Description()
+		if e, ok := watchlistEntries[a.ID]; ok {
+			entry = &e
+		}
+	}
+	badges := animeBadges(a, entry)
+
+	nameWidth := width
+	if d.compact && badges != "" {
+		nameWidth = max(width-lipgloss.Width(badges)-1, min(width, 10))
+	}
+	name := ansi.Truncate(a.Name, nameWidth, "…")
+	if isFiltered && !emptyFilter {
+		unmatched := nameStyle.Inline(true)
+		name = lipgloss.StyleRunes(name, m.MatchesForItem(index), unmatched.Inherit(s.FilterMatch), unmatched)
+	}
+
+	if d.compact {
+		line := name
+		if badges != "" {
+			line = ansi.Truncate(name+" "+badges, width, "…")
+		}
+		fmt.Fprint(w, nameStyle.Render(line))
+		return
+	}
+
+	// the description is styled before the badges are put in front of it, they end with a reset
+	desc, _, _ = strings.Cut(desc, "\n")
+	second := descStyle.Inline(true).Render(desc)
+	if badges != "" {
+		second = badges + "  " + second
+	}
+	fmt.Fprintf(w, "%s\n%s", nameStyle.Render(name), descStyle.Render(ansi.Truncate(second, width, "…")))
+}
+
+// animeBadges labels an anime with its type, episode counts and age rating,
+// and with its status and score when entry is set
+func animeBadges(a anime, entry *watchlistEntry) string {
+	var badges []string
+	if a.Type != "" {
+		badges = append(badges, typeBadgeStyle.Render(a.Type))
+	}
+	if a.Episodes.Sub > 0 {
+		badges = append(badges, badgeStyle.Render(fmt.Sprintf("sub %d", a.Episodes.Sub)))
+	}
+	if a.Episodes.Dub > 0 {
+		badges = append(badges, badgeStyle.Render(fmt.Sprintf("dub %d", a.Episodes.Dub)))
+	}
+	if a.Rating != "" {
+		badges = append(badges, badgeStyle.Render(a.Rating))
+	}
+	if entry != nil {
+		badges = append(badges, accentStyle.Render("✓ "+entry.status.String()))
+		if entry.score != 0 {
+			badges = append(badges, accentStyle.Render(fmt.Sprintf("★ %d", entry.score)))
+		}
+	}
+	return strings.Join(badges, " ")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var frieren = anime{
+	ID:       "frieren-18542",
+	Name:     "Frieren: Beyond Journey's End",
+	Body:     "An elf mage outlives her party.<br>She sets out again.",
+	Type:     "TV",
+	Rating:   "13+",
+	Episodes: episodeCounts{Sub: 28, Dub: 28},
+}
+
+func TestAnimeBadges(t *testing.T) {
+	tests := []struct {
+		name  string
+		anime anime
+		entry *watchlistEntry
+		want  string
+	}{
+		// the type is drawn as a filled label, padded by a space
+		{"everything", frieren, nil, " TV  sub 28 dub 28 13+"},
+		{"in the watchlist", frieren, &watchlistEntry{status: statusWatching, score: 9}, " TV  sub 28 dub 28 13+ ✓ Watching ★ 9"},
+		{"unscored", anime{Type: "Movie"}, &watchlistEntry{status: statusPlanToWatch}, " Movie  ✓ Plan to Watch"},
+		{"nothing known", anime{}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ansi.Strip(animeBadges(tt.anime, tt.entry)); got != tt.want {
+				t.Errorf("animeBadges = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnimeDelegateRender(t *testing.T) {
+	old := watchlistEntries
+	t.Cleanup(func() { watchlistEntries = old })
+	watchlistEntries = map[string]watchlistEntry{frieren.ID: {animeId: frieren.ID, status: statusCompleted, score: 10}}
+
+	tests := []struct {
+		name    string
+		item    list.Item
+		compact bool
+		width   int
+		want    []string // parts of every line
+	}{
+		{"detailed", frieren, false, 80, []string{"Frieren: Beyond Journey's End", "TV  sub 28 dub 28 13+ ✓ Completed ★ 10  An elf mage outlives her party."}},
+		{"compact", frieren, true, 80, []string{"Frieren: Beyond Journey's End  TV  sub 28 dub 28 13+ ✓ Completed ★ 10"}},
+		// the name keeps 10 cells when the badges don't fit
+		{"compact and narrow", frieren, true, 30, []string{"Frieren: …  TV"}},
+		{"watchlist item", watchlistItem{anime: frieren, watchlistEntry: watchlistEntry{status: statusOnHold}}, false, 80, []string{"Frieren", "TV  sub 28 dub 28 13+  On Hold"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newAnimeDelegate(tt.compact)
+			l := list.New([]list.Item{tt.item}, d, tt.width, 20)
+
+			var buf bytes.Buffer
+			d.Render(&buf, l, 0, tt.item)
+			lines := strings.Split(buf.String(), "\n")
+			if len(lines) != d.Height() {
+				t.Fatalf("rendered %d lines, want %d", len(lines), d.Height())
+			}
+			for i, line := range lines {
+				if w := lipgloss.Width(line); w > tt.width {
+					t.Errorf("line %d is %d cells wide, want at most %d", i, w, tt.width)
+				}
+				if plain := ansi.Strip(line); !strings.Contains(plain, tt.want[i]) {
+					t.Errorf("line %d = %q, want it to contain %q", i, plain, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFetchWatchlistEntries(t *testing.T) {
+	useTestDB(t)
+	listId, err := createList("Favourites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := addAnimeToList(listId, "frieren-18542"); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, ok := fetchWatchlistEntries().(watchlistEntriesMsg)
+	if !ok {
+		t.Fatalf("fetchWatchlistEntries() = %#v", msg)
+	}
+	if len(msg.entries) != 2 || msg.entries["frieren-18542"].status != statusPlanToWatch {
+		t.Errorf("entries = %+v, want the anime of every list", msg.entries)
+	}
+}
+
+func TestToggleRows(t *testing.T) {
+	m := initialModel()
+	m = press(m, keys.ToggleRows.Keys()[0])
+	if !m.home.compact || !m.search.compact || !m.watchlist.compact {
+		t.Fatal("toggling left a page with detailed rows")
+	}
+
+	m = showInfo(m, "frieren-18542")
+	m = press(m, keys.ToggleRows.Keys()[0])
+	if !m.home.compact {
+		t.Error("the rows toggled from the info page")
+	}
+}
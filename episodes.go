@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+)
+
+// long series are split into ranges, the episode list shows one range at a time
+const episodeRangeSize = 100
+
+// episodeRange is the episodes of an anime from index start up to end
+type episodeRange struct{ start, end int }
+
+// label is the numbers of the first and last episode of the range, like 101–200
+func (r episodeRange) label(episodes []episode) string {
+	if r.start == r.end {
+		return ""
+	}
+	return fmt.Sprintf("%d–%d", episodes[r.start].Number, episodes[r.end-1].Number)
+}
+
+// episodeRanges splits episodes into ranges, there's always at least one even when there are no episodes
+func episodeRanges(episodes []episode) []episodeRange {
+	ranges := []episodeRange{}
+	for start := 0; start < len(episodes); start += episodeRangeSize {
+		ranges = append(ranges, episodeRange{start, min(start+episodeRangeSize, len(episodes))})
+	}
+	if len(ranges) == 0 {
+		ranges = append(ranges, episodeRange{})
+	}
+	return ranges
+}
+
+func episodeItems(episodes []episode) []list.Item {
+	items := make([]list.Item, len(episodes))
+	for i, ep := range episodes {
+		items[i] = ep
+	}
+	return items
+}
+
+// episodeIndex returns the index of the episode with the given number
+func episodeIndex(episodes []episode, number int) (int, bool) {
+	for i, ep := range episodes {
+		if ep.Number == number {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// nextUnwatched returns the index of the first unwatched episode after the last watched one,
+// or of the first unwatched episode at all when every episode after it was watched
+func nextUnwatched(episodes []episode, watched map[int]bool) (int, bool) {
+	last := 0
+	for n := range watched {
+		last = max(last, n)
+	}
+	for i, ep := range episodes {
+		if ep.Number > last && !watched[ep.Number] {
+			return i, true
+		}
+	}
+	for i, ep := range episodes {
+		if !watched[ep.Number] {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// renderRanges draws the range sidebar with the selected range in the accent colour, and its
+// title too while it has focus. It scrolls to keep the selected range within height lines
+func renderRanges(ranges []episodeRange, episodes []episode, selected, height int, focused bool) string {
+	title := mutedStyle.Render("Ranges")
+	if focused {
+		title = accentStyle.Render("Ranges")
+	}
+	// the first lines line the ranges up with the episodes under the list title
+	lines := []string{title, ""}
+	visible := max(height-len(lines), 1)
+	first := min(max(selected-visible/2, 0), max(len(ranges)-visible, 0))
+
+	for r := first; r < min(first+visible, len(ranges)); r++ {
+		label := ranges[r].label(episodes)
+		if r == selected {
+			lines = append(lines, accentStyle.Render("› "+label))
+		} else {
+			lines = append(lines, mutedStyle.Render("  "+label))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withoutFiller returns the episodes that aren't filler
+func withoutFiller(episodes []episode) []episode {
+	return slices.DeleteFunc(slices.Clone(episodes), func(ep episode) bool { return ep.IsFiller })
+}
+
+// episodeSummary is the header of the episode list, like 1122 eps · 94 filler
+func episodeSummary(episodes []episode, hideFiller bool) string {
+	filler := len(episodes) - len(withoutFiller(episodes))
+	summary := fmt.Sprintf("%d eps", len(episodes))
+	if filler > 0 {
+		summary += fmt.Sprintf(" · %d filler", filler)
+		if hideFiller {
+			summary += " hidden"
+		}
+	}
+	return summary
+}
+
+// episodeDelegate draws filler episodes in the filler colour of the theme
+type episodeDelegate struct {
+	list.DefaultDelegate
+	filler list.DefaultDelegate
+}
+
+func newEpisodeDelegate() episodeDelegate {
+	filler := newDelegate()
+	filler.Styles.NormalTitle = filler.Styles.NormalTitle.Foreground(color(theme.Filler))
+	filler.Styles.NormalDesc = filler.Styles.NormalDesc.Foreground(color(theme.Filler))
+	return episodeDelegate{newDelegate(), filler}
+}
+
+func (d episodeDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	if ep, ok := item.(episode); ok && ep.IsFiller {
+		d.filler.Render(w, m, index, item)
+		return
+	}
+	d.DefaultDelegate.Render(w, m, index, item)
+}
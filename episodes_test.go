@@ -0,0 +1,215 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// numbered makes n episodes numbered from 1
+func numbered(n int) []episode {
+	episodes := make([]episode, n)
+	for i := range episodes {
+		episodes[i] = episode{Number: i + 1}
+	}
+	return episodes
+}
+
+func TestEpisodeRanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		episodes   int
+		want       []episodeRange
+		wantLabels []string
+	}{
+		{"no episodes", 0, []episodeRange{{0, 0}}, []string{""}},
+		{"one range", 12, []episodeRange{{0, 12}}, []string{"1–12"}},
+		{"exactly one range", episodeRangeSize, []episodeRange{{0, 100}}, []string{"1–100"}},
+		{"a partial last range", 250, []episodeRange{{0, 100}, {100, 200}, {200, 250}}, []string{"1–100", "101–200", "201–250"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			episodes := numbered(tt.episodes)
+			got := episodeRanges(episodes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("episodeRanges = %v, want %v", got, tt.want)
+			}
+			for i, r := range got {
+				if label := r.label(episodes); label != tt.wantLabels[i] {
+					t.Errorf("range %d label = %q, want %q", i, label, tt.wantLabels[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEpisodeIndex(t *testing.T) {
+	// numbers don't always start at 1 or match the index
+	episodes := []episode{{Number: 0}, {Number: 1}, {Number: 3}}
+	tests := []struct {
+		number int
+		want   int
+		found  bool
+	}{
+		{0, 0, true},
+		{3, 2, true},
+		{2, 0, false},
+		{4, 0, false},
+	}
+	for _, tt := range tests {
+		i, ok := episodeIndex(episodes, tt.number)
+		if i != tt.want || ok != tt.found {
+			t.Errorf("episodeIndex(%d) = %d, %v, want %d, %v", tt.number, i, ok, tt.want, tt.found)
+		}
+	}
+}
+
+func TestNextUnwatched(t *testing.T) {
+	tests := []struct {
+		name    string
+		watched map[int]bool
+		want    int
+		found   bool
+	}{
+		{"nothing watched", nil, 0, true},
+		{"after the last watched", map[int]bool{1: true, 2: true}, 2, true},
+		{"skips gaps before the last watched", map[int]bool{1: true, 3: true}, 3, true},
+		{"wraps around to a gap", map[int]bool{1: true, 2: true, 4: true, 5: true}, 2, true},
+		{"everything watched", map[int]bool{1: true, 2: true, 3: true, 4: true, 5: true}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, ok := nextUnwatched(numbered(5), tt.watched)
+			if i != tt.want || ok != tt.found {
+				t.Errorf("nextUnwatched = %d, %v, want %d, %v", i, ok, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestInfoEpisodeNavigation(t *testing.T) {
+	watched := map[int]bool{}
+	for n := 1; n <= 120; n++ {
+		watched[n] = true
+	}
+	i := initInfoModel(anime{ID: "one-piece-100", Name: "One Piece"}, "sub", "mpv", 120, 40)
+	i, _ = i.Update(episodesMsg{episodes: numbered(250), watched: watched})
+
+	selected := func() int {
+		ep, _ := i.list.SelectedItem().(episode)
+		return ep.Number
+	}
+	send := func(keys ...string) tea.Cmd {
+		var cmd tea.Cmd
+		for _, k := range keys {
+			i, cmd = i.Update(keyPress(k))
+		}
+		return cmd
+	}
+	if i.rangeIdx != 0 || len(i.list.Items()) != episodeRangeSize || selected() != 1 {
+		t.Fatalf("range %d with %d episodes on %d, want the first range", i.rangeIdx, len(i.list.Items()), selected())
+	}
+
+	send(keys.NextUnwatched.Keys()[0])
+	if i.rangeIdx != 1 || selected() != 121 {
+		t.Errorf("next unwatched = range %d on %d, want range 1 on 121", i.rangeIdx, selected())
+	}
+
+	send(keys.JumpToEpisode.Keys()[0], "2", "0", "5", "enter")
+	if i.jumping || i.rangeIdx != 2 || selected() != 205 {
+		t.Errorf("jump = range %d on %d, want range 2 on 205", i.rangeIdx, selected())
+	}
+
+	cmd := send(keys.JumpToEpisode.Keys()[0], "9", "9", "9", "enter")
+	if msg, ok := cmd().(noticeMsg); !ok || msg.text != "there's no episode 999" {
+		t.Errorf("jumping past the last episode = %#v, want a notice", msg)
+	}
+	if selected() != 205 {
+		t.Errorf("cursor moved to %d, want it left on 205", selected())
+	}
+
+	send(keys.PrevRange.Keys()[0])
+	if i.rangeIdx != 1 || selected() != 101 {
+		t.Errorf("previous range = range %d on %d, want range 1 on 101", i.rangeIdx, selected())
+	}
+	send(keys.NextRange.Keys()[0], keys.NextRange.Keys()[0], keys.NextRange.Keys()[0])
+	if i.rangeIdx != 2 {
+		t.Errorf("range = %d, want the last range kept", i.rangeIdx)
+	}
+}
+
+func TestFiller(t *testing.T) {
+	episodes := []episode{{Number: 1}, {Number: 2, IsFiller: true}, {Number: 3}, {Number: 4, IsFiller: true}}
+	tests := []struct {
+		name       string
+		episodes   []episode
+		hideFiller bool
+		want       string
+		wantShown  []int
+	}{
+		{"no filler", numbered(3), false, "3 eps", []int{1, 2, 3}},
+		{"filler shown", episodes, false, "4 eps · 2 filler", []int{1, 3}},
+		{"filler hidden", episodes, true, "4 eps · 2 filler hidden", []int{1, 3}},
+		{"hiding without filler", numbered(2), true, "2 eps", []int{1, 2}},
+		{"no episodes", nil, false, "0 eps", []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := episodeSummary(tt.episodes, tt.hideFiller); got != tt.want {
+				t.Errorf("episodeSummary = %q, want %q", got, tt.want)
+			}
+			shown := []int{}
+			for _, ep := range withoutFiller(tt.episodes) {
+				shown = append(shown, ep.Number)
+			}
+			if !reflect.DeepEqual(shown, tt.wantShown) {
+				t.Errorf("withoutFiller = %v, want %v", shown, tt.wantShown)
+			}
+		})
+	}
+	if !episodes[1].IsFiller || len(episodes) != 4 {
+		t.Error("withoutFiller changed the episodes it was given")
+	}
+}
+
+func TestInfoHideFiller(t *testing.T) {
+	episodes := []episode{{Number: 1}, {Number: 2, IsFiller: true}, {Number: 3, IsFiller: true}, {Number: 4}}
+	i := initInfoModel(anime{ID: "naruto-677", Name: "Naruto"}, "sub", "mpv", 120, 40)
+	i, _ = i.Update(episodesMsg{episodes: episodes})
+	i.list.Select(1)
+
+	shown := func() []int {
+		numbers := []int{}
+		for _, item := range i.list.Items() {
+			numbers = append(numbers, item.(episode).Number)
+		}
+		return numbers
+	}
+
+	// hiding the filler under the cursor moves it to the next episode shown
+	i, _ = i.Update(keyPress(keys.ToggleFiller.Keys()[0]))
+	if got := shown(); !reflect.DeepEqual(got, []int{1, 4}) {
+		t.Errorf("episodes = %v, want the filler hidden", got)
+	}
+	if ep := i.list.SelectedItem().(episode); ep.Number != 4 {
+		t.Errorf("cursor on %d, want 4", ep.Number)
+	}
+
+	i, cmd := i.Update(keyPress(keys.JumpToEpisode.Keys()[0]))
+	for _, k := range []string{"3", "enter"} {
+		i, cmd = i.Update(keyPress(k))
+	}
+	if msg, ok := cmd().(noticeMsg); !ok || !strings.HasPrefix(msg.text, "episode 3 is filler") {
+		t.Errorf("jumping to hidden filler = %#v, want a notice", msg)
+	}
+
+	i, _ = i.Update(keyPress(keys.ToggleFiller.Keys()[0]))
+	if got := shown(); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("episodes = %v, want every episode back", got)
+	}
+	if ep := i.list.SelectedItem().(episode); ep.Number != 4 {
+		t.Errorf("cursor on %d, want it kept on 4", ep.Number)
+	}
+}
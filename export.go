@@ -0,0 +1,631 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// exportVersion is bumped whenever the export format changes in a way older
+// versions of anigarden can't read, version 2 added sync and watched
+const exportVersion = 2
+
+// sqlite stores CURRENT_TIMESTAMP in this layout, imported times are written the same way
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// export is the documented json format of anigarden data:
+//
+//	{
+//	  "version": 2,
+//	  "exported_at": "2025-01-01T12:00:00Z",
+//	  "lists": ["Watchlist", "Friday night group watch"],
+//	  "entries": [{
+//	    "anime_id": "one-piece-100",
+//	    "status": "watching",       // watching, completed, on_hold, dropped or plan_to_watch
+//	    "score": 9,                 // 1-10, 0 when not scored
+//	    "notes": "",
+//	    "rewatches": 0,
+//	    "tags": ["comfy"],
+//	    "lists": ["Watchlist"],     // names of the lists the entry is in
+//	    "added_at": "2025-01-01T12:00:00Z",
+//	    "sync": true                // false when it isn't pushed to the trackers
+//	  }],
+//	  "history": [{
+//	    "anime_id": "one-piece-100",
+//	    "episode_id": "one-piece-100?ep=2142",
+//	    "episode_number": 1,
+//	    "watched_at": "2025-01-01T12:00:00Z",
+//	    "watched": true             // false when the player closed before the episode counted as watched
+//	  }]
+//	}
+//
+// the csv format has one row per entry or history item, told apart by the kind column:
+//
+//	kind,anime_id,status,score,notes,rewatches,tags,lists,added_at,episode_id,episode_number,watched_at,sync,watched
+//
+// exports of version 1 have neither sync nor watched, their entries are synced and their history watched.
+// tags and lists are separated by semicolons and times use RFC 3339
+type export struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Lists      []string        `json:"lists"`
+	Entries    []exportEntry   `json:"entries"`
+	History    []exportHistory `json:"history"`
+}
+
+type exportEntry struct {
+	AnimeID   string      `json:"anime_id"`
+	Status    watchStatus `json:"status"`
+	Score     int         `json:"score"`
+	Notes     string      `json:"notes"`
+	Rewatches int         `json:"rewatches"`
+	Tags      []string    `json:"tags"`
+	Lists     []string    `json:"lists"`
+	AddedAt   time.Time   `json:"added_at"`
+	Sync      bool        `json:"sync"`
+}
+
+type exportHistory struct {
+	AnimeID       string    `json:"anime_id"`
+	EpisodeID     string    `json:"episode_id"`
+	EpisodeNumber int       `json:"episode_number"`
+	WatchedAt     time.Time `json:"watched_at"`
+	Watched       bool      `json:"watched"`
+}
+
+var csvHeader = []string{"kind", "anime_id", "status", "score", "notes", "rewatches", "tags", "lists", "added_at", "episode_id", "episode_number", "watched_at", "sync", "watched"}
+
+// csvHeaderV1 is the header of version 1 csv exports, from before sync and watched
+var csvHeaderV1 = csvHeader[:12]
+
+type importMode string
+
+const (
+	importMerge   importMode = "merge"
+	importReplace importMode = "replace"
+)
+
+// importReport counts what an import changed, or would change on a dry run
+type importReport struct {
+	entriesAdded   int
+	entriesUpdated int
+	listsCreated   int
+	historyAdded   int
+	dryRun         bool
+}
+
+func (r importReport) String() string {
+	verb := "imported"
+	if r.dryRun {
+		verb = "would import"
+	}
+	return fmt.Sprintf("%s %d new and %d updated entries, %d new lists and %d history items",
+		verb, r.entriesAdded, r.entriesUpdated, r.listsCreated, r.historyAdded)
+}
+
+// formatFromPath guesses the export format from a file extension, json is the default
+func formatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return "csv"
+	}
+	return "json"
+}
+
+func parseSqliteTime(value string) time.Time {
+	for _, layout := range []string{sqliteTimeLayout, time.RFC3339Nano} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// loadExport reads everything that is exported from the database
+func loadExport() (export, error) {
+	data := export{Version: exportVersion, ExportedAt: time.Now().UTC(), Entries: []exportEntry{}, History: []exportHistory{}}
+
+	lists, err := getLists()
+	if err != nil {
+		return data, err
+	}
+	listNames := make(map[int]string)
+	for _, l := range lists {
+		data.Lists = append(data.Lists, l.name)
+		listNames[l.id] = l.name
+	}
+
+	// watchlistColumns carries the sync state too, the export only needs what it writes
+	rows, err := db.Query(`
+	SELECT w.anime_id, w.status, w.score, w.notes, w.rewatches,
+		COALESCE((SELECT GROUP_CONCAT(t.tag, ',') FROM tags t WHERE t.anime_id = w.anime_id), ''), w.added_at, w.sync
+	FROM watchlist w ORDER BY w.added_at
+	`)
+	if err != nil {
+		return data, &storageError{"export watchlist", err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry exportEntry
+		var tags, addedAt string
+		if err := rows.Scan(&entry.AnimeID, &entry.Status, &entry.Score, &entry.Notes, &entry.Rewatches, &tags, &addedAt, &entry.Sync); err != nil {
+			return data, &storageError{"export watchlist", err}
+		}
+		entry.Tags = parseTags(tags)
+		entry.AddedAt = parseSqliteTime(addedAt)
+		data.Entries = append(data.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return data, &storageError{"export watchlist", err}
+	}
+
+	itemRows, err := db.Query(`SELECT list_id, anime_id FROM list_items ORDER BY list_id`)
+	if err != nil {
+		return data, &storageError{"export lists", err}
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var listId int
+		var animeId string
+		if err := itemRows.Scan(&listId, &animeId); err != nil {
+			return data, &storageError{"export lists", err}
+		}
+		for i := range data.Entries {
+			if data.Entries[i].AnimeID == animeId {
+				data.Entries[i].Lists = append(data.Entries[i].Lists, listNames[listId])
+			}
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		return data, &storageError{"export lists", err}
+	}
+
+	historyRows, err := db.Query(`SELECT anime_id, episode_id, episode_number, watched_at, watched FROM history ORDER BY watched_at`)
+	if err != nil {
+		return data, &storageError{"export history", err}
+	}
+	defer historyRows.Close()
+
+	for historyRows.Next() {
+		var h exportHistory
+		var watchedAt string
+		if err := historyRows.Scan(&h.AnimeID, &h.EpisodeID, &h.EpisodeNumber, &watchedAt, &h.Watched); err != nil {
+			return data, &storageError{"export history", err}
+		}
+		h.WatchedAt = parseSqliteTime(watchedAt)
+		data.History = append(data.History, h)
+	}
+	if err := historyRows.Err(); err != nil {
+		return data, &storageError{"export history", err}
+	}
+
+	return data, nil
+}
+
+func writeExport(w io.Writer, data export, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, e := range data.Entries {
+			record := []string{"entry", e.AnimeID, string(e.Status), strconv.Itoa(e.Score), e.Notes, strconv.Itoa(e.Rewatches),
+				strings.Join(e.Tags, ";"), strings.Join(e.Lists, ";"), e.AddedAt.Format(time.RFC3339), "", "", "", strconv.FormatBool(e.Sync), ""}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		for _, h := range data.History {
+			record := []string{"history", h.AnimeID, "", "", "", "", "", "", "", h.EpisodeID, strconv.Itoa(h.EpisodeNumber), h.WatchedAt.Format(time.RFC3339),
+				"", strconv.FormatBool(h.Watched)}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+
+	default:
+		return fmt.Errorf("unknown export format %q, expected json or csv", format)
+	}
+}
+
+func readExport(r io.Reader, format string) (export, error) {
+	var data export
+
+	switch format {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&data); err != nil {
+			return data, fmt.Errorf("failed to read json export: %w", err)
+		}
+		if data.Version > exportVersion {
+			return data, fmt.Errorf("export version %d is newer than this anigarden supports (%d)", data.Version, exportVersion)
+		}
+
+	case "csv":
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return data, fmt.Errorf("failed to read csv export: %w", err)
+		}
+		if len(records) == 0 || (!slices.Equal(records[0], csvHeader) && !slices.Equal(records[0], csvHeaderV1)) {
+			return data, errors.New("csv export is missing the anigarden header row")
+		}
+
+		data.Version = exportVersion
+		if len(records[0]) == len(csvHeaderV1) {
+			data.Version = 1
+		}
+		for i, record := range records[1:] {
+			line := i + 2
+			switch record[0] {
+			case "entry":
+				score, err := strconv.Atoi(record[3])
+				if err != nil {
+					return data, fmt.Errorf("line %d: invalid score %q", line, record[3])
+				}
+				rewatches, err := strconv.Atoi(record[5])
+				if err != nil {
+					return data, fmt.Errorf("line %d: invalid rewatches %q", line, record[5])
+				}
+				addedAt, _ := time.Parse(time.RFC3339, record[8])
+				sync, err := csvBool(record, 12)
+				if err != nil {
+					return data, fmt.Errorf("line %d: invalid sync %q", line, record[12])
+				}
+				data.Entries = append(data.Entries, exportEntry{
+					AnimeID:   record[1],
+					Status:    watchStatus(record[2]),
+					Score:     score,
+					Notes:     record[4],
+					Rewatches: rewatches,
+					Tags:      splitField(record[6]),
+					Lists:     splitField(record[7]),
+					AddedAt:   addedAt,
+					Sync:      sync,
+				})
+
+			case "history":
+				number, err := strconv.Atoi(record[10])
+				if err != nil {
+					return data, fmt.Errorf("line %d: invalid episode number %q", line, record[10])
+				}
+				watchedAt, _ := time.Parse(time.RFC3339, record[11])
+				watched, err := csvBool(record, 13)
+				if err != nil {
+					return data, fmt.Errorf("line %d: invalid watched %q", line, record[13])
+				}
+				data.History = append(data.History, exportHistory{
+					AnimeID:       record[1],
+					EpisodeID:     record[9],
+					EpisodeNumber: number,
+					WatchedAt:     watchedAt,
+					Watched:       watched,
+				})
+
+			default:
+				return data, fmt.Errorf("line %d: unknown kind %q", line, record[0])
+			}
+		}
+
+	default:
+		return data, fmt.Errorf("unknown import format %q, expected json or csv", format)
+	}
+
+	if data.Version < 2 {
+		upgradeExport(&data)
+	}
+	return data, validateExport(data)
+}
+
+// upgradeExport fills in what version 1 exports didn't have, their entries
+// were all synced and only watched episodes made it into the history
+func upgradeExport(data *export) {
+	for i := range data.Entries {
+		data.Entries[i].Sync = true
+	}
+	for i := range data.History {
+		data.History[i].Watched = true
+	}
+}
+
+func splitField(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ";")
+}
+
+// csvBool reads the true or false in column i, version 1 rows end before it
+func csvBool(record []string, i int) (bool, error) {
+	if i >= len(record) {
+		return false, nil
+	}
+	return strconv.ParseBool(record[i])
+}
+
+func validateExport(data export) error {
+	for _, e := range data.Entries {
+		if e.AnimeID == "" {
+			return errors.New("entry without an anime_id")
+		}
+		if !slices.Contains(watchStatuses, e.Status) {
+			return fmt.Errorf("%s has unknown status %q", e.AnimeID, e.Status)
+		}
+		if e.Score < 0 || e.Score > 10 {
+			return fmt.Errorf("%s has score %d, expected 0-10", e.AnimeID, e.Score)
+		}
+	}
+	for _, h := range data.History {
+		if h.AnimeID == "" || h.EpisodeID == "" {
+			return errors.New("history item without an anime_id or episode_id")
+		}
+	}
+	return nil
+}
+
+// importData writes an export into the database, everything happens in one
+// transaction which is rolled back on a dry run
+func importData(data export, mode importMode, dryRun bool) (importReport, error) {
+	report := importReport{dryRun: dryRun}
+
+	if mode != importMerge && mode != importReplace {
+		return report, fmt.Errorf("unknown import mode %q, expected merge or replace", mode)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, &storageError{"start import", err}
+	}
+	defer tx.Rollback()
+
+	if mode == importReplace {
+		for _, query := range []string{
+			`DELETE FROM list_items`,
+			`DELETE FROM lists WHERE id != ` + strconv.Itoa(defaultListId),
+			`DELETE FROM tags`,
+			`DELETE FROM history`,
+			`DELETE FROM sync_queue`,
+			`DELETE FROM watchlist`,
+		} {
+			if _, err := tx.Exec(query); err != nil {
+				return report, &storageError{"clear database", err}
+			}
+		}
+	}
+
+	listIds := make(map[string]int)
+	ensureList := func(name string) (int, error) {
+		if id, ok := listIds[name]; ok {
+			return id, nil
+		}
+		var id int
+		err := tx.QueryRow(`SELECT id FROM lists WHERE name = ?`, name).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			res, err := tx.Exec(`INSERT INTO lists (name) VALUES (?)`, name)
+			if err != nil {
+				return 0, err
+			}
+			newId, err := res.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+			id = int(newId)
+			report.listsCreated++
+		} else if err != nil {
+			return 0, err
+		}
+		listIds[name] = id
+		return id, nil
+	}
+
+	for _, name := range data.Lists {
+		if _, err := ensureList(name); err != nil {
+			return report, &storageError{"import list " + name, err}
+		}
+	}
+
+	for _, e := range data.Entries {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM watchlist WHERE anime_id = ?)`, e.AnimeID).Scan(&exists); err != nil {
+			return report, &storageError{"import " + e.AnimeID, err}
+		}
+
+		addedAt := e.AddedAt
+		if addedAt.IsZero() {
+			addedAt = time.Now()
+		}
+
+		switch {
+		// merging keeps the local values the export leaves empty or 0, every entry has a status
+		case exists && mode == importMerge:
+			_, err = tx.Exec(`
+			UPDATE watchlist SET
+				status = ?,
+				score = COALESCE(NULLIF(?, 0), score),
+				notes = COALESCE(NULLIF(?, ''), notes),
+				rewatches = COALESCE(NULLIF(?, 0), rewatches),
+				sync = ?
+			WHERE anime_id = ?
+			`, e.Status, e.Score, e.Notes, e.Rewatches, e.Sync, e.AnimeID)
+			report.entriesUpdated++
+		case exists:
+			_, err = tx.Exec(`UPDATE watchlist SET status = ?, score = ?, notes = ?, rewatches = ?, sync = ? WHERE anime_id = ?`,
+				e.Status, e.Score, e.Notes, e.Rewatches, e.Sync, e.AnimeID)
+			report.entriesUpdated++
+		default:
+			_, err = tx.Exec(`INSERT INTO watchlist (anime_id, status, score, notes, rewatches, added_at, sync) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				e.AnimeID, e.Status, e.Score, e.Notes, e.Rewatches, addedAt.UTC().Format(sqliteTimeLayout), e.Sync)
+			report.entriesAdded++
+		}
+		if err != nil {
+			return report, &storageError{"import " + e.AnimeID, err}
+		}
+
+		for _, tag := range e.Tags {
+			if _, err := tx.Exec(`INSERT OR IGNORE INTO tags (anime_id, tag) VALUES (?, ?)`, e.AnimeID, tag); err != nil {
+				return report, &storageError{"import tags of " + e.AnimeID, err}
+			}
+		}
+
+		// entries that aren't in any list still belong in the watchlist
+		lists := e.Lists
+		if len(lists) == 0 {
+			lists = []string{"Watchlist"}
+		}
+		for _, name := range lists {
+			id, err := ensureList(name)
+			if err != nil {
+				return report, &storageError{"import list " + name, err}
+			}
+			_, err = tx.Exec(`INSERT OR IGNORE INTO list_items (list_id, anime_id, added_at) VALUES (?, ?, ?)`,
+				id, e.AnimeID, addedAt.UTC().Format(sqliteTimeLayout))
+			if err != nil {
+				return report, &storageError{"import " + e.AnimeID + " into " + name, err}
+			}
+		}
+	}
+
+	for _, h := range data.History {
+		watchedAt := h.WatchedAt.UTC().Format(sqliteTimeLayout)
+
+		// without a time we can only tell whether the episode was watched before
+		var exists bool
+		var err error
+		if h.WatchedAt.IsZero() {
+			watchedAt = time.Now().UTC().Format(sqliteTimeLayout)
+			err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM history WHERE anime_id = ? AND episode_id = ?)`,
+				h.AnimeID, h.EpisodeID).Scan(&exists)
+		} else {
+			err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM history WHERE anime_id = ? AND episode_id = ? AND watched_at = ?)`,
+				h.AnimeID, h.EpisodeID, watchedAt).Scan(&exists)
+		}
+		if err != nil {
+			return report, &storageError{"import history", err}
+		}
+		if exists {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO history (anime_id, episode_id, episode_number, watched_at, watched) VALUES (?, ?, ?, ?, ?)`,
+			h.AnimeID, h.EpisodeID, h.EpisodeNumber, watchedAt, h.Watched)
+		if err != nil {
+			return report, &storageError{"import history", err}
+		}
+		report.historyAdded++
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, &storageError{"finish import", err}
+	}
+	return report, nil
+}
+
+func exportToFile(path string) error {
+	data, err := loadExport()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := writeExport(file, data, formatFromPath(path)); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func importFromFile(path string, mode importMode, dryRun bool) (importReport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return importReport{}, err
+	}
+	defer file.Close()
+
+	data, err := readExport(file, formatFromPath(path))
+	if err != nil {
+		return importReport{}, err
+	}
+
+	return importData(data, mode, dryRun)
+}
+
+// defaultExportPath is where exports made from inside the tui end up
+func defaultExportPath() (string, error) {
+	dir, err := getDataDir()
+	if err != nil {
+		return "", err
+	}
+
+	exportDir := filepath.Join(dir, "exports")
+	if err := os.MkdirAll(exportDir, 0775); err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("anigarden-%s.json", time.Now().Format("2006-01-02-150405"))
+	return filepath.Join(exportDir, name), nil
+}
+
+// exportWatchlist exports everything to a new file in the exports directory
+func exportWatchlist() tea.Msg {
+	path, err := defaultExportPath()
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	if err := exportToFile(path); err != nil {
+		return noticeMsg{err: err}
+	}
+	return noticeMsg{text: "exported to " + path}
+}
+
+// importWatchlist merges an export file into the database
+func importWatchlist(path string) tea.Msg {
+	report, err := importFromFile(expandHome(path), importMerge, false)
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return importedMsg{report: report}
+}
+
+// importedMsg reports a finished import, unmatched counts anime of another service that couldn't be found
+type importedMsg struct {
+	report    importReport
+	unmatched int
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
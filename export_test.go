@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleExport() export {
+	added := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	return export{
+		Version: exportVersion,
+		Lists:   []string{"Watchlist", "Friday night"},
+		Entries: []exportEntry{
+			{AnimeID: "one-piece-100", Status: statusWatching, Score: 9, Notes: "going, strong", Rewatches: 1,
+				Tags: []string{"comfy"}, Lists: []string{"Watchlist", "Friday night"}, AddedAt: added, Sync: true},
+			// opted out of syncing
+			{AnimeID: "frieren-18542", Status: statusPlanToWatch, Tags: []string{"fantasy"}, Lists: []string{"Watchlist"},
+				AddedAt: added.Add(time.Hour)},
+		},
+		History: []exportHistory{
+			{AnimeID: "one-piece-100", EpisodeID: "one-piece-100?ep=2142", EpisodeNumber: 1, WatchedAt: added.Add(2 * time.Hour), Watched: true},
+			// closed before it counted as watched
+			{AnimeID: "one-piece-100", EpisodeID: "one-piece-100?ep=2143", EpisodeNumber: 2, WatchedAt: added.Add(3 * time.Hour)},
+		},
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			useTestDB(t)
+			want := sampleExport()
+
+			var buf bytes.Buffer
+			if err := writeExport(&buf, want, format); err != nil {
+				t.Fatal(err)
+			}
+			read, err := readExport(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(read.Entries, want.Entries) || !reflect.DeepEqual(read.History, want.History) {
+				t.Fatalf("read back\n%+v\nwant\n%+v", read, want)
+			}
+
+			report, err := importData(read, importMerge, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.entriesAdded != 2 || report.listsCreated != 1 || report.historyAdded != 2 {
+				t.Errorf("report = %+v", report)
+			}
+
+			loaded, err := loadExport()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(loaded.Entries, want.Entries) || !reflect.DeepEqual(loaded.History, want.History) {
+				t.Errorf("loaded\n%+v\nwant\n%+v", loaded, want)
+			}
+		})
+	}
+}
+
+func TestReadExportErrors(t *testing.T) {
+	header := strings.Join(csvHeader, ",") + "\n"
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"newer version", "json", `{"version": 99}`},
+		{"unknown status", "json", `{"version": 1, "entries": [{"anime_id": "a", "status": "binging"}]}`},
+		{"score out of range", "json", `{"version": 1, "entries": [{"anime_id": "a", "status": "watching", "score": 11}]}`},
+		{"entry without id", "json", `{"version": 1, "entries": [{"status": "watching"}]}`},
+		{"history without episode", "json", `{"version": 1, "history": [{"anime_id": "a"}]}`},
+		{"csv without header", "csv", "entry,a,watching,0,,0,,,,,,,true,\n"},
+		{"csv unknown kind", "csv", header + "rating,a,watching,0,,0,,,,,,,true,\n"},
+		{"csv bad score", "csv", header + "entry,a,watching,ten,,0,,,,,,,true,\n"},
+		{"csv bad watched", "csv", header + "history,a,,,,,,,,a?ep=1,1,,,maybe\n"},
+		{"unknown format", "xml", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readExport(strings.NewReader(tt.input), tt.format); err == nil {
+				t.Error("read without an error")
+			}
+		})
+	}
+}
+
+func TestImportModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      importMode
+		incoming  exportEntry
+		want      watchlistEntry
+		wantOther bool // whether the anime left out of the import is still there
+	}{
+		{
+			name:      "merge takes what the import sets",
+			mode:      importMerge,
+			incoming:  exportEntry{AnimeID: "one-piece-100", Status: statusDropped, Score: 3, Notes: "meh", Rewatches: 4},
+			want:      watchlistEntry{status: statusDropped, score: 3, notes: "meh", rewatches: 4},
+			wantOther: true,
+		},
+		{
+			name:      "merge keeps what the import leaves empty",
+			mode:      importMerge,
+			incoming:  exportEntry{AnimeID: "one-piece-100", Status: statusCompleted},
+			want:      watchlistEntry{status: statusCompleted, score: 8, notes: "local", rewatches: 2},
+			wantOther: true,
+		},
+		{
+			name:     "replace overwrites everything",
+			mode:     importReplace,
+			incoming: exportEntry{AnimeID: "one-piece-100", Status: statusCompleted},
+			want:     watchlistEntry{status: statusCompleted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			local := export{Entries: []exportEntry{
+				{AnimeID: "one-piece-100", Status: statusWatching, Score: 8, Notes: "local", Rewatches: 2},
+				{AnimeID: "frieren-18542", Status: statusPlanToWatch},
+			}}
+			if _, err := importData(local, importMerge, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := importData(export{Entries: []exportEntry{tt.incoming}}, tt.mode, false); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := getWatchlistEntry("one-piece-100")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.status != tt.want.status || got.score != tt.want.score || got.notes != tt.want.notes || got.rewatches != tt.want.rewatches {
+				t.Errorf("got %s, %d, %q, %d, want %s, %d, %q, %d", got.status, got.score, got.notes, got.rewatches,
+					tt.want.status, tt.want.score, tt.want.notes, tt.want.rewatches)
+			}
+			if _, err := getWatchlistEntry("frieren-18542"); (err == nil) != tt.wantOther {
+				t.Errorf("anime left out of the import = %v, want kept %v", err, tt.wantOther)
+			}
+		})
+	}
+}
+
+func TestImportReplaceClearsSyncQueue(t *testing.T) {
+	useTestDB(t)
+	var requests []malRequest
+	useMalStub(t, time.Now().Add(time.Hour), malOK, &requests)
+	addSyncedAnime(t, "21")
+	if err := queueSync("one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := getSyncQueue(); err != nil || len(jobs) != 1 {
+		t.Fatalf("queue = %+v, %v, want one job", jobs, err)
+	}
+
+	// the queued update is of the watchlist that was replaced
+	if _, err := importData(sampleExport(), importReplace, false); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := getSyncQueue(); err != nil || len(jobs) != 0 {
+		t.Errorf("queue = %+v, %v, want it cleared", jobs, err)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	useTestDB(t)
+	report, err := importData(sampleExport(), importMerge, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.dryRun || report.entriesAdded != 2 {
+		t.Errorf("report = %+v", report)
+	}
+	entries, err := getWatchlist(defaultListId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("dry run imported %d entries", len(entries))
+	}
+}
+
+func TestReadExportV1(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"json", "json", `{"version": 1,
+			"entries": [{"anime_id": "one-piece-100", "status": "watching"}],
+			"history": [{"anime_id": "one-piece-100", "episode_id": "one-piece-100?ep=2142", "episode_number": 1}]}`},
+		{"csv", "csv", strings.Join(csvHeaderV1, ",") + "\n" +
+			"entry,one-piece-100,watching,0,,0,,,,,,\n" +
+			"history,one-piece-100,,,,,,,,one-piece-100?ep=2142,1,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := readExport(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// version 1 had no sync or watched, everything in it was both
+			if len(data.Entries) != 1 || !data.Entries[0].Sync {
+				t.Errorf("entries = %+v, want one synced", data.Entries)
+			}
+			if len(data.History) != 1 || !data.History[0].Watched {
+				t.Errorf("history = %+v, want one watched episode", data.History)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// streams only play when the referer of the embed page is sent along
+const streamReferer = "https://vidwish.live/"
+
+// defaultQuality is the highest resolution picked when playing with mpv,
+// "auto" leaves the choice to the player
+var defaultQuality = "auto"
+
+// variant is a single rendition listed in an hls master playlist
+type variant struct {
+	URL       string
+	Bandwidth int
+	Width     int
+	Height    int
+}
+
+type qualitiesMsg struct {
+	episode  episode
+	variants []variant
+	subFile  string
+}
+
+// list.item implementation
+func (v variant) Title() string {
+	if v.Height == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dp", v.Height)
+}
+
+func (v variant) Description() string {
+	desc := fmt.Sprintf("%.1f Mbps", float64(v.Bandwidth)/1_000_000)
+	if v.Width != 0 {
+		desc = fmt.Sprintf("%dx%d · %s", v.Width, v.Height, desc)
+	}
+	return desc
+}
+
+func (v variant) FilterValue() string {
+	return v.Title()
+}
+
+// parseQuality turns "720p" or "720" into a max height, 0 means auto
+func parseQuality(quality string) (int, error) {
+	if quality == "" || quality == "auto" {
+		return 0, nil
+	}
+	height, err := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	if err != nil || height <= 0 {
+		return 0, fmt.Errorf("invalid quality %q, expected auto or something like 720p", quality)
+	}
+	return height, nil
+}
+
+func fetchVariants(masterUrl string) ([]variant, error) {
+	req, err := http.NewRequest("GET", masterUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", streamReferer)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch playlist: %s", res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMasterPlaylist(masterUrl, string(body))
+}
+
+// parseMasterPlaylist reads the #EXT-X-STREAM-INF entries of a master playlist,
+// variants are sorted from the highest to the lowest resolution
+func parseMasterPlaylist(masterUrl, playlist string) ([]variant, error) {
+	base, err := neturl.Parse(masterUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	var variants []variant
+	var pending *variant
+
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			v := variant{}
+			for key, value := range parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:")) {
+				switch key {
+				case "BANDWIDTH":
+					v.Bandwidth, _ = strconv.Atoi(value)
+				case "RESOLUTION":
+					w, h, ok := strings.Cut(value, "x")
+					if ok {
+						v.Width, _ = strconv.Atoi(w)
+						v.Height, _ = strconv.Atoi(h)
+					}
+				}
+			}
+			pending = &v
+
+		case strings.HasPrefix(line, "#"):
+			continue
+
+		case pending != nil:
+			// the uri of a variant is the first non tag line after its stream info
+			ref, err := neturl.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			pending.URL = base.ResolveReference(ref).String()
+			variants = append(variants, *pending)
+			pending = nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no variants found in playlist")
+	}
+
+	sort.SliceStable(variants, func(i, j int) bool {
+		if variants[i].Height != variants[j].Height {
+			return variants[i].Height > variants[j].Height
+		}
+		return variants[i].Bandwidth > variants[j].Bandwidth
+	})
+
+	return variants, nil
+}
+
+// parseAttributes splits an hls attribute list, values may be quoted and contain commas
+func parseAttributes(list string) map[string]string {
+	attrs := make(map[string]string)
+	for list != "" {
+		key, rest, ok := strings.Cut(list, "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+
+		attrs[strings.TrimSpace(key)] = value
+		list = rest
+	}
+	return attrs
+}
+
+// pickVariant returns the best variant not taller than maxHeight,
+// falling back to the smallest one when every variant is taller
+func pickVariant(variants []variant, maxHeight int) (variant, bool) {
+	if len(variants) == 0 {
+		return variant{}, false
+	}
+	if maxHeight == 0 {
+		return variants[0], true
+	}
+	for _, v := range variants {
+		if v.Height <= maxHeight {
+			return v, true
+		}
+	}
+	return variants[len(variants)-1], true
+}
+
+// fetchQualities gets the master playlist of an episode and lists its variants
+func fetchQualities(ep episode, lang string) tea.Msg {
+	stream, err := fetchStream(ep.ID, lang)
+	if err != nil {
+		return errMsg{err: err}
+	}
+
+	variants, err := fetchVariants(stream.Data.Sources.Url)
+	if err != nil {
+		return errMsg{err: err}
+	}
+
+	return qualitiesMsg{episode: ep, variants: variants, subFile: stream.subtitle(cfg.SubtitleLang)}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want map[string]string
+	}{
+		{"empty", "", map[string]string{}},
+		{"plain", "BANDWIDTH=800000,RESOLUTION=640x360", map[string]string{"BANDWIDTH": "800000", "RESOLUTION": "640x360"}},
+		{"quoted with commas", `CODECS="avc1.4d401e,mp4a.40.2",BANDWIDTH=1`, map[string]string{"CODECS": "avc1.4d401e,mp4a.40.2", "BANDWIDTH": "1"}},
+		{"unterminated quote", `URI="key.bin`, map[string]string{"URI": "key.bin"}},
+		{"spaces around keys", " BANDWIDTH=1, RESOLUTION=2x3", map[string]string{"BANDWIDTH": "1", "RESOLUTION": "2x3"}},
+		{"no value", "BANDWIDTH", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAttributes(tt.list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAttributes(%q) = %v, want %v", tt.list, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMasterPlaylist(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     []variant
+		wantErr  bool
+	}{
+		{
+			name: "sorted by height then bandwidth",
+			playlist: `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360
+360/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d401f,mp4a.40.2"
+720/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,RESOLUTION=1280x720
+720-low/index.m3u8
+`,
+			want: []variant{
+				{URL: "https://cdn.example/hls/720/index.m3u8", Bandwidth: 2800000, Width: 1280, Height: 720},
+				{URL: "https://cdn.example/hls/720-low/index.m3u8", Bandwidth: 2000000, Width: 1280, Height: 720},
+				{URL: "https://cdn.example/hls/360/index.m3u8", Bandwidth: 800000, Width: 640, Height: 360},
+			},
+		},
+		{
+			name: "absolute uris and tags between stream info and uri",
+			playlist: `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=500000
+#EXT-X-SOMETHING
+
+https://other.example/low.m3u8
+`,
+			want: []variant{{URL: "https://other.example/low.m3u8", Bandwidth: 500000}},
+		},
+		{
+			name:     "media playlist",
+			playlist: "#EXTM3U\n#EXTINF:10,\nsegment0.ts\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMasterPlaylist("https://cdn.example/hls/master.m3u8", tt.playlist)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPickVariant(t *testing.T) {
+	variants := []variant{{Height: 1080}, {Height: 720}, {Height: 360}}
+	tests := []struct {
+		name      string
+		variants  []variant
+		maxHeight int
+		want      int
+		ok        bool
+	}{
+		{"auto takes the best", variants, 0, 1080, true},
+		{"exact match", variants, 720, 720, true},
+		{"below the max", variants, 900, 720, true},
+		{"everything taller", variants, 240, 360, true},
+		{"no variants", nil, 720, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pickVariant(tt.variants, tt.maxHeight)
+			if ok != tt.ok || got.Height != tt.want {
+				t.Errorf("pickVariant(%d) = %dp, %v, want %dp, %v", tt.maxHeight, got.Height, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseQuality(t *testing.T) {
+	tests := []struct {
+		quality string
+		want    int
+		wantErr bool
+	}{
+		{"auto", 0, false},
+		{"", 0, false},
+		{"720p", 720, false},
+		{"1080", 1080, false},
+		{"0p", 0, true},
+		{"hd", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.quality, func(t *testing.T) {
+			got, err := parseQuality(tt.quality)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseQuality(%q) = %d, %v, want %d, wantErr %v", tt.quality, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,21 +1,84 @@
 package main
 
-import "github.com/charmbracelet/bubbles/key"
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+)
 
 type keyMap struct {
+	Quit                key.Binding
+	Back                key.Binding
 	Home                key.Binding
 	Search              key.Binding
 	Focus               key.Binding
 	Info                key.Binding
 	Watchlist           key.Binding
-	AddToWatchlist      key.Binding
+	AddToList           key.Binding
 	RemoveFromWatchlist key.Binding
 	Watch               key.Binding
 	ToggleDub           key.Binding
 	ToggleClient        key.Binding
+	Quality             key.Binding
+	ChangeStatus        key.Binding
+	NextStatusTab       key.Binding
+	PrevStatusTab       key.Binding
+	Sort                key.Binding
+	ScoreUp             key.Binding
+	ScoreDown           key.Binding
+	EditNotes           key.Binding
+	SaveNotes           key.Binding
+	Rewatch             key.Binding
+	NextList            key.Binding
+	PrevList            key.Binding
+	FilterTag           key.Binding
+	EditTags            key.Binding
+	DeleteList          key.Binding
+	Export              key.Binding
+	Import              key.Binding
+	PullAnilist         key.Binding
+	ToggleSync          key.Binding
+	EditMapping         key.Binding
+	ReloadConfig        key.Binding
+	PickTheme           key.Binding
+	SwitchFocus         key.Binding
+	NextRange           key.Binding
+	PrevRange           key.Binding
+	JumpToEpisode       key.Binding
+	NextUnwatched       key.Binding
+	ToggleFiller        key.Binding
+	ToggleRows          key.Binding
+	Retry               key.Binding
+	DismissError        key.Binding
+
+	// keys of the description of the info page while it has focus
+	ScrollUp           key.Binding
+	ScrollDown         key.Binding
+	ScrollPageUp       key.Binding
+	ScrollPageDown     key.Binding
+	ScrollHalfPageUp   key.Binding
+	ScrollHalfPageDown key.Binding
+
+	// keys of text prompts and pickers
+	Confirm key.Binding
+	Cancel  key.Binding
+	Select  key.Binding
 }
 
-var keys = keyMap{
+// defaultKeys are the bindings [keys] in the config starts from
+var defaultKeys = keyMap{
+	Quit: key.NewBinding(
+		key.WithKeys("q", "ctrl+c"),
+		key.WithHelp("q", "quit"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "backspace"),
+		key.WithHelp("esc", "back"),
+	),
 	Home: key.NewBinding(
 		key.WithKeys("h"),
 		key.WithHelp("h", "home"),
@@ -29,23 +92,23 @@ var keys = keyMap{
 		key.WithHelp("t", "focus search bar"),
 	),
 	Info: key.NewBinding(
-		key.WithKeys("space", "enter"),
+		key.WithKeys(" ", "enter"),
 		key.WithHelp("space/enter", "get anime info"),
 	),
 	Watchlist: key.NewBinding(
 		key.WithKeys("w"),
 		key.WithHelp("w", "watchlist"),
 	),
-	AddToWatchlist: key.NewBinding(
+	AddToList: key.NewBinding(
 		key.WithKeys("a"),
-		key.WithHelp("a", "add to watchlist"),
+		key.WithHelp("a", "add to list"),
 	),
 	RemoveFromWatchlist: key.NewBinding(
 		key.WithKeys("r"),
-		key.WithHelp("r", "remove from watchlist"),
+		key.WithHelp("r", "remove from list"),
 	),
 	Watch: key.NewBinding(
-		key.WithKeys("space", "enter"),
+		key.WithKeys(" ", "enter"),
 		key.WithHelp("space/enter", "watch"),
 	),
 	ToggleDub: key.NewBinding(
@@ -56,4 +119,389 @@ var keys = keyMap{
 		key.WithKeys("c"),
 		key.WithHelp("c", "toggle client"),
 	),
+	Quality: key.NewBinding(
+		key.WithKeys("v"),
+		key.WithHelp("v", "pick quality"),
+	),
+	ChangeStatus: key.NewBinding(
+		key.WithKeys("m"),
+		key.WithHelp("m", "change status"),
+	),
+	NextStatusTab: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "next status"),
+	),
+	PrevStatusTab: key.NewBinding(
+		key.WithKeys("shift+tab"),
+		key.WithHelp("shift+tab", "previous status"),
+	),
+	Sort: key.NewBinding(
+		key.WithKeys("o"),
+		key.WithHelp("o", "change sort"),
+	),
+	ScoreUp: key.NewBinding(
+		key.WithKeys("+", "="),
+		key.WithHelp("+", "score up"),
+	),
+	ScoreDown: key.NewBinding(
+		key.WithKeys("-"),
+		key.WithHelp("-", "score down"),
+	),
+	EditNotes: key.NewBinding(
+		key.WithKeys("n"),
+		key.WithHelp("n", "edit notes"),
+	),
+	SaveNotes: key.NewBinding(
+		key.WithKeys("ctrl+s"),
+		key.WithHelp("ctrl+s", "save notes"),
+	),
+	Rewatch: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "count a rewatch"),
+	),
+	NextList: key.NewBinding(
+		key.WithKeys("]"),
+		key.WithHelp("]", "next list"),
+	),
+	PrevList: key.NewBinding(
+		key.WithKeys("["),
+		key.WithHelp("[", "previous list"),
+	),
+	FilterTag: key.NewBinding(
+		key.WithKeys("t"),
+		key.WithHelp("t", "filter by tag"),
+	),
+	EditTags: key.NewBinding(
+		key.WithKeys("#"),
+		key.WithHelp("#", "edit tags"),
+	),
+	DeleteList: key.NewBinding(
+		key.WithKeys("X"),
+		key.WithHelp("X", "delete list"),
+	),
+	Export: key.NewBinding(
+		key.WithKeys("E"),
+		key.WithHelp("E", "export"),
+	),
+	Import: key.NewBinding(
+		key.WithKeys("I"),
+		key.WithHelp("I", "import"),
+	),
+	PullAnilist: key.NewBinding(
+		key.WithKeys("P"),
+		key.WithHelp("P", "pull from anilist"),
+	),
+	ToggleSync: key.NewBinding(
+		key.WithKeys("S"),
+		key.WithHelp("S", "toggle syncing"),
+	),
+	EditMapping: key.NewBinding(
+		key.WithKeys("M"),
+		key.WithHelp("M", "fix tracker ids"),
+	),
+	ReloadConfig: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "reload config"),
+	),
+	PickTheme: key.NewBinding(
+		key.WithKeys("ctrl+t"),
+		key.WithHelp("ctrl+t", "pick theme"),
+	),
+	SwitchFocus: key.NewBinding(
+		key.WithKeys("tab"),
+		key.WithHelp("tab", "switch episodes/ranges/description"),
+	),
+	NextRange: key.NewBinding(
+		key.WithKeys("]"),
+		key.WithHelp("]", "next episode range"),
+	),
+	PrevRange: key.NewBinding(
+		key.WithKeys("["),
+		key.WithHelp("[", "previous episode range"),
+	),
+	JumpToEpisode: key.NewBinding(
+		key.WithKeys(":"),
+		key.WithHelp(":", "jump to episode"),
+	),
+	NextUnwatched: key.NewBinding(
+		key.WithKeys("N"),
+		key.WithHelp("N", "next unwatched episode"),
+	),
+	ToggleFiller: key.NewBinding(
+		key.WithKeys("F"),
+		key.WithHelp("F", "hide/show filler"),
+	),
+	ToggleRows: key.NewBinding(
+		key.WithKeys("z"),
+		key.WithHelp("z", "compact/detailed rows"),
+	),
+	Retry: key.NewBinding(
+		key.WithKeys("y"),
+		key.WithHelp("y", "retry"),
+	),
+	DismissError: key.NewBinding(
+		key.WithKeys("x"),
+		key.WithHelp("x", "dismiss error"),
+	),
+	ScrollUp: key.NewBinding(
+		key.WithKeys("up", "k"),
+		key.WithHelp("↑/k", "scroll up"),
+	),
+	ScrollDown: key.NewBinding(
+		key.WithKeys("down", "j"),
+		key.WithHelp("↓/j", "scroll down"),
+	),
+	ScrollPageUp: key.NewBinding(
+		key.WithKeys("pgup"),
+		key.WithHelp("pgup", "scroll a page up"),
+	),
+	ScrollPageDown: key.NewBinding(
+		key.WithKeys("pgdown"),
+		key.WithHelp("pgdn", "scroll a page down"),
+	),
+	ScrollHalfPageUp: key.NewBinding(
+		key.WithKeys("ctrl+u"),
+		key.WithHelp("ctrl+u", "scroll half a page up"),
+	),
+	ScrollHalfPageDown: key.NewBinding(
+		key.WithKeys("ctrl+d"),
+		key.WithHelp("ctrl+d", "scroll half a page down"),
+	),
+	Confirm: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "confirm"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys(" ", "enter"),
+		key.WithHelp("space/enter", "select"),
+	),
+}
+
+// forceQuit quits from anywhere, even prompts and pickers, like it does in the lists
+var forceQuit = key.NewBinding(key.WithKeys("ctrl+c"))
+
+// keys are the bindings in use, the defaults with the ones of the config on top
+var keys = defaultKeys
+
+// keyScope is where a binding is active. Global bindings work on every page, prompts take
+// every key while they're open and pickers are the small lists opened on top of a page.
+// The description keys work on the info page while the description has focus, the page
+// actions come first
+type keyScope string
+
+const (
+	scopeGlobal      keyScope = "global"
+	scopeHome        keyScope = "home"
+	scopeSearch      keyScope = "search"
+	scopeInfo        keyScope = "info"
+	scopeWatchlist   keyScope = "watchlist"
+	scopeDescription keyScope = "description"
+	scopePrompt      keyScope = "prompt"
+	scopePicker      keyScope = "picker"
+)
+
+// pageScopes are the scopes that share the keys of the global scope
+var pageScopes = []keyScope{scopeGlobal, scopeHome, scopeSearch, scopeInfo, scopeWatchlist, scopeDescription}
+
+// listScopes are the scopes where a list gets the keys no action takes, the description
+// has focus instead of the episodes
+var listScopes = []keyScope{scopeGlobal, scopeHome, scopeSearch, scopeInfo, scopeWatchlist, scopePicker}
+
+// filterScopes are the list scopes that filter, the pickers don't
+var filterScopes = []keyScope{scopeGlobal, scopeHome, scopeSearch, scopeInfo, scopeWatchlist}
+
+type keyAction struct {
+	name    string // name of the action in the config
+	binding *key.Binding
+	scopes  []keyScope
+}
+
+// actions lists the bindings of k by their config names
+func (k *keyMap) actions() []keyAction {
+	global := []keyScope{scopeGlobal}
+	return []keyAction{
+		{"quit", &k.Quit, global},
+		{"back", &k.Back, global},
+		{"home", &k.Home, global},
+		{"search", &k.Search, global},
+		{"watchlist", &k.Watchlist, global},
+		{"reload_config", &k.ReloadConfig, global},
+		{"pick_theme", &k.PickTheme, global},
+		{"retry", &k.Retry, global},
+		{"dismiss_error", &k.DismissError, global},
+		{"focus", &k.Focus, []keyScope{scopeSearch}},
+		{"info", &k.Info, []keyScope{scopeHome, scopeSearch, scopeWatchlist}},
+		{"add_to_list", &k.AddToList, []keyScope{scopeHome, scopeSearch}},
+		{"toggle_rows", &k.ToggleRows, []keyScope{scopeHome, scopeSearch, scopeWatchlist}},
+		{"watch", &k.Watch, []keyScope{scopeInfo}},
+		{"toggle_dub", &k.ToggleDub, []keyScope{scopeInfo}},
+		{"toggle_client", &k.ToggleClient, []keyScope{scopeInfo}},
+		{"quality", &k.Quality, []keyScope{scopeInfo}},
+		{"score_up", &k.ScoreUp, []keyScope{scopeInfo}},
+		{"score_down", &k.ScoreDown, []keyScope{scopeInfo}},
+		{"edit_notes", &k.EditNotes, []keyScope{scopeInfo}},
+		{"rewatch", &k.Rewatch, []keyScope{scopeInfo}},
+		{"edit_mapping", &k.EditMapping, []keyScope{scopeInfo}},
+		{"switch_focus", &k.SwitchFocus, []keyScope{scopeInfo}},
+		{"next_range", &k.NextRange, []keyScope{scopeInfo}},
+		{"prev_range", &k.PrevRange, []keyScope{scopeInfo}},
+		{"jump_to_episode", &k.JumpToEpisode, []keyScope{scopeInfo}},
+		{"next_unwatched", &k.NextUnwatched, []keyScope{scopeInfo}},
+		{"toggle_filler", &k.ToggleFiller, []keyScope{scopeInfo}},
+		{"scroll_up", &k.ScrollUp, []keyScope{scopeDescription}},
+		{"scroll_down", &k.ScrollDown, []keyScope{scopeDescription}},
+		{"scroll_page_up", &k.ScrollPageUp, []keyScope{scopeDescription}},
+		{"scroll_page_down", &k.ScrollPageDown, []keyScope{scopeDescription}},
+		{"scroll_half_page_up", &k.ScrollHalfPageUp, []keyScope{scopeDescription}},
+		{"scroll_half_page_down", &k.ScrollHalfPageDown, []keyScope{scopeDescription}},
+		{"toggle_sync", &k.ToggleSync, []keyScope{scopeInfo, scopeWatchlist}},
+		{"remove_from_list", &k.RemoveFromWatchlist, []keyScope{scopeWatchlist}},
+		{"change_status", &k.ChangeStatus, []keyScope{scopeWatchlist}},
+		{"next_status_tab", &k.NextStatusTab, []keyScope{scopeWatchlist}},
+		{"prev_status_tab", &k.PrevStatusTab, []keyScope{scopeWatchlist}},
+		{"sort", &k.Sort, []keyScope{scopeWatchlist}},
+		{"next_list", &k.NextList, []keyScope{scopeWatchlist}},
+		{"prev_list", &k.PrevList, []keyScope{scopeWatchlist}},
+		{"filter_tag", &k.FilterTag, []keyScope{scopeWatchlist}},
+		{"edit_tags", &k.EditTags, []keyScope{scopeWatchlist}},
+		{"delete_list", &k.DeleteList, []keyScope{scopeWatchlist}},
+		{"export", &k.Export, []keyScope{scopeWatchlist}},
+		{"import", &k.Import, []keyScope{scopeWatchlist}},
+		{"pull_anilist", &k.PullAnilist, []keyScope{scopeWatchlist}},
+		{"confirm", &k.Confirm, []keyScope{scopePrompt}},
+		{"cancel", &k.Cancel, []keyScope{scopePrompt, scopePicker}},
+		{"save_notes", &k.SaveNotes, []keyScope{scopePrompt}},
+		{"select", &k.Select, []keyScope{scopePicker}},
+	}
+}
+
+// listKeyMap is the key map of every list. Its paging keys leave out the h and d of the
+// default ones, h goes home and d toggles the dub before the list sees them
+func listKeyMap() list.KeyMap {
+	k := list.DefaultKeyMap()
+	k.PrevPage = key.NewBinding(
+		key.WithKeys("left", "pgup", "b", "u"),
+		key.WithHelp("←/b/pgup", "prev page"),
+	)
+	k.NextPage = key.NewBinding(
+		key.WithKeys("right", "pgdown", "l", "f"),
+		key.WithHelp("→/l/pgdn", "next page"),
+	)
+	return k
+}
+
+// listKeys are the keys the lists of every page handle themselves, they match listKeyMap
+var listKeys = map[string]string{
+	"/":      "filter",
+	"?":      "help",
+	"up":     "cursor up",
+	"k":      "cursor up",
+	"down":   "cursor down",
+	"j":      "cursor down",
+	"left":   "previous page",
+	"pgup":   "previous page",
+	"b":      "previous page",
+	"u":      "previous page",
+	"right":  "next page",
+	"pgdown": "next page",
+	"l":      "next page",
+	"f":      "next page",
+	"home":   "go to start",
+	"g":      "go to start",
+	"end":    "go to end",
+	"G":      "go to end",
+	"esc":    "clear filter",
+	"ctrl+c": "force quit",
+}
+
+// takesListKey tells whether a binds k away from the lists. quit keeps the force quit of the
+// lists, back leaves esc to the list while a filter is applied (see pageHandlesBack) and esc
+// only clears a filter where the list filters
+func takesListKey(a keyAction, k string) bool {
+	scopes := listScopes
+	switch {
+	case a.name == "quit":
+		return false
+	case k == "esc":
+		if a.name == "back" {
+			return false
+		}
+		scopes = filterScopes
+	}
+	return slices.ContainsFunc(a.scopes, func(s keyScope) bool { return slices.Contains(scopes, s) })
+}
+
+// keyName is how a key is written in the config and the help, space is sent as " "
+func keyName(k string) string {
+	if k == " " {
+		return "space"
+	}
+	return k
+}
+
+// scopesOverlap tells whether two bindings can be active at the same time
+func scopesOverlap(a, b []keyScope) bool {
+	for _, sa := range a {
+		for _, sb := range b {
+			if sa == sb {
+				return true
+			}
+			if (sa == scopeGlobal && slices.Contains(pageScopes, sb)) || (sb == scopeGlobal && slices.Contains(pageScopes, sa)) {
+				return true
+			}
+			if (sa == scopeInfo && sb == scopeDescription) || (sb == scopeInfo && sa == scopeDescription) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// keyMap builds the bindings of the config, the errors list every unknown action and every conflict
+func (c config) keyMap() (keyMap, []string) {
+	k := defaultKeys
+	actions := k.actions()
+
+	var errs []string
+	for name, bound := range c.Keys {
+		i := slices.IndexFunc(actions, func(a keyAction) bool { return a.name == name })
+		if i < 0 {
+			errs = append(errs, fmt.Sprintf("keys.%s is not an action", name))
+			continue
+		}
+		if len(bound) == 0 {
+			errs = append(errs, fmt.Sprintf("keys.%s needs at least one key", name))
+			continue
+		}
+
+		pressed := make([]string, len(bound))
+		for j, b := range bound {
+			pressed[j] = b
+			if b == "space" {
+				pressed[j] = " "
+			}
+		}
+		b := actions[i].binding
+		b.SetKeys(pressed...)
+		b.SetHelp(strings.Join(bound, "/"), b.Help().Desc)
+	}
+
+	for i, a := range actions {
+		for _, bound := range a.binding.Keys() {
+			if what, ok := listKeys[bound]; ok && takesListKey(a, bound) {
+				errs = append(errs, fmt.Sprintf("keys.%s: %s is the %s key of the lists", a.name, keyName(bound), what))
+			}
+			for _, other := range actions[i+1:] {
+				if slices.Contains(other.binding.Keys(), bound) && scopesOverlap(a.scopes, other.scopes) {
+					errs = append(errs, fmt.Sprintf("keys: %s is bound to both %s and %s", keyName(bound), a.name, other.name))
+				}
+			}
+		}
+	}
+	sort.Strings(errs)
+	return k, errs
 }
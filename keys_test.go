@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestKeyMap(t *testing.T) {
+	tests := []struct {
+		name string
+		keys map[string][]string
+		// want are parts of the errors expected, none means the keys are fine
+		want []string
+	}{
+		{"defaults", nil, nil},
+		{"remapped", map[string][]string{"watch": {"p", "space"}, "toggle_dub": {"D"}}, nil},
+		{"unknown action", map[string][]string{"teleport": {"T"}}, []string{"keys.teleport is not an action"}},
+		{"no keys", map[string][]string{"watch": {}}, []string{"keys.watch needs at least one key"}},
+		{"same scope", map[string][]string{"toggle_dub": {"c"}}, []string{"c is bound to both toggle_dub and toggle_client"}},
+		{"global and a page", map[string][]string{"sort": {"w"}}, []string{"w is bound to both watchlist and sort"}},
+		{"list go to start", map[string][]string{"quality": {"g"}}, []string{"keys.quality: g is the go to start key of the lists"}},
+		{"list next page", map[string][]string{"export": {"f"}}, []string{"keys.export: f is the next page key of the lists"}},
+		{"list previous page", map[string][]string{"rewatch": {"u"}}, []string{"keys.rewatch: u is the previous page key of the lists"}},
+		{"list clear filter", map[string][]string{"sort": {"esc"}}, []string{"keys.sort: esc is the clear filter key of the lists", "esc is bound to both back and sort"}},
+		{"description and the info page", map[string][]string{"scroll_down": {"d"}}, []string{"d is bound to both toggle_dub and scroll_down"}},
+		// the description has focus instead of the episode list
+		{"description and the lists", map[string][]string{"scroll_down": {"J"}, "scroll_up": {"g"}}, nil},
+		// the info page and the watchlist are never active together
+		{"separate pages", map[string][]string{"sort": {"d"}}, nil},
+		// prompts take every key, so they may reuse the keys of the lists
+		{"prompts", map[string][]string{"save_notes": {"g"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.Keys = tt.keys
+			_, errs := c.keyMap()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("got errors %q, want %d", errs, len(tt.want))
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(strings.Join(errs, "\n"), want) {
+					t.Errorf("errors %q don't mention %q", errs, want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyMapRemaps(t *testing.T) {
+	c := defaultConfig()
+	c.Keys = map[string][]string{"watch": {"p", "space"}}
+	k, errs := c.keyMap()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if got := k.Watch.Keys(); !reflect.DeepEqual(got, []string{"p", " "}) {
+		t.Errorf("watch keys = %q", got)
+	}
+	if got := k.Watch.Help().Key; got != "p/space" {
+		t.Errorf("watch help = %q", got)
+	}
+	if got := defaultKeys.Watch.Keys(); !reflect.DeepEqual(got, []string{" ", "enter"}) {
+		t.Errorf("remapping changed the default keys to %q", got)
+	}
+}
+
+func TestRemappedKeysDispatch(t *testing.T) {
+	t.Cleanup(func() { keys = defaultKeys })
+	c := defaultConfig()
+	c.Keys = map[string][]string{"sort": {"O"}}
+	applyConfig(c)
+
+	w, _ := initWatchlistModel().Update(watchlistMsg{listId: defaultListId})
+	w, _ = w.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("o")})
+	if w.sort != 0 {
+		t.Errorf("sort = %d, want the old key to do nothing", w.sort)
+	}
+	w, _ = w.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("O")})
+	if w.sort != 1 {
+		t.Errorf("sort = %d, want the remapped key to change the sort", w.sort)
+	}
+}
+
+func TestRemappedScrollKeys(t *testing.T) {
+	t.Cleanup(func() { keys = defaultKeys })
+	c := defaultConfig()
+	c.Keys = map[string][]string{"scroll_down": {"J"}}
+	applyConfig(c)
+
+	long := strings.Repeat("A pirate sets sail.<br>", 100)
+	i := initInfoModel(anime{ID: "one-piece-100", Name: "One Piece", Body: long}, "sub", "mpv", 80, 20)
+	i, _ = i.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyTab})
+	if i.focus != focusDescription {
+		t.Fatalf("focus = %v, want the description", i.focus)
+	}
+
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if i.desc.YOffset != 0 {
+		t.Errorf("description scrolled to %d with the old key", i.desc.YOffset)
+	}
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("J")})
+	if i.desc.YOffset != 1 {
+		t.Errorf("description scrolled to %d, want 1 with the remapped key", i.desc.YOffset)
+	}
+}
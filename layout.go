@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// below this size pages can't be drawn, the too small screen is shown instead
+	minWidth  = 40
+	minHeight = 12
+
+	// the info page stacks its panes below this width
+	stackWidth = 90
+
+	// space between the panes of the info page
+	paneGap = 4
+
+	// width of the range sidebar next to the episodes of long series
+	rangeWidth = 13
+)
+
+// infoLayout is the size of every pane of the info page, computed again on every resize
+type infoLayout struct {
+	stacked bool
+
+	// left pane, the description and everything above it
+	descWidth  int
+	descHeight int
+
+	// right pane, the episode and quality lists
+	listWidth  int
+	listHeight int
+}
+
+// computeInfoLayout splits the window into the info panes. Side by side the description gets
+// 40% of the width, stacked it gets the top 40% of the height and the episodes the rest
+func computeInfoLayout(width, height int) infoLayout {
+	w, v := docStyle.GetFrameSize()
+	width, height = max(width-w, 0), max(height-v, 0)
+
+	// one line under the description shows its scroll position
+	if width < stackWidth {
+		descHeight := height * 2 / 5
+		return infoLayout{
+			stacked:    true,
+			descWidth:  width,
+			descHeight: max(descHeight-1, 1),
+			listWidth:  width,
+			listHeight: max(height-descHeight-1, 1), // a blank line between the panes
+		}
+	}
+
+	descWidth := width * 2 / 5
+	return infoLayout{
+		descWidth:  descWidth,
+		descHeight: max(height-1, 1),
+		listWidth:  width - descWidth - paneGap,
+		listHeight: height,
+	}
+}
+
+func tooSmall(width, height int) bool {
+	return width < minWidth || height < minHeight
+}
+
+// tooSmallView replaces every page while the terminal is smaller than the minimum size
+func tooSmallView(width, height int) string {
+	msg := fmt.Sprintf("terminal too small\n%dx%d, anigarden needs %dx%d", width, height, minWidth, minHeight)
+	return lipgloss.Place(width, height, lipgloss.Center, lipgloss.Center, mutedStyle.Align(lipgloss.Center).Render(msg))
+}
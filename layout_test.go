@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+func TestComputeInfoLayout(t *testing.T) {
+	w, v := docStyle.GetFrameSize()
+	tests := []struct {
+		name          string
+		width, height int
+		want          infoLayout
+	}{
+		{"side by side", 120 + w, 40 + v, infoLayout{descWidth: 48, descHeight: 39, listWidth: 68, listHeight: 40}},
+		{"just wide enough", stackWidth + w, 20 + v, infoLayout{descWidth: 36, descHeight: 19, listWidth: 50, listHeight: 20}},
+		{"stacked", stackWidth - 1 + w, 30 + v, infoLayout{stacked: true, descWidth: 89, descHeight: 11, listWidth: 89, listHeight: 17}},
+		{"smaller than the frame", 1, 1, infoLayout{stacked: true, descHeight: 1, listHeight: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := computeInfoLayout(tt.width, tt.height); got != tt.want {
+				t.Errorf("computeInfoLayout(%d, %d) = %+v, want %+v", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTooSmall(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          bool
+	}{
+		{minWidth, minHeight, false},
+		{minWidth - 1, minHeight, true},
+		{minWidth, minHeight - 1, true},
+		{200, 60, false},
+	}
+	for _, tt := range tests {
+		if got := tooSmall(tt.width, tt.height); got != tt.want {
+			t.Errorf("tooSmall(%d, %d) = %v, want %v", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestInfoViewFits(t *testing.T) {
+	long := strings.Repeat("A pirate sets sail across the grand line.<br>", 40)
+	for _, size := range [][2]int{{120, 40}, {stackWidth - 1, 30}, {minWidth, minHeight}} {
+		width, height := size[0], size[1]
+		t.Run(fmt.Sprintf("%dx%d", width, height), func(t *testing.T) {
+			i := initInfoModel(anime{ID: "one-piece-100", Name: "One Piece", Body: long, Genres: []string{"Action"}}, "sub", "mpv", width, height)
+			i, _ = i.Update(tea.WindowSizeMsg{Width: width, Height: height})
+			view := i.View()
+			if got := lipgloss.Width(view); got > width {
+				t.Errorf("view is %d cells wide, want at most %d", got, width)
+			}
+			if got := lipgloss.Height(view); got > height {
+				t.Errorf("view is %d lines high, want at most %d", got, height)
+			}
+		})
+	}
+}
+
+func TestTooSmallView(t *testing.T) {
+	m := initialModel()
+	next, _ := m.Update(tea.WindowSizeMsg{Width: minWidth - 1, Height: minHeight})
+	if view := next.(model).View(); !strings.Contains(view, "terminal too small") {
+		t.Errorf("view = %q, want the too small screen", view)
+	}
+	next, _ = next.Update(tea.WindowSizeMsg{Width: minWidth, Height: minHeight})
+	if view := next.(model).View(); strings.Contains(view, "terminal too small") {
+		t.Error("the too small screen is still shown at the minimum size")
+	}
+}
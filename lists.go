@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// listPickerMsg opens the picker to choose which list an anime is added to
+type listPickerMsg struct {
+	anime anime
+	lists []animeList
+}
+
+// list.item implementation
+func (l animeList) Title() string {
+	return l.name
+}
+
+func (l animeList) Description() string {
+	return fmt.Sprintf("%d anime", l.count)
+}
+
+func (l animeList) FilterValue() string {
+	return l.name
+}
+
+type newListItem struct{}
+
+func (n newListItem) Title() string {
+	return "+ new list"
+}
+
+func (n newListItem) Description() string {
+	return "create a list and add the anime to it"
+}
+
+func (n newListItem) FilterValue() string {
+	return ""
+}
+
+func fetchListPicker(a anime) tea.Msg {
+	lists, err := getLists()
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return listPickerMsg{a, lists}
+}
+
+func handleOpenListPicker(l list.Model) tea.Cmd {
+	if selected, ok := selectedAnime(l); ok {
+		return func() tea.Msg { return fetchListPicker(selected) }
+	}
+	return nil
+}
+
+func addToList(a anime, l animeList) tea.Msg {
+	err := addAnimeToList(l.id, a.ID)
+	if errors.Is(err, errAlreadyInList) {
+		return noticeMsg{text: a.Name + " is already in " + l.name, warn: true}
+	}
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return noticeMsg{text: "added " + a.Name + " to " + l.name}
+}
+
+func addToNewList(a anime, name string) tea.Msg {
+	id, err := createList(name)
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return addToList(a, animeList{id: id, name: name})
+}
+
+// list picker
+type listPickerModel struct {
+	anime  anime
+	list   list.Model
+	input  textinput.Model
+	naming bool
+	done   bool
+}
+
+func initListPicker(msg listPickerMsg, width, height int) listPickerModel {
+	items := make([]list.Item, 0, len(msg.lists)+1)
+	for _, l := range msg.lists {
+		items = append(items, l)
+	}
+	items = append(items, newListItem{})
+
+	l := newList(items)
+	l.Title = "Add " + msg.anime.Name + " to"
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+
+	w, v := docStyle.GetFrameSize()
+	l.SetSize(width-w, height-v)
+
+	ti := textinput.New()
+	ti.Placeholder = "list name"
+	ti.Width = 30
+
+	return listPickerModel{anime: msg.anime, list: l, input: ti}
+}
+
+func (p listPickerModel) Update(msg tea.Msg) (listPickerModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if p.naming {
+			switch {
+			case key.Matches(msg, keys.Confirm):
+				a, name := p.anime, p.input.Value()
+				p.done = true
+				return p, func() tea.Msg { return addToNewList(a, name) }
+			case key.Matches(msg, keys.Cancel):
+				p.naming = false
+				p.input.Blur()
+				return p, nil
+			}
+
+			var cmd tea.Cmd
+			p.input, cmd = p.input.Update(msg)
+			return p, cmd
+		}
+
+		switch {
+		case key.Matches(msg, keys.Select):
+			switch selected := p.list.SelectedItem().(type) {
+			case animeList:
+				a := p.anime
+				p.done = true
+				return p, func() tea.Msg { return addToList(a, selected) }
+			case newListItem:
+				p.naming = true
+				return p, p.input.Focus()
+			}
+
+		case key.Matches(msg, keys.Cancel, keys.Quit):
+			p.done = true
+			return p, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	return p, cmd
+}
+
+func (p listPickerModel) View() string {
+	if p.naming {
+		return docStyle.Render(fmt.Sprintf("New list for %s\n\n%s\n\nenter to create, esc to go back", p.anime.Name, p.input.View()))
+	}
+	return docStyle.Render(p.list.View())
+}
@@ -1,15 +1,78 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func main() {
-	initDB()
+	flag.StringVar(&configPath, "config", "", "config file to read instead of config.toml in the app dir")
+	flag.StringVar(&defaultQuality, "quality", defaultQuality, "max quality to play with mpv, e.g. 720p or auto")
+	flag.BoolVar(&useProxy, "proxy", useProxy, "serve streams through a local proxy that adds the required headers")
+	flag.StringVar(&playerCmd, "player", playerCmd, "player used by the mpv client, players other than mpv always use the proxy")
+	flag.StringVar(&themeName, "theme", themeName, "colour theme, a built-in one or one defined in the config")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: anigarden [flags] [command]")
+		fmt.Fprintln(flag.CommandLine.Output(), `
+commands:
+  search      search anime
+  info        show the details of an anime
+  episodes    list the episodes of an anime
+  watch       play an episode
+  watchlist   list, add or remove anime of the watchlist and other lists
+  stream-url  print the stream url of an episode
+  export      export watchlist and history as json or csv
+  import      import an export into the watchlist
+  mal         import or export myanimelist xml, log in to scrobble to myanimelist
+  anilist     log in to anilist, pull your list or push queued updates
+  ids         show or fix the tracker ids of an anime
+
+most commands print json with --json, run a command with -h for its flags
+
+flags:`)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) { flagOverrides[f.Name] = true })
+
+	// flags come first so -h works with a broken config, applying the config leaves them alone
+	c, err := loadConfig()
+	if err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	applyConfig(c)
+
+	if _, err := parseQuality(defaultQuality); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	if err := setTheme(themeName); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+
+	if err := initDB(); err != nil {
+		log.Fatalf("%v\n", err)
+	}
 	defer db.Close()
 
+	if flag.NArg() > 0 {
+		err := runCommand(flag.Args())
+		// os.Exit skips the deferred close
+		db.Close()
+		switch {
+		case errors.Is(err, flag.ErrHelp):
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		case err != nil:
+			log.Fatalf("%v\n", err)
+		}
+		return
+	}
+
 	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		log.Fatalf("failed to run anigarden: %v\n", err)
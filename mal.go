@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// malExport is the xml file myanimelist produces from its export page
+type malExport struct {
+	XMLName xml.Name   `xml:"myanimelist"`
+	MyInfo  malMyInfo  `xml:"myinfo"`
+	Anime   []malAnime `xml:"anime"`
+}
+
+type malMyInfo struct {
+	UserExportType int `xml:"user_export_type"`
+	TotalAnime     int `xml:"user_total_anime"`
+	Watching       int `xml:"user_total_watching"`
+	Completed      int `xml:"user_total_completed"`
+	OnHold         int `xml:"user_total_onhold"`
+	Dropped        int `xml:"user_total_dropped"`
+	PlanToWatch    int `xml:"user_total_plantowatch"`
+}
+
+type malAnime struct {
+	ID              int    `xml:"series_animedb_id"`
+	Title           cdata  `xml:"series_title"`
+	Type            string `xml:"series_type"`
+	Episodes        int    `xml:"series_episodes"`
+	WatchedEpisodes int    `xml:"my_watched_episodes"`
+	StartDate       string `xml:"my_start_date"`
+	FinishDate      string `xml:"my_finish_date"`
+	Score           int    `xml:"my_score"`
+	Status          string `xml:"my_status"`
+	Comments        cdata  `xml:"my_comments"`
+	TimesWatched    int    `xml:"my_times_watched"`
+	Tags            cdata  `xml:"my_tags"`
+	UpdateOnImport  int    `xml:"update_on_import"`
+}
+
+// cdata keeps free text wrapped in CDATA like myanimelist does
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+// malUnmatched is a row of the export that couldn't be matched to a hianime anime
+type malUnmatched struct {
+	malId      int
+	title      string
+	candidates []anime
+}
+
+// minTitleSimilarity is how alike two titles have to be to count as a fuzzy match
+const minTitleSimilarity = 0.85
+
+var malStatuses = map[string]watchStatus{
+	"Watching":      statusWatching,
+	"Completed":     statusCompleted,
+	"On-Hold":       statusOnHold,
+	"Dropped":       statusDropped,
+	"Plan to Watch": statusPlanToWatch,
+}
+
+func malStatus(status watchStatus) string {
+	for name, s := range malStatuses {
+		if s == status {
+			return name
+		}
+	}
+	return "Plan to Watch"
+}
+
+func readMalExport(r io.Reader) (malExport, error) {
+	var mal malExport
+	if err := xml.NewDecoder(r).Decode(&mal); err != nil {
+		return mal, fmt.Errorf("failed to read myanimelist export: %w", err)
+	}
+	return mal, nil
+}
+
+// normalizeTitle lowercases a title and drops everything but letters and digits
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// titleSimilarity is the dice coefficient of the character bigrams of two titles
+func titleSimilarity(a, b string) float64 {
+	a, b = normalizeTitle(a), normalizeTitle(b)
+	if a == b {
+		return 1
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+
+	bigrams := make(map[string]int)
+	ra := []rune(a)
+	for i := 0; i < len(ra)-1; i++ {
+		bigrams[string(ra[i:i+2])]++
+	}
+
+	shared := 0
+	rb := []rune(b)
+	for i := 0; i < len(rb)-1; i++ {
+		bigram := string(rb[i : i+2])
+		if bigrams[bigram] > 0 {
+			bigrams[bigram]--
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(ra)-1+len(rb)-1)
+}
+
+// matchAnime searches hianime for each title in turn and returns the first result whose
+// details satisfy matches, falling back to a result with a similar enough title
+func matchAnime(titles []string, matches func(animeDetails) bool) (anime, bool, error) {
+	var fuzzy []anime
+	for _, title := range titles {
+		if title == "" {
+			continue
+		}
+		results, err := search(title)
+		if err != nil {
+			return anime{}, false, err
+		}
+
+		// details take a request each, the right anime is nearly always among the first results
+		for _, result := range results[:min(len(results), 5)] {
+			details, err := getAnimeDetails(result.ID)
+			if err != nil {
+				return anime{}, false, err
+			}
+			// the details are fetched anyway, remember their ids for the next lookup
+			if _, err := recordDetailsMapping(details); err != nil {
+				return anime{}, false, err
+			}
+			if matches(details) {
+				return result, true, nil
+			}
+		}
+
+		for _, result := range results {
+			if titleSimilarity(title, result.Name) >= minTitleSimilarity {
+				fuzzy = append(fuzzy, result)
+			}
+		}
+	}
+
+	if len(fuzzy) > 0 {
+		return fuzzy[0], true, nil
+	}
+	return anime{}, false, nil
+}
+
+// matchMalAnime finds the hianime anime of a myanimelist row, first in the id mappings,
+// then by comparing myanimelist ids of the search results and then by title
+func matchMalAnime(row malAnime) (anime, bool, error) {
+	animeId, found, err := findAnimeId("myanimelist", row.ID)
+	if err != nil || found {
+		return anime{ID: animeId, Name: row.Title.Text}, found, err
+	}
+	return matchAnime([]string{row.Title.Text}, func(d animeDetails) bool { return d.MalID == row.ID })
+}
+
+// watchedHistory turns a count of watched episodes into history items for the first episodes of an anime
+func watchedHistory(animeId string, watched int, watchedAt time.Time) ([]exportHistory, error) {
+	episodes, err := getEpisodes(animeId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get episodes of %s: %w", animeId, err)
+	}
+	var history []exportHistory
+	for _, ep := range episodes {
+		if ep.Number <= watched {
+			history = append(history, exportHistory{animeId, ep.ID, ep.Number, watchedAt, true})
+		}
+	}
+	return history, nil
+}
+
+// readMalMappings reads a csv of mal_id,hianime_id rows used to resolve unmatched anime by hand,
+// rows without a hianime id are skipped
+func readMalMappings(path string) (map[int]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mappings: %w", err)
+	}
+
+	mappings := make(map[int]string)
+	for i, record := range records {
+		if len(record) < 2 || record[0] == "mal_id" {
+			continue
+		}
+		malId, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("mappings line %d: invalid mal id %q", i+1, record[0])
+		}
+		if id := strings.TrimSpace(record[1]); id != "" {
+			mappings[malId] = id
+		}
+	}
+	return mappings, nil
+}
+
+// writeMalUnmatched writes unmatched rows as a mappings file to fill in and pass back with -map
+func writeMalUnmatched(w io.Writer, unmatched []malUnmatched) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"mal_id", "hianime_id", "title", "candidates"})
+	for _, u := range unmatched {
+		var candidates []string
+		for _, c := range u.candidates {
+			candidates = append(candidates, c.ID)
+		}
+		cw.Write([]string{strconv.Itoa(u.malId), "", u.title, strings.Join(candidates, " ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// convertMalExport matches every row of a myanimelist export and turns the matches into an
+// anigarden export, watched episodes become history items so progress carries over
+func convertMalExport(mal malExport, mappings map[int]string, progress func(done, total int)) (export, []malUnmatched, error) {
+	data := export{Version: exportVersion, ExportedAt: time.Now().UTC()}
+	var unmatched []malUnmatched
+
+	for i, row := range mal.Anime {
+		if progress != nil {
+			progress(i+1, len(mal.Anime))
+		}
+
+		animeId, ok := mappings[row.ID]
+		if !ok {
+			match, found, err := matchMalAnime(row)
+			if err != nil {
+				return data, nil, fmt.Errorf("failed to match %s: %w", row.Title.Text, err)
+			}
+			if !found {
+				candidates, _ := search(row.Title.Text)
+				if len(candidates) > 3 {
+					candidates = candidates[:3]
+				}
+				unmatched = append(unmatched, malUnmatched{row.ID, row.Title.Text, candidates})
+				continue
+			}
+			animeId = match.ID
+		}
+
+		status, ok := malStatuses[row.Status]
+		if !ok {
+			status = statusPlanToWatch
+		}
+
+		entry := exportEntry{
+			AnimeID:   animeId,
+			Status:    status,
+			Score:     row.Score,
+			Notes:     row.Comments.Text,
+			Rewatches: row.TimesWatched,
+			Tags:      parseTags(row.Tags.Text),
+			Lists:     []string{"Watchlist"},
+			Sync:      true,
+		}
+		if start, err := time.Parse("2006-01-02", row.StartDate); err == nil {
+			entry.AddedAt = start
+		}
+		data.Entries = append(data.Entries, entry)
+
+		if row.WatchedEpisodes > 0 {
+			watchedAt := entry.AddedAt
+			if finish, err := time.Parse("2006-01-02", row.FinishDate); err == nil {
+				watchedAt = finish
+			}
+			history, err := watchedHistory(animeId, row.WatchedEpisodes, watchedAt)
+			if err != nil {
+				return data, nil, err
+			}
+			data.History = append(data.History, history...)
+		}
+	}
+
+	return data, unmatched, nil
+}
+
+// buildMalExport turns everything in anigarden into a myanimelist export,
+// anime without a myanimelist id are returned as skipped
+func buildMalExport(data export) (malExport, []string, error) {
+	out := malExport{MyInfo: malMyInfo{UserExportType: 1}}
+	var skipped []string
+
+	// episodes closed before they counted as watched aren't progress
+	watched := make(map[string]int)
+	for _, h := range data.History {
+		if h.Watched {
+			watched[h.AnimeID] = max(watched[h.AnimeID], h.EpisodeNumber)
+		}
+	}
+
+	for _, e := range data.Entries {
+		ids, err := lookupIds(e.AnimeID)
+		if err != nil {
+			return out, nil, fmt.Errorf("failed to look up ids of %s: %w", e.AnimeID, err)
+		}
+		if ids.mal == 0 {
+			skipped = append(skipped, e.AnimeID)
+			continue
+		}
+		details, err := getAnimeDetails(e.AnimeID)
+		if err != nil {
+			return out, nil, fmt.Errorf("failed to get details of %s: %w", e.AnimeID, err)
+		}
+
+		episodes := max(details.Stats.Episodes.Sub, details.Stats.Episodes.Dub)
+		watchedEpisodes := watched[e.AnimeID]
+		if e.Status == statusCompleted && episodes > 0 {
+			watchedEpisodes = episodes
+		}
+
+		out.Anime = append(out.Anime, malAnime{
+			ID:              ids.mal,
+			Title:           cdata{details.Name},
+			Type:            details.Stats.Type,
+			Episodes:        episodes,
+			WatchedEpisodes: watchedEpisodes,
+			StartDate:       "0000-00-00",
+			FinishDate:      "0000-00-00",
+			Score:           e.Score,
+			Status:          malStatus(e.Status),
+			Comments:        cdata{e.Notes},
+			TimesWatched:    e.Rewatches,
+			Tags:            cdata{strings.Join(e.Tags, ", ")},
+			UpdateOnImport:  1,
+		})
+
+		out.MyInfo.TotalAnime++
+		switch e.Status {
+		case statusWatching:
+			out.MyInfo.Watching++
+		case statusCompleted:
+			out.MyInfo.Completed++
+		case statusOnHold:
+			out.MyInfo.OnHold++
+		case statusDropped:
+			out.MyInfo.Dropped++
+		case statusPlanToWatch:
+			out.MyInfo.PlanToWatch++
+		}
+	}
+
+	return out, skipped, nil
+}
+
+func writeMalExport(w io.Writer, mal malExport) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(mal); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// realTransport sends the requests fakeAPI doesn't answer, like those to local stub servers
+var realTransport = http.DefaultTransport
+
+// fakeAPI answers the requests to the hianime api with the data of routes, by path and query
+type fakeAPI map[string]string
+
+func (f fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.String(), url) {
+		return realTransport.RoundTrip(req)
+	}
+	route := strings.TrimPrefix(req.URL.String(), url)
+	data, ok := f[route]
+	status := http.StatusOK
+	if !ok {
+		data, status = "null", http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(`{"data": ` + data + `}`)),
+		Header:     http.Header{},
+		Request:    req,
+	}, nil
+}
+
+// useFakeAPI sends every request of the test to routes instead of the network
+func useFakeAPI(t *testing.T, routes fakeAPI) {
+	t.Helper()
+	old := http.DefaultTransport
+	http.DefaultTransport = routes
+	t.Cleanup(func() { http.DefaultTransport = old })
+}
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Frieren: Beyond Journey's End", "frieren beyond journeys end", 1},
+		{"night", "nacht", 0.25},
+		{"Naruto", "Bleach", 0},
+		{"a", "a", 1},
+		{"a", "ab", 0},
+		{"", "One Piece", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			got := titleSimilarity(tt.a, tt.b)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("titleSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if back := titleSimilarity(tt.b, tt.a); math.Abs(back-got) > 1e-9 {
+				t.Errorf("titleSimilarity isn't symmetric: %v and %v", got, back)
+			}
+		})
+	}
+}
+
+func TestConvertMalExport(t *testing.T) {
+	useTestDB(t)
+	useFakeAPI(t, fakeAPI{
+		"/anime/one-piece-100/episodes": `{"episodes": [
+			{"episodeId": "one-piece-100?ep=1", "number": 1},
+			{"episodeId": "one-piece-100?ep=2", "number": 2},
+			{"episodeId": "one-piece-100?ep=3", "number": 3}]}`,
+		"/search?q=Sousou+no+Frieren":              `{"animes": [{"id": "frieren-18542", "name": "Frieren: Beyond Journey's End"}]}`,
+		"/anime/frieren-18542":                     `{"anime": {"info": {"id": "frieren-18542", "malId": 52991}}}`,
+		"/search?q=Hagane+no+Renkinjutsushi":       `{"animes": [{"id": "fullmetal-alchemist-brotherhood-1", "name": "Hagane no Renkinjutsushi!"}]}`,
+		"/anime/fullmetal-alchemist-brotherhood-1": `{"anime": {"info": {"id": "fullmetal-alchemist-brotherhood-1", "malId": 1}}}`,
+		"/search?q=Nothing+Like+It":                `{"animes": [{"id": "naruto-677", "name": "Naruto"}]}`,
+		"/anime/naruto-677":                        `{"anime": {"info": {"id": "naruto-677", "malId": 20}}}`,
+	})
+
+	mal := malExport{Anime: []malAnime{
+		// mapped by hand, watched episodes become history
+		{ID: 21, Title: cdata{"One Piece"}, Status: "Watching", Score: 9, WatchedEpisodes: 2, Tags: cdata{"Comfy, long"},
+			StartDate: "2024-03-01", Comments: cdata{"peak"}},
+		// the myanimelist id of a search result matches
+		{ID: 52991, Title: cdata{"Sousou no Frieren"}, Status: "On-Hold", TimesWatched: 1},
+		// only the title is close enough
+		{ID: 5114, Title: cdata{"Hagane no Renkinjutsushi"}, Status: "Completed"},
+		// nothing matches
+		{ID: 99999, Title: cdata{"Nothing Like It"}, Status: "Plan to Watch"},
+	}}
+
+	data, unmatched, err := convertMalExport(mal, map[int]string{21: "one-piece-100"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantEntries := []struct {
+		id     string
+		status watchStatus
+	}{
+		{"one-piece-100", statusWatching},
+		{"frieren-18542", statusOnHold},
+		{"fullmetal-alchemist-brotherhood-1", statusCompleted},
+	}
+	if len(data.Entries) != len(wantEntries) {
+		t.Fatalf("got %d entries, want %d", len(data.Entries), len(wantEntries))
+	}
+	for i, want := range wantEntries {
+		if e := data.Entries[i]; e.AnimeID != want.id || e.Status != want.status {
+			t.Errorf("entry %d = %s %s, want %s %s", i, e.AnimeID, e.Status, want.id, want.status)
+		}
+	}
+
+	first := data.Entries[0]
+	if first.Score != 9 || first.Notes != "peak" || !reflect.DeepEqual(first.Tags, []string{"comfy", "long"}) || first.AddedAt.Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("first entry = %+v", first)
+	}
+	if data.Entries[1].Rewatches != 1 {
+		t.Errorf("rewatches = %d, want 1", data.Entries[1].Rewatches)
+	}
+
+	if len(data.History) != 2 || data.History[0].EpisodeNumber != 1 || data.History[1].EpisodeNumber != 2 {
+		t.Errorf("history = %+v", data.History)
+	}
+
+	if len(unmatched) != 1 || unmatched[0].malId != 99999 || len(unmatched[0].candidates) != 1 {
+		t.Errorf("unmatched = %+v", unmatched)
+	}
+}
+
+func TestBuildMalExport(t *testing.T) {
+	useTestDB(t)
+	useFakeAPI(t, fakeAPI{
+		"/anime/one-piece-100": `{"anime": {"info": {"id": "one-piece-100", "name": "One Piece", "malId": 21,
+			"stats": {"type": "TV", "episodes": {"sub": 1100, "dub": 1000}}}}}`,
+		"/anime/frieren-18542": `{"anime": {"info": {"id": "frieren-18542", "name": "Frieren", "malId": 52991,
+			"stats": {"type": "TV", "episodes": {"sub": 28, "dub": 28}}}}}`,
+		"/anime/naruto-677": `{"anime": {"info": {"id": "naruto-677"}}}`,
+	})
+
+	data := export{
+		Entries: []exportEntry{
+			{AnimeID: "one-piece-100", Status: statusWatching},
+			{AnimeID: "frieren-18542", Status: statusCompleted},
+			{AnimeID: "naruto-677", Status: statusDropped},
+		},
+		History: []exportHistory{
+			{AnimeID: "one-piece-100", EpisodeID: "one-piece-100?ep=1", EpisodeNumber: 1, Watched: true},
+			{AnimeID: "one-piece-100", EpisodeID: "one-piece-100?ep=2", EpisodeNumber: 2, Watched: true},
+			// closed before it counted as watched
+			{AnimeID: "one-piece-100", EpisodeID: "one-piece-100?ep=3", EpisodeNumber: 3},
+		},
+	}
+	out, skipped, err := buildMalExport(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]int{21: 2, 52991: 28}
+	got := make(map[int]int)
+	for _, a := range out.Anime {
+		got[a.ID] = a.WatchedEpisodes
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("watched episodes by myanimelist id = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(skipped, []string{"naruto-677"}) {
+		t.Errorf("skipped = %v, want the anime without a myanimelist id", skipped)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMalAPIURL   = "https://api.myanimelist.net/v2"
+	defaultMalAuthURL  = "https://myanimelist.net/v1/oauth2"
+	defaultMalRedirect = "http://localhost:8976/callback"
+)
+
+// malAPIURL and malAuthURL can be pointed at a local stub server with
+// ANIGARDEN_MAL_URL and ANIGARDEN_MAL_AUTH_URL
+func malAPIURL() string {
+	if u := os.Getenv("ANIGARDEN_MAL_URL"); u != "" {
+		return u
+	}
+	return defaultMalAPIURL
+}
+
+func malAuthURL() string {
+	if u := os.Getenv("ANIGARDEN_MAL_AUTH_URL"); u != "" {
+		return u
+	}
+	return defaultMalAuthURL
+}
+
+var errMalLoggedOut = errors.New("not logged in to myanimelist, run anigarden mal login")
+
+type malCredentials struct {
+	ClientID     string    `json:"client_id"`
+	RedirectURI  string    `json:"redirect_uri"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type malTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+func loadMalCredentials() (malCredentials, error) {
+	var creds malCredentials
+	err := loadCredentials("myanimelist", &creds)
+	if os.IsNotExist(err) || (err == nil && creds.AccessToken == "") {
+		return creds, errMalLoggedOut
+	}
+	return creds, err
+}
+
+// randomToken returns n random bytes encoded with the characters pkce allows
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// malLoginURL is the page the user authorizes anigarden on, myanimelist only
+// supports the plain challenge method so the challenge is the verifier itself
+func malLoginURL(clientId, redirectURI, verifier, state string) string {
+	q := neturl.Values{
+		"response_type":         {"code"},
+		"client_id":             {clientId},
+		"redirect_uri":          {redirectURI},
+		"code_challenge":        {verifier},
+		"code_challenge_method": {"plain"},
+		"state":                 {state},
+	}
+	return malAuthURL() + "/authorize?" + q.Encode()
+}
+
+// waitForMalCode serves the redirect uri until myanimelist sends the user back with a code
+func waitForMalCode(redirectURI, state string, timeout time.Duration) (string, error) {
+	redirect, err := neturl.Parse(redirectURI)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect uri: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return "", err
+	}
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("error") != "":
+			errs <- fmt.Errorf("myanimelist: %s", q.Get("error"))
+		case q.Get("state") != state:
+			errs <- errors.New("myanimelist sent back an unexpected state")
+		default:
+			codes <- q.Get("code")
+		}
+		fmt.Fprintln(w, "anigarden got the response from myanimelist, you can close this page")
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	select {
+	case code := <-codes:
+		return code, nil
+	case err := <-errs:
+		return "", err
+	case <-time.After(timeout):
+		return "", errors.New("timed out waiting for the myanimelist login")
+	}
+}
+
+func requestMalToken(form neturl.Values) (malTokenResponse, error) {
+	var token malTokenResponse
+
+	res, err := http.PostForm(malAuthURL()+"/token", form)
+	if err != nil {
+		return token, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return token, fmt.Errorf("myanimelist token request failed: %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return token, err
+	}
+	return token, nil
+}
+
+func (c *malCredentials) setToken(token malTokenResponse) {
+	c.AccessToken = token.AccessToken
+	c.RefreshToken = token.RefreshToken
+	c.ExpiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+}
+
+// malLogin runs the pkce flow, printing the login url with show, and stores the tokens
+func malLogin(clientId, redirectURI string, show func(loginURL string)) error {
+	verifier, err := randomToken(64)
+	if err != nil {
+		return err
+	}
+	state, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+
+	show(malLoginURL(clientId, redirectURI, verifier, state))
+
+	code, err := waitForMalCode(redirectURI, state, 5*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	token, err := requestMalToken(neturl.Values{
+		"client_id":     {clientId},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {redirectURI},
+	})
+	if err != nil {
+		return err
+	}
+
+	creds := malCredentials{ClientID: clientId, RedirectURI: redirectURI}
+	creds.setToken(token)
+	return saveCredentials("myanimelist", creds)
+}
+
+func malLogout() error {
+	return removeCredentials("myanimelist")
+}
+
+// refreshMalToken trades the refresh token for a new access token
+func refreshMalToken(creds malCredentials) (malCredentials, error) {
+	token, err := requestMalToken(neturl.Values{
+		"client_id":     {creds.ClientID},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {creds.RefreshToken},
+	})
+	if err != nil {
+		return creds, err
+	}
+	creds.setToken(token)
+	return creds, saveCredentials("myanimelist", creds)
+}
+
+// malService scrobbles watched episodes and status changes to myanimelist
+type malService struct{}
+
+func (malService) name() string {
+	return "myanimelist"
+}
+
+func (malService) enabled() bool {
+	_, err := loadMalCredentials()
+	return err == nil
+}
+
+func (malService) push(entry watchlistEntry, progress int) error {
+	creds, err := loadMalCredentials()
+	if err != nil {
+		return err
+	}
+	if time.Now().After(creds.ExpiresAt.Add(-time.Minute)) {
+		if creds, err = refreshMalToken(creds); err != nil {
+			return err
+		}
+	}
+
+	ids, err := lookupIds(entry.animeId)
+	if err != nil {
+		return err
+	}
+	if ids.mal == 0 {
+		return errNoServiceId
+	}
+
+	// watch statuses use the same names as myanimelist
+	form := neturl.Values{
+		"status":               {string(entry.status)},
+		"num_watched_episodes": {strconv.Itoa(progress)},
+		"num_times_rewatched":  {strconv.Itoa(entry.rewatches)},
+	}
+	// unscored entries leave the score on myanimelist alone
+	if entry.score > 0 {
+		form.Set("score", strconv.Itoa(entry.score))
+	}
+	if entry.status == statusWatching && entry.rewatches > 0 {
+		form.Set("status", string(statusCompleted))
+		form.Set("is_rewatching", "true")
+	}
+
+	res, err := patchMalListStatus(creds.AccessToken, ids.mal, form)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	// the token was revoked or expired early, it's refreshed once before the update fails
+	if res.StatusCode == http.StatusUnauthorized {
+		if creds, err = refreshMalToken(creds); err != nil {
+			return err
+		}
+		if res, err = patchMalListStatus(creds.AccessToken, ids.mal, form); err != nil {
+			return err
+		}
+		res.Body.Close()
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("myanimelist responded with %s", res.Status)
+	}
+	return nil
+}
+
+// patchMalListStatus sends an update of the list status of an anime, closing the body is up to the caller
+func patchMalListStatus(token string, malId int, form neturl.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("%s/anime/%d/my_list_status", malAPIURL(), malId), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mappingSource tells where the tracker ids of an anime came from,
+// manual mappings are overrides and are never replaced by the other sources
+type mappingSource string
+
+const (
+	mappingDetails mappingSource = "details"
+	mappingManual  mappingSource = "manual"
+)
+
+// animeIds are the ids of a hianime anime on the trackers, 0 when unknown
+type animeIds struct {
+	animeId string
+	mal     int
+	anilist int
+	kitsu   int
+	source  mappingSource
+}
+
+// mappingMsg carries the tracker ids of the anime on the info page
+type mappingMsg struct{ ids animeIds }
+
+var errUnknownService = errors.New("unknown service, expected myanimelist, anilist or kitsu")
+
+// serviceColumn is the id_mappings and tracker_ids column holding the ids of a service
+func serviceColumn(service string) (string, error) {
+	switch service {
+	case "myanimelist":
+		return "mal_id", nil
+	case "anilist":
+		return "anilist_id", nil
+	case "kitsu":
+		return "kitsu_id", nil
+	default:
+		return "", errUnknownService
+	}
+}
+
+func (ids animeIds) String() string {
+	var parts []string
+	if ids.mal != 0 {
+		parts = append(parts, fmt.Sprintf("MAL %d", ids.mal))
+	}
+	if ids.anilist != 0 {
+		parts = append(parts, fmt.Sprintf("AniList %d", ids.anilist))
+	}
+	if ids.kitsu != 0 {
+		parts = append(parts, fmt.Sprintf("Kitsu %d", ids.kitsu))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "no tracker ids")
+	}
+	if ids.source == mappingManual {
+		parts = append(parts, "(manual)")
+	}
+	return strings.Join(parts, " · ")
+}
+
+func getMapping(animeId string) (animeIds, bool, error) {
+	ids := animeIds{animeId: animeId}
+	err := db.QueryRow(`SELECT mal_id, anilist_id, kitsu_id, source FROM id_mappings WHERE anime_id = ?`, animeId).
+		Scan(&ids.mal, &ids.anilist, &ids.kitsu, &ids.source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ids, false, nil
+	}
+	if err != nil {
+		return ids, false, &storageError{"get ids of " + animeId, err}
+	}
+	return ids, true, nil
+}
+
+// saveMapping stores the ids of an anime, a manual mapping is only replaced by another manual one
+func saveMapping(ids animeIds) error {
+	_, err := db.Exec(`
+	INSERT INTO id_mappings (anime_id, mal_id, anilist_id, kitsu_id, source) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (anime_id) DO UPDATE SET
+		mal_id = excluded.mal_id, anilist_id = excluded.anilist_id, kitsu_id = excluded.kitsu_id,
+		source = excluded.source, updated_at = CURRENT_TIMESTAMP
+	WHERE id_mappings.source != 'manual' OR excluded.source = 'manual'
+	`, ids.animeId, ids.mal, ids.anilist, ids.kitsu, ids.source)
+	if err != nil {
+		return &storageError{"save ids of " + ids.animeId, err}
+	}
+	return nil
+}
+
+// fillTrackerIds fills in the ids the offline database knows but hianime doesn't
+func fillTrackerIds(ids *animeIds) error {
+	if ids.mal == 0 && ids.anilist == 0 {
+		return nil
+	}
+	var mal, anilist, kitsu int
+	err := db.QueryRow(`
+	SELECT mal_id, anilist_id, kitsu_id FROM tracker_ids
+	WHERE (mal_id != 0 AND mal_id = ?) OR (anilist_id != 0 AND anilist_id = ?)
+	LIMIT 1
+	`, ids.mal, ids.anilist).Scan(&mal, &anilist, &kitsu)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return &storageError{"look up tracker ids", err}
+	}
+	if ids.mal == 0 {
+		ids.mal = mal
+	}
+	if ids.anilist == 0 {
+		ids.anilist = anilist
+	}
+	if ids.kitsu == 0 {
+		ids.kitsu = kitsu
+	}
+	return nil
+}
+
+// recordDetailsMapping remembers the tracker ids found in the details of an anime
+func recordDetailsMapping(details animeDetails) (animeIds, error) {
+	ids := animeIds{animeId: details.ID, mal: details.MalID, anilist: details.AnilistID, source: mappingDetails}
+	if err := fillTrackerIds(&ids); err != nil {
+		return ids, err
+	}
+	return ids, saveMapping(ids)
+}
+
+// lookupIds returns the tracker ids of an anime, fetching its details the first time
+func lookupIds(animeId string) (animeIds, error) {
+	ids, found, err := getMapping(animeId)
+	if err != nil || found {
+		return ids, err
+	}
+
+	details, err := getAnimeDetails(animeId)
+	if err != nil {
+		return ids, err
+	}
+	// the details route answers with an empty anime for ids it doesn't know
+	if details.ID == "" {
+		details.ID = animeId
+	}
+	if _, err := recordDetailsMapping(details); err != nil {
+		return ids, err
+	}
+
+	ids, _, err = getMapping(animeId)
+	return ids, err
+}
+
+// findAnimeId is the reverse lookup, it finds the hianime anime mapped to the id of a service
+func findAnimeId(service string, id int) (string, bool, error) {
+	column, err := serviceColumn(service)
+	if err != nil || id == 0 {
+		return "", false, err
+	}
+
+	var animeId string
+	err = db.QueryRow(`SELECT anime_id FROM id_mappings WHERE `+column+` = ? ORDER BY source = 'manual' DESC LIMIT 1`, id).Scan(&animeId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, &storageError{"find anime by " + service + " id", err}
+	}
+	return animeId, true, nil
+}
+
+func setMappingOverride(ids animeIds) error {
+	ids.source = mappingManual
+	return saveMapping(ids)
+}
+
+// clearMappingOverride forgets the ids of an anime, they are looked up again the next time they're needed
+func clearMappingOverride(animeId string) error {
+	if _, err := db.Exec(`DELETE FROM id_mappings WHERE anime_id = ?`, animeId); err != nil {
+		return &storageError{"clear ids of " + animeId, err}
+	}
+	return nil
+}
+
+// parseMapping reads overrides written as "mal=21 anilist=21 kitsu=12", services left out are unknown
+func parseMapping(animeId, s string) (animeIds, error) {
+	ids := animeIds{animeId: animeId}
+	for _, field := range strings.Fields(s) {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return ids, fmt.Errorf("expected service=id, got %q", field)
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return ids, fmt.Errorf("invalid %s id %q", name, value)
+		}
+		switch name {
+		case "mal":
+			ids.mal = id
+		case "anilist":
+			ids.anilist = id
+		case "kitsu":
+			ids.kitsu = id
+		default:
+			return ids, fmt.Errorf("unknown service %q, expected mal, anilist or kitsu", name)
+		}
+	}
+	return ids, nil
+}
+
+func formatMapping(ids animeIds) string {
+	return fmt.Sprintf("mal=%d anilist=%d kitsu=%d", ids.mal, ids.anilist, ids.kitsu)
+}
+
+// offlineDatabase is the part of the anime-offline-database json we use,
+// every anime lists its pages on the trackers it's known to
+type offlineDatabase struct {
+	Data []struct {
+		Sources []string `json:"sources"`
+	} `json:"data"`
+}
+
+// offlineSourceId returns the id in the first source url starting with one of the prefixes
+func offlineSourceId(sources []string, prefixes ...string) int {
+	for _, source := range sources {
+		for _, prefix := range prefixes {
+			if rest, ok := strings.CutPrefix(source, prefix); ok {
+				if id, err := strconv.Atoi(rest); err == nil {
+					return id
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// importOfflineDatabase replaces the tracker ids with a copy of the anime-offline-database,
+// mappings that aren't overrides are updated with the ids hianime didn't have
+func importOfflineDatabase(r io.Reader) (int, error) {
+	var offline offlineDatabase
+	if err := json.NewDecoder(r).Decode(&offline); err != nil {
+		return 0, fmt.Errorf("failed to read anime-offline-database: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, &storageError{"import tracker ids", err}
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM tracker_ids`); err != nil {
+		return 0, &storageError{"clear tracker ids", err}
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO tracker_ids (mal_id, anilist_id, kitsu_id) VALUES (?, ?, ?)`)
+	if err != nil {
+		return 0, &storageError{"import tracker ids", err}
+	}
+	defer stmt.Close()
+
+	imported := 0
+	for _, entry := range offline.Data {
+		mal := offlineSourceId(entry.Sources, "https://myanimelist.net/anime/")
+		anilist := offlineSourceId(entry.Sources, "https://anilist.co/anime/")
+		kitsu := offlineSourceId(entry.Sources, "https://kitsu.app/anime/", "https://kitsu.io/anime/")
+		if mal == 0 && anilist == 0 {
+			continue
+		}
+		if _, err := stmt.Exec(mal, anilist, kitsu); err != nil {
+			return 0, &storageError{"import tracker ids", err}
+		}
+		imported++
+	}
+
+	_, err = tx.Exec(`
+	UPDATE id_mappings SET
+		kitsu_id = COALESCE((SELECT t.kitsu_id FROM tracker_ids t WHERE t.mal_id != 0 AND t.mal_id = id_mappings.mal_id), kitsu_id),
+		anilist_id = CASE WHEN anilist_id != 0 THEN anilist_id
+			ELSE COALESCE((SELECT t.anilist_id FROM tracker_ids t WHERE t.mal_id != 0 AND t.mal_id = id_mappings.mal_id), 0) END,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE source != 'manual'
+	`)
+	if err != nil {
+		return 0, &storageError{"update id mappings", err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, &storageError{"import tracker ids", err}
+	}
+	return imported, nil
+}
+
+func fetchMapping(animeId string) tea.Msg {
+	ids, err := lookupIds(animeId)
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return mappingMsg{ids}
+}
+
+// handleSaveMapping stores an override typed on the info page, an empty one goes back to the looked up ids
+func handleSaveMapping(animeId, value string) tea.Cmd {
+	return func() tea.Msg {
+		if strings.TrimSpace(value) == "" {
+			if err := clearMappingOverride(animeId); err != nil {
+				return noticeMsg{err: err}
+			}
+			return fetchMapping(animeId)
+		}
+
+		ids, err := parseMapping(animeId, value)
+		if err != nil {
+			return noticeMsg{err: err}
+		}
+		if err := setMappingOverride(ids); err != nil {
+			return noticeMsg{err: err}
+		}
+		// updates that went to the wrong anime are sent again with the fixed ids
+		if err := queueSync(animeId); err != nil {
+			return noticeMsg{err: err}
+		}
+		return fetchMapping(animeId)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    animeIds
+		wantErr bool
+	}{
+		{"every service", "mal=21 anilist=21 kitsu=12", animeIds{animeId: "one-piece-100", mal: 21, anilist: 21, kitsu: 12}, false},
+		{"services left out", "  anilist=101922 ", animeIds{animeId: "one-piece-100", anilist: 101922}, false},
+		{"empty", "", animeIds{animeId: "one-piece-100"}, false},
+		{"zero clears", "mal=0", animeIds{animeId: "one-piece-100"}, false},
+		{"no equals", "mal 21", animeIds{}, true},
+		{"not a number", "mal=abc", animeIds{}, true},
+		{"negative", "kitsu=-1", animeIds{}, true},
+		{"unknown service", "anidb=1", animeIds{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMapping("one-piece-100", tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseMapping(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatMappingRoundTrip(t *testing.T) {
+	ids := animeIds{animeId: "one-piece-100", mal: 21, anilist: 21, kitsu: 12}
+	got, err := parseMapping(ids.animeId, formatMapping(ids))
+	if err != nil || got != ids {
+		t.Errorf("parseMapping(formatMapping(%+v)) = %+v, %v", ids, got, err)
+	}
+}
+
+func TestOfflineSourceId(t *testing.T) {
+	sources := []string{"https://anidb.net/anime/69", "https://myanimelist.net/anime/21", "https://anilist.co/anime/21"}
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     int
+	}{
+		{"found", []string{"https://myanimelist.net/anime/"}, 21},
+		{"any prefix", []string{"https://kitsu.app/anime/", "https://anilist.co/anime/"}, 21},
+		{"missing", []string{"https://kitsu.app/anime/"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offlineSourceId(sources, tt.prefixes...); got != tt.want {
+				t.Errorf("offlineSourceId(%v) = %d, want %d", tt.prefixes, got, tt.want)
+			}
+		})
+	}
+}
+
+// offlineOnePiece is an anime-offline-database with One Piece on every tracker
+const offlineOnePiece = `{"data": [
+	{"sources": ["https://anilist.co/anime/21", "https://kitsu.app/anime/12", "https://myanimelist.net/anime/21"]},
+	{"sources": ["https://anidb.net/anime/69"]}
+]}`
+
+func TestLookupIds(t *testing.T) {
+	useTestDB(t)
+	if n, err := importOfflineDatabase(strings.NewReader(offlineOnePiece)); err != nil || n != 1 {
+		t.Fatalf("imported %d, %v, want the anime without tracker ids left out", n, err)
+	}
+	useFakeAPI(t, fakeAPI{"/anime/one-piece-100": `{"anime": {"info": {"id": "one-piece-100", "malId": 21}}}`})
+
+	want := animeIds{animeId: "one-piece-100", mal: 21, anilist: 21, kitsu: 12, source: mappingDetails}
+	got, err := lookupIds("one-piece-100")
+	if err != nil || got != want {
+		t.Fatalf("lookupIds = %+v, %v, want %+v", got, err, want)
+	}
+
+	// the mapping is stored, so the details aren't fetched again
+	useFakeAPI(t, fakeAPI{})
+	if got, err := lookupIds("one-piece-100"); err != nil || got != want {
+		t.Errorf("second lookupIds = %+v, %v, want %+v", got, err, want)
+	}
+	if id, found, err := findAnimeId("anilist", 21); err != nil || !found || id != "one-piece-100" {
+		t.Errorf("findAnimeId = %q, %v, %v, want one-piece-100", id, found, err)
+	}
+}
+
+func TestMappingOverride(t *testing.T) {
+	useTestDB(t)
+	override := animeIds{animeId: "one-piece-100", mal: 1, source: mappingManual}
+	if err := setMappingOverride(override); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither the details nor the offline database replace an override
+	if _, err := recordDetailsMapping(animeDetails{ID: "one-piece-100", MalID: 21, AnilistID: 21}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importOfflineDatabase(strings.NewReader(offlineOnePiece)); err != nil {
+		t.Fatal(err)
+	}
+	if got, found, err := getMapping("one-piece-100"); err != nil || !found || got != override {
+		t.Errorf("mapping = %+v, %v, %v, want the override %+v", got, found, err, override)
+	}
+
+	if err := clearMappingOverride("one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, err := getMapping("one-piece-100"); err != nil || found {
+		t.Errorf("mapping found = %v, %v, want it forgotten", found, err)
+	}
+}
+
+func TestImportOfflineDatabaseUpdatesMappings(t *testing.T) {
+	useTestDB(t)
+	if _, err := recordDetailsMapping(animeDetails{ID: "one-piece-100", MalID: 21}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importOfflineDatabase(strings.NewReader(offlineOnePiece)); err != nil {
+		t.Fatal(err)
+	}
+	want := animeIds{animeId: "one-piece-100", mal: 21, anilist: 21, kitsu: 12, source: mappingDetails}
+	if got, _, err := getMapping("one-piece-100"); err != nil || got != want {
+		t.Errorf("mapping = %+v, %v, want %+v", got, err, want)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+)
+
+// migration is a single schema change, versions must keep increasing and
+// a migration must never be edited once released, add a new one instead
+type migration struct {
+	version int
+	name    string
+	up      string
+}
+
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create watchlist",
+		up: `
+		CREATE TABLE IF NOT EXISTS watchlist (
+			anime_id TEXT NOT NULL UNIQUE,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	{
+		version: 2,
+		name:    "add watchlist status and watch history",
+		up: `
+		ALTER TABLE watchlist ADD COLUMN status TEXT NOT NULL DEFAULT 'plan_to_watch';
+
+		CREATE TABLE history (
+			anime_id TEXT NOT NULL,
+			episode_id TEXT NOT NULL,
+			episode_number INTEGER NOT NULL,
+			watched_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX history_anime_id ON history (anime_id)`,
+	},
+	{
+		version: 3,
+		name:    "add scores, notes and rewatches",
+		up: `
+		ALTER TABLE watchlist ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE watchlist ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+		ALTER TABLE watchlist ADD COLUMN rewatches INTEGER NOT NULL DEFAULT 0`,
+	},
+	{
+		version: 4,
+		name:    "add custom lists and tags",
+		up: `
+		CREATE TABLE lists (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO lists (id, name) VALUES (1, 'Watchlist');
+
+		CREATE TABLE list_items (
+			list_id INTEGER NOT NULL,
+			anime_id TEXT NOT NULL,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (list_id, anime_id)
+		);
+		INSERT INTO list_items (list_id, anime_id, added_at) SELECT 1, anime_id, added_at FROM watchlist;
+
+		CREATE TABLE tags (
+			anime_id TEXT NOT NULL,
+			tag TEXT NOT NULL,
+			PRIMARY KEY (anime_id, tag)
+		)`,
+	},
+	{
+		version: 5,
+		name:    "add sync queue",
+		up: `
+		CREATE TABLE sync_queue (
+			service TEXT NOT NULL,
+			anime_id TEXT NOT NULL,
+			queued_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (service, anime_id)
+		)`,
+	},
+	{
+		version: 6,
+		name:    "add watched episodes and sync opt-out",
+		up: `
+		ALTER TABLE history ADD COLUMN watched INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE watchlist ADD COLUMN sync INTEGER NOT NULL DEFAULT 1`,
+	},
+	{
+		version: 7,
+		name:    "add id mappings",
+		up: `
+		CREATE TABLE id_mappings (
+			anime_id TEXT PRIMARY KEY,
+			mal_id INTEGER NOT NULL DEFAULT 0,
+			anilist_id INTEGER NOT NULL DEFAULT 0,
+			kitsu_id INTEGER NOT NULL DEFAULT 0,
+			source TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX id_mappings_mal_id ON id_mappings (mal_id);
+		CREATE INDEX id_mappings_anilist_id ON id_mappings (anilist_id);
+
+		CREATE TABLE tracker_ids (
+			mal_id INTEGER NOT NULL DEFAULT 0,
+			anilist_id INTEGER NOT NULL DEFAULT 0,
+			kitsu_id INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE INDEX tracker_ids_mal_id ON tracker_ids (mal_id);
+		CREATE INDEX tracker_ids_anilist_id ON tracker_ids (anilist_id)`,
+	},
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrate brings the database up to the latest schema, each migration runs in
+// its own transaction and the database is backed up before anything changes
+func migrate(db *sql.DB, dbPath string) error {
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest := latestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("database %s uses schema version %d but this anigarden only knows up to version %d, please update anigarden", dbPath, current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if err := backupDB(db, dbPath, current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.up); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.version, err)
+	}
+
+	return tx.Commit()
+}
+
+// backupDB copies the database next to itself before upgrading from the given version,
+// fresh databases with nothing in them are not backed up
+func backupDB(db *sql.DB, dbPath string, version int) error {
+	var tables int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations'`).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d.bak", dbPath, version)
+	if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old backup: %w", err)
+	}
+
+	if _, err := db.Exec(`VACUUM INTO ?`, backupPath); err != nil {
+		return fmt.Errorf("failed to back up database to %s: %w", backupPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB opens an empty database in a temporary directory
+func openTestDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "watchlist.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, path
+}
+
+// useTestDB points the db of the app at a migrated temporary database for the rest of the test
+func useTestDB(t *testing.T) {
+	t.Helper()
+	conn, path := openTestDB(t)
+	if err := migrate(conn, path); err != nil {
+		t.Fatal(err)
+	}
+	old := db
+	db = conn
+	t.Cleanup(func() { db = old })
+}
+
+// migrateTo applies the migrations up to version, like an older anigarden would have
+func migrateTo(t *testing.T, conn *sql.DB, version int) {
+	t.Helper()
+	_, err := conn.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations {
+		if m.version > version {
+			break
+		}
+		if err := applyMigration(conn, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrationVersionsIncrease(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version <= migrations[i-1].version {
+			t.Errorf("migration %q has version %d after %d", migrations[i].name, migrations[i].version, migrations[i-1].version)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name       string
+		from       int
+		seed       string
+		wantBackup bool
+		// check is run against the migrated database and returns a value to compare with want
+		check string
+		want  string
+	}{
+		{
+			name:  "fresh database",
+			from:  0,
+			check: `SELECT name FROM lists WHERE id = 1`,
+			want:  "Watchlist",
+		},
+		{
+			name:       "database from before migrations",
+			from:       0,
+			seed:       `CREATE TABLE watchlist (anime_id TEXT NOT NULL UNIQUE, added_at DATETIME DEFAULT CURRENT_TIMESTAMP); INSERT INTO watchlist (anime_id) VALUES ('one-piece-100')`,
+			wantBackup: true,
+			check:      `SELECT anime_id FROM watchlist`,
+			want:       "one-piece-100",
+		},
+		{
+			name:       "watchlist entries get a status",
+			from:       1,
+			seed:       `INSERT INTO watchlist (anime_id) VALUES ('one-piece-100')`,
+			wantBackup: true,
+			check:      `SELECT status FROM watchlist WHERE anime_id = 'one-piece-100'`,
+			want:       "plan_to_watch",
+		},
+		{
+			name:       "watchlist entries move into the default list",
+			from:       3,
+			seed:       `INSERT INTO watchlist (anime_id, score) VALUES ('one-piece-100', 9)`,
+			wantBackup: true,
+			check:      `SELECT li.list_id || ':' || w.score FROM list_items li JOIN watchlist w USING (anime_id)`,
+			want:       "1:9",
+		},
+		{
+			name:       "old history counts as watched",
+			from:       5,
+			seed:       `INSERT INTO watchlist (anime_id) VALUES ('one-piece-100'); INSERT INTO history (anime_id, episode_id, episode_number) VALUES ('one-piece-100', 'one-piece-100?ep=1', 1)`,
+			wantBackup: true,
+			check:      `SELECT h.watched || ':' || w.sync FROM history h JOIN watchlist w USING (anime_id)`,
+			want:       "1:1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, path := openTestDB(t)
+			if tt.from > 0 {
+				migrateTo(t, conn, tt.from)
+			}
+			if tt.seed != "" {
+				if _, err := conn.Exec(tt.seed); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := migrate(conn, path); err != nil {
+				t.Fatal(err)
+			}
+
+			version, err := schemaVersion(conn)
+			if err != nil || version != latestSchemaVersion() {
+				t.Errorf("schema version = %d, %v, want %d", version, err, latestSchemaVersion())
+			}
+			var got string
+			if err := conn.QueryRow(tt.check).Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			_, err = os.Stat(fmt.Sprintf("%s.v%d.bak", path, tt.from))
+			if backedUp := err == nil; backedUp != tt.wantBackup {
+				t.Errorf("backed up = %v, want %v", backedUp, tt.wantBackup)
+			}
+		})
+	}
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	conn, path := openTestDB(t)
+	migrateTo(t, conn, latestSchemaVersion())
+	if _, err := conn.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from the future')`, latestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(conn, path); err == nil {
+		t.Error("migrating a newer schema succeeded")
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -13,50 +16,233 @@ type model struct {
 	info      infoModel
 	watchlist watchlistModel
 	win       tea.WindowSizeMsg
+	picker    listPickerModel
+	picking   bool
+	themes    themePickerModel
+	theming   bool
+
+	// pages left for another one, back returns to the last of them
+	history []pageState
+
+	// notifications: toasts of recent notices, the last one for the status line
+	// and the error that failed a page, until it's dismissed
+	toasts     []toast
+	lastToast  int
+	lastStatus status
+	banner     errMsg
+
+	// language, client and hidden filler toggled on the info page, they carry over to the next anime
+	lang       string
+	client     string
+	hideFiller bool
 }
 
+// pageState is a page in the history. home, search and watchlist keep their own
+// state in the model, the info page is replaced by the next anime so it's kept here
+type pageState struct {
+	page page
+	info infoModel
+}
+
+// maxHistory is how many pages back can return through
+const maxHistory = 50
+
+var pagesByName = map[string]page{"home": homePage, "search": searchPage, "watchlist": watchlistPage}
+
 func initialModel() model {
-	return model{currPage: homePage, home: initHomeModel(), search: initSearchModel(), watchlist: initWatchlistModel()}
+	m := model{
+		currPage:  pagesByName[cfg.StartupPage],
+		home:      initHomeModel(),
+		search:    initSearchModel(),
+		watchlist: initWatchlistModel(),
+		lang:      cfg.Lang,
+		client:    cfg.Client,
+	}
+	if m.currPage == searchPage {
+		m.search.textInput.Focus()
+	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(fetchHome, m.home.spinner.Tick)
+	cmds := []tea.Cmd{retryable(fetchHome), m.home.spinner.Tick, syncPending, scheduleSync(), fetchWatchlistEntries}
+	if m.currPage == watchlistPage {
+		listId := m.watchlist.listId
+		cmds = append(cmds, retryable(func() tea.Msg { return fetchWatchlist(listId) }), m.watchlist.spinner.Tick)
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	// every page is laid out again, not just the current one
 	case tea.WindowSizeMsg:
 		m.win = msg
+		return m, m.resize(msg)
 
 	case animeInfoMsg:
-		m.info = initInfoModel(msg.anime, m.win.Width, m.win.Height)
+		m.pushHistory()
+		m.info = initInfoModel(msg.anime, m.lang, m.client, m.win.Width, m.win.Height)
+		m.info.hideFiller = m.hideFiller
 		m.currPage = infoPage
-		return m, tea.Batch(m.info.spinner.Tick, func() tea.Msg { return fetchEpisodes(msg.anime.ID) })
+		return m, tea.Batch(
+			m.info.spinner.Tick,
+			retryable(func() tea.Msg { return fetchEpisodes(msg.anime.ID) }),
+			func() tea.Msg { return fetchWatchlistEntry(msg.anime.ID) },
+			func() tea.Msg { return fetchMapping(msg.anime.ID) },
+			func() tea.Msg { return fetchPoster(msg.anime.ID, msg.anime.Poster) },
+		)
+
+	case noticeMsg:
+		return m, m.notify(msg)
+
+	case toastExpiredMsg:
+		for i, t := range m.toasts {
+			if t.id == msg.id {
+				m.toasts = append(m.toasts[:i], m.toasts[i+1:]...)
+				break
+			}
+		}
+		return m, nil
+
+	// the page stops loading and the error stays on the banner
+	case errMsg:
+		m.banner = msg
+
+	case watchlistEntriesMsg:
+		watchlistEntries = msg.entries
+		return m, nil
+
+	// the player runs whatever page is shown, the user may have left the info page while it launched
+	case playMsg:
+		return m, runPlayer(msg)
+
+	// so is the playback recorded, the info page of the anime shows it as watched afterwards
+	case playerExitMsg:
+		cmds := []tea.Cmd{handleRecordPlayback(msg), fetchWatchlistEntries}
+		if m.currPage == infoPage && m.info.id == msg.animeId {
+			cmds = append(cmds,
+				retryable(func() tea.Msg { return fetchEpisodes(msg.animeId) }),
+				func() tea.Msg { return fetchWatchlistEntry(msg.animeId) },
+			)
+		}
+		return m, tea.Sequence(cmds...)
+
+	// the watchlist changed, the anime lists mark what's in it again
+	case watchlistMsg:
+		var cmd tea.Cmd
+		m.watchlist, cmd = m.watchlist.Update(msg)
+		return m, tea.Batch(cmd, fetchWatchlistEntries)
+
+	case entryMsg:
+		watchlistEntries[msg.entry.animeId] = msg.entry
+
+	// syncing runs in the background, the user only hears about it when something went wrong
+	case syncResultMsg:
+		var cmd tea.Cmd
+		if len(msg.failed) > 0 || len(msg.skipped) > 0 {
+			cmd = m.notify(noticeMsg{text: msg.String(), warn: true})
+		}
+		// the watchlist page refreshes its sync column
+		var pageCmd tea.Cmd
+		if m.currPage == watchlistPage {
+			m.watchlist, pageCmd = m.watchlist.Update(msg)
+		}
+		return m, tea.Batch(cmd, pageCmd)
+
+	// toggles go back to the new defaults, for the anime on the info page too
+	case configReloadedMsg:
+		m.lang, m.client = cfg.Lang, cfg.Client
+		m.info.lang, m.info.client = cfg.Lang, cfg.Client
+		m.info.desc.KeyMap = descKeyMap()
+		m.restyle()
+		if msg.dataDirChanged {
+			return m, m.notify(noticeMsg{text: "reloaded config, restart anigarden to use the new data_dir"})
+		}
+		return m, m.notify(noticeMsg{text: "reloaded config"})
+
+	case syncTickMsg:
+		return m, tea.Batch(syncPending, scheduleSync())
+
+	case listPickerMsg:
+		m.picker = initListPicker(msg, m.win.Width, m.win.Height)
+		m.picking = true
+		return m, nil
 
 	case tea.KeyMsg:
+		// the list picker takes every key until it's closed
+		if m.picking {
+			if key.Matches(msg, forceQuit) {
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.picker, cmd = m.picker.Update(msg)
+			m.picking = !m.picker.done
+			if m.picker.done && cmd != nil {
+				cmd = tea.Sequence(cmd, fetchWatchlistEntries)
+			}
+			return m, cmd
+		}
+
+		// so does the theme picker, every move previews a theme
+		if m.theming {
+			if key.Matches(msg, forceQuit) {
+				return m, tea.Quit
+			}
+			var cmd tea.Cmd
+			m.themes, cmd = m.themes.Update(msg)
+			m.theming = !m.themes.done
+			m.restyle()
+			return m, cmd
+		}
+
 		// if in filtering or textinput focus state, avoid quiting, switch pages...
-		if m.home.list.FilterState() == list.Filtering || m.search.list.FilterState() == list.Filtering || m.search.textInput.Focused() {
+		if m.home.list.FilterState() == list.Filtering || m.search.list.FilterState() == list.Filtering || m.search.textInput.Focused() ||
+			m.info.editingNotes || m.info.editingMapping || m.info.jumping || m.info.list.FilterState() == list.Filtering || m.watchlist.list.FilterState() == list.Filtering ||
+			m.watchlist.prompt != noPrompt {
 			break
 		}
 
-		switch msg.String() {
-		case "ctrl+c", "q":
+		switch {
+		case key.Matches(msg, keys.Quit):
 			return m, tea.Quit
 
-		case "h":
-			m.currPage = homePage
+		case key.Matches(msg, keys.ReloadConfig):
+			return m, reloadConfig
+
+		case key.Matches(msg, keys.PickTheme):
+			m.themes = initThemePicker(m.win.Width, m.win.Height)
+			m.theming = true
+			return m, nil
+
+		case key.Matches(msg, keys.Retry) && m.banner.retry != nil:
+			retry := m.banner.retry
+			m.banner = errMsg{}
+			return m, tea.Batch(retry, m.spinnerTick())
+
+		case key.Matches(msg, keys.DismissError) && m.banner.err != nil:
+			m.banner = errMsg{}
+			return m, nil
+
+		case key.Matches(msg, keys.ToggleRows) && m.currPage != infoPage:
+			m.toggleRows()
+			return m, nil
+
+		case key.Matches(msg, keys.Back) && !m.pageHandlesBack():
+			return m.back()
+
+		case key.Matches(msg, keys.Home):
+			m.goTo(homePage)
 			return m, nil
 
-		case "s":
-			m.currPage = searchPage
+		case key.Matches(msg, keys.Search):
+			m.goTo(searchPage)
 			m.search.textInput.Focus()
 			return m, func() tea.Msg { return m.win } // send tea.WindowSizeMsg to search model
 
-		case "w":
-			m.currPage = watchlistPage
-
-			// send tea.WindowSizeMsg to watchlist model
-			return m, tea.Batch(fetchWatchlist, func() tea.Msg { return m.win }, m.watchlist.spinner.Tick)
+		case key.Matches(msg, keys.Watchlist):
+			m.goTo(watchlistPage)
+			return m, m.showWatchlist()
 		}
 	}
 
@@ -74,6 +260,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case infoPage:
 		var cmd tea.Cmd
 		m.info, cmd = m.info.Update(msg)
+		m.lang, m.client, m.hideFiller = m.info.lang, m.info.client, m.info.hideFiller
 		return m, cmd
 
 	case watchlistPage:
@@ -88,6 +275,180 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 var docStyle = lipgloss.NewStyle().Margin(1, 2)
 
 func (m model) View() string {
+	if m.win.Width > 0 && tooSmall(m.win.Width, m.win.Height) {
+		return tooSmallView(m.win.Width, m.win.Height)
+	}
+
+	view := m.pageView()
+	if m.picking {
+		view = m.picker.View()
+	}
+	if m.theming {
+		view = m.themes.View()
+	}
+
+	if m.win.Width == 0 {
+		return view
+	}
+	return placeNotifications(view, m.win.Width, m.win.Height, m.banner, m.toasts, m.lastStatus, m.lang, m.client)
+}
+
+// notify shows a notice as a toast, the oldest toast makes room when there are too many
+func (m *model) notify(n noticeMsg) tea.Cmd {
+	if n.err == nil && n.text == "" {
+		return nil
+	}
+	m.lastToast++
+	t := toastOf(n)
+	t.id = m.lastToast
+	m.toasts = append(m.toasts, t)
+	if len(m.toasts) > maxToasts {
+		m.toasts = m.toasts[1:]
+	}
+	m.lastStatus = status{t, time.Now()}
+
+	id := t.id
+	return tea.Tick(toastDuration, func(time.Time) tea.Msg { return toastExpiredMsg{id} })
+}
+
+// spinnerTick keeps the spinner of the current page going while a retry loads
+func (m model) spinnerTick() tea.Cmd {
+	switch m.currPage {
+	case homePage:
+		return m.home.spinner.Tick
+	case searchPage:
+		return m.search.spinner.Tick
+	case infoPage:
+		return m.info.spinner.Tick
+	case watchlistPage:
+		return m.watchlist.spinner.Tick
+	}
+	return nil
+}
+
+// resize sends the new window size to every page and resizes the pickers
+func (m *model) resize(msg tea.WindowSizeMsg) tea.Cmd {
+	var cmds [4]tea.Cmd
+	m.home, cmds[0] = m.home.Update(msg)
+	m.search, cmds[1] = m.search.Update(msg)
+	m.watchlist, cmds[2] = m.watchlist.Update(msg)
+	if m.info.id != "" {
+		m.info, cmds[3] = m.info.Update(msg)
+	}
+
+	w, v := docStyle.GetFrameSize()
+	if m.picking {
+		m.picker.list.SetSize(msg.Width-w, msg.Height-v)
+	}
+	if m.theming {
+		m.themes.list.SetSize(msg.Width-w, msg.Height-v)
+	}
+	return tea.Batch(cmds[:]...)
+}
+
+// pushHistory remembers the current page before leaving it
+func (m *model) pushHistory() {
+	state := pageState{page: m.currPage}
+	if m.currPage == infoPage {
+		state.info = m.info
+	}
+	m.history = append(m.history, state)
+	if len(m.history) > maxHistory {
+		m.history = m.history[1:]
+	}
+}
+
+// goTo switches to another page, going to the current page again isn't history
+func (m *model) goTo(p page) {
+	if p == m.currPage {
+		return
+	}
+	m.pushHistory()
+	m.currPage = p
+}
+
+// showWatchlist refetches the watchlist, it keeps its cursor and filter when the list is the same
+func (m model) showWatchlist() tea.Cmd {
+	// send tea.WindowSizeMsg to watchlist model
+	listId := m.watchlist.listId
+	return tea.Batch(retryable(func() tea.Msg { return fetchWatchlist(listId) }), func() tea.Msg { return m.win }, m.watchlist.spinner.Tick)
+}
+
+// pageHandlesBack tells whether the back key means something to the current page first,
+// esc clears an applied filter and closes the quality picker
+func (m model) pageHandlesBack() bool {
+	switch m.currPage {
+	case homePage:
+		return m.home.list.FilterState() == list.FilterApplied
+	case searchPage:
+		return m.search.list.FilterState() == list.FilterApplied
+	case infoPage:
+		return m.info.picking || m.info.list.FilterState() == list.FilterApplied
+	case watchlistPage:
+		return m.watchlist.list.FilterState() == list.FilterApplied
+	}
+	return false
+}
+
+// back returns to the previous page as it was left
+func (m model) back() (tea.Model, tea.Cmd) {
+	if len(m.history) == 0 {
+		return m, nil
+	}
+	prev := m.history[len(m.history)-1]
+	m.history = m.history[:len(m.history)-1]
+
+	m.currPage = prev.page
+	switch prev.page {
+	case infoPage:
+		m.info = prev.info
+		m.info.lang, m.info.client = m.lang, m.client
+		id := m.info.id
+		// the entry may have changed while away, on the watchlist page for one
+		return m, tea.Batch(func() tea.Msg { return fetchWatchlistEntry(id) }, func() tea.Msg { return m.win })
+	case watchlistPage:
+		return m, m.showWatchlist()
+	}
+	return m, func() tea.Msg { return m.win }
+}
+
+// restyle redraws the spinners and lists of every page with the current theme
+func (m *model) restyle() {
+	m.home.spinner.Style = spinnerStyle
+	m.search.spinner.Style = spinnerStyle
+	m.info.spinner.Style = spinnerStyle
+	m.watchlist.spinner.Style = spinnerStyle
+	if m.home.loaded {
+		restyleList(&m.home.list, newAnimeDelegate(m.home.compact))
+	}
+	if m.search.loaded {
+		restyleList(&m.search.list, newAnimeDelegate(m.search.compact))
+	}
+	if m.info.loaded {
+		restyleList(&m.info.list, newEpisodeDelegate())
+	}
+	if m.info.picking {
+		restyleList(&m.info.qualities, newDelegate())
+	}
+	// the left pane shows the same with new styles, it's laid out again right away
+	m.info.left = m.info.leftPane()
+	m.info.desc.SetContent(m.info.left.render())
+	if m.watchlist.loaded {
+		restyleList(&m.watchlist.list, newAnimeDelegate(m.watchlist.compact))
+	}
+	if m.picking {
+		restyleList(&m.picker.list, newDelegate())
+	}
+}
+
+// toggleRows switches the anime lists of every page between compact and detailed rows
+func (m *model) toggleRows() {
+	compact := !m.home.compact
+	m.home.compact, m.search.compact, m.watchlist.compact = compact, compact, compact
+	m.restyle()
+}
+
+func (m model) pageView() string {
 	switch m.currPage {
 	case homePage:
 		return m.home.View()
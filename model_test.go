@@ -0,0 +1,148 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// keyPress is the message the program sends for the key written as k
+func keyPress(k string) tea.KeyMsg {
+	switch k {
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case "backspace":
+		return tea.KeyMsg{Type: tea.KeyBackspace}
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+// press sends a key to m like the program would
+func press(m model, k string) model {
+	next, _ := m.Update(keyPress(k))
+	return next.(model)
+}
+
+func showInfo(m model, id string) model {
+	next, _ := m.Update(animeInfoMsg{anime{ID: id, Name: id}})
+	return next.(model)
+}
+
+func TestBack(t *testing.T) {
+	m := initialModel()
+	m = showInfo(m, "one-piece-100")
+	m = showInfo(m, "frieren-18542")
+	m = press(m, "w")
+	// toggles carry over to the info pages gone back to
+	m.lang = "dub"
+
+	steps := []struct {
+		key    string
+		want   page
+		wantId string
+	}{
+		{"esc", infoPage, "frieren-18542"},
+		{"backspace", infoPage, "one-piece-100"},
+		{"esc", homePage, ""},
+		{"esc", homePage, ""},
+	}
+	for i, step := range steps {
+		m = press(m, step.key)
+		if m.currPage != step.want {
+			t.Fatalf("step %d: page = %v, want %v", i, m.currPage, step.want)
+		}
+		if step.want == infoPage && (m.info.id != step.wantId || m.info.lang != "dub") {
+			t.Errorf("step %d: info of %q in %s, want %q in dub", i, m.info.id, m.info.lang, step.wantId)
+		}
+	}
+	if len(m.history) != 0 {
+		t.Errorf("history = %v, want it used up", m.history)
+	}
+}
+
+func TestGoToSamePage(t *testing.T) {
+	m := initialModel()
+	m = press(m, "h")
+	m = press(m, "h")
+	if len(m.history) != 0 {
+		t.Errorf("history = %v, want going to the current page left out", m.history)
+	}
+	m = press(m, "w")
+	m = press(m, "w")
+	if len(m.history) != 1 || m.history[0].page != homePage {
+		t.Errorf("history = %v, want only home", m.history)
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	m := initialModel()
+	for range maxHistory + 10 {
+		m = showInfo(m, "one-piece-100")
+	}
+	if len(m.history) != maxHistory {
+		t.Errorf("history has %d pages, want %d", len(m.history), maxHistory)
+	}
+	// the oldest pages are dropped, home was the first
+	if m.history[0].page != infoPage {
+		t.Errorf("oldest page = %v, want home dropped", m.history[0].page)
+	}
+}
+
+func TestBackHandledByPage(t *testing.T) {
+	m := initialModel()
+	m = showInfo(m, "one-piece-100")
+	m.info.picking = true
+
+	// esc closes the quality picker before it goes back
+	m = press(m, "esc")
+	if m.currPage != infoPage || m.info.picking {
+		t.Fatalf("page = %v, picking = %v, want the picker closed on the info page", m.currPage, m.info.picking)
+	}
+	m = press(m, "esc")
+	if m.currPage != homePage {
+		t.Errorf("page = %v, want home", m.currPage)
+	}
+}
+
+func TestPlayerExit(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	useFakeAPI(t, fakeAPI{"/anime/one-piece-100/episodes": `{"episodes": [{"episodeId": "one-piece-100?ep=1", "number": 1}]}`})
+	ep := episode{ID: "one-piece-100?ep=1", Number: 1}
+
+	tests := []struct {
+		name         string
+		page         func(m model) model
+		wantEpisodes bool
+	}{
+		{"on the info page of the anime", func(m model) model { return showInfo(m, "one-piece-100") }, true},
+		{"on the info page of another anime", func(m model) model { return showInfo(m, "frieren-18542") }, false},
+		// the user went back while the player ran
+		{"on another page", func(m model) model { return m }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			m := tt.page(initialModel())
+			_, cmd := m.Update(playerExitMsg{"one-piece-100", ep, true})
+
+			gotEpisodes := false
+			for _, msg := range runCmd(cmd) {
+				// the playback is recorded before the episodes are refetched
+				if msg, ok := msg.(episodesMsg); ok {
+					gotEpisodes = msg.watched[1]
+				}
+			}
+			if gotEpisodes != tt.wantEpisodes {
+				t.Errorf("episodes refetched with the playback = %v, want %v", gotEpisodes, tt.wantEpisodes)
+			}
+			watched, err := getWatchedEpisodes("one-piece-100")
+			if err != nil || !watched[1] {
+				t.Errorf("watched = %v, %v, want the playback recorded on any page", watched, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// toasts are shown for toastDuration over the bottom right of the page, at most maxToasts at once
+const (
+	toastDuration = 4 * time.Second
+	maxToasts     = 3
+)
+
+type toastKind int
+
+const (
+	toastSuccess toastKind = iota
+	toastWarning
+	toastError
+)
+
+type toast struct {
+	id   int
+	kind toastKind
+	text string
+}
+
+type toastExpiredMsg struct{ id int }
+
+// toastOf turns a notice into a toast, errors win over text
+func toastOf(n noticeMsg) toast {
+	switch {
+	case n.err != nil:
+		return toast{kind: toastError, text: n.err.Error()}
+	case n.warn:
+		return toast{kind: toastWarning, text: n.text}
+	}
+	return toast{kind: toastSuccess, text: n.text}
+}
+
+func (t toast) View() string {
+	switch t.kind {
+	case toastWarning:
+		return noticeWarningStyle.Render("! " + t.text)
+	case toastError:
+		return noticeErrorStyle.Render("✗ " + t.text)
+	}
+	return noticeStyle.Render("✓ " + t.text)
+}
+
+// retryable runs cmd and lets the error banner run it again when it fails
+func retryable(cmd tea.Cmd) tea.Cmd {
+	var run tea.Cmd
+	run = func() tea.Msg {
+		msg := cmd()
+		if msg, ok := msg.(errMsg); ok && msg.retry == nil {
+			msg.retry = run
+			return msg
+		}
+		return msg
+	}
+	return run
+}
+
+// status is the last notification, kept on the status line once its toast is gone
+type status struct {
+	toast
+	at time.Time
+}
+
+// statusLine is drawn on the bottom margin, the last notification on the left and the playing options on the right
+func statusLine(width int, last status, lang, client string) string {
+	right := mutedStyle.Render(lang + " · " + client)
+
+	var left string
+	if last.text != "" {
+		style := mutedStyle
+		if last.kind == toastError {
+			style = noticeErrorStyle.UnsetPadding()
+		}
+		text := fmt.Sprintf("%s %s", last.at.Format("15:04"), last.text)
+		left = style.Render(ansi.Truncate(text, max(width-lipgloss.Width(right)-1, 0), "…"))
+	}
+	gap := max(width-lipgloss.Width(left)-lipgloss.Width(right), 1)
+	return left + strings.Repeat(" ", gap) + right
+}
+
+// bannerView is an error that failed a page, it stays on the top margin until it's dismissed or retried
+func bannerView(width int, banner errMsg) string {
+	actions := keys.DismissError.Help().Key + " dismiss"
+	if banner.retry != nil {
+		actions = keys.Retry.Help().Key + " retry · " + actions
+	}
+	inner := width - bannerStyle.GetHorizontalFrameSize()
+	text := ansi.Truncate("✗ "+banner.err.Error(), max(inner-lipgloss.Width(actions)-3, 0), "…")
+	return bannerStyle.Width(width).MaxWidth(width).Render(text + " · " + actions)
+}
+
+// placeNotifications draws the banner over the top margin of view, the status line on the last line
+// of the window and the toasts over the right end of the lines above it
+func placeNotifications(view string, width, height int, banner errMsg, toasts []toast, last status, lang, client string) string {
+	w := docStyle.GetMarginLeft()
+	margin := strings.Repeat(" ", w)
+	inner := max(width-w-docStyle.GetMarginRight(), 0)
+
+	lines := strings.Split(view, "\n")
+	if banner.err != nil {
+		lines[0] = margin + bannerView(inner, banner)
+	}
+
+	// short pages are filled up so the status line is at the bottom
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	bottom := margin + statusLine(inner, last, lang, client)
+	if strings.TrimSpace(ansi.Strip(lines[len(lines)-1])) == "" {
+		lines[len(lines)-1] = bottom
+	} else {
+		lines = append(lines, bottom)
+	}
+
+	// the newest toast sits right above the status line
+	for i, t := range toasts {
+		row := len(lines) - 2 - (len(toasts) - 1 - i)
+		if row < 1 {
+			continue
+		}
+		box := ansi.Truncate(t.View(), inner, "…")
+		at := max(w+inner-lipgloss.Width(box), 0)
+		line := ansi.Truncate(lines[row], at, "")
+		lines[row] = line + strings.Repeat(" ", max(at-lipgloss.Width(line), 0)) + box
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// flaky fails the first fails times it runs and then loads
+func flaky(fails int) (tea.Cmd, *int) {
+	runs := 0
+	return func() tea.Msg {
+		runs++
+		if runs <= fails {
+			return errMsg{err: errors.New("connection refused")}
+		}
+		return noticeMsg{text: "loaded"}
+	}, &runs
+}
+
+func TestRetryable(t *testing.T) {
+	cmd, runs := flaky(2)
+	msg, ok := retryable(cmd)().(errMsg)
+	if !ok || msg.retry == nil {
+		t.Fatalf("failed load = %#v, want an error that can be retried", msg)
+	}
+	// a retry that fails again can be retried too
+	msg, ok = msg.retry().(errMsg)
+	if !ok || msg.retry == nil {
+		t.Fatalf("failed retry = %#v, want an error that can be retried", msg)
+	}
+	if got := msg.retry(); got != (noticeMsg{text: "loaded"}) || *runs != 3 {
+		t.Errorf("retry = %#v after %d runs, want it loaded on the third", got, *runs)
+	}
+}
+
+func TestRetryFromBanner(t *testing.T) {
+	m := initialModel()
+	next, _ := m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m = next.(model)
+
+	cmd, runs := flaky(1)
+	for _, msg := range runCmd(retryable(cmd)) {
+		next, _ = m.Update(msg)
+		m = next.(model)
+	}
+	if m.banner.err == nil || m.banner.retry == nil {
+		t.Fatalf("banner = %#v, want the error with a retry", m.banner)
+	}
+	if view := ansi.Strip(m.View()); !strings.Contains(view, "connection refused") || !strings.Contains(view, "y retry") {
+		t.Errorf("view doesn't show the banner:\n%s", view)
+	}
+
+	next, retry := m.Update(keyPress(keys.Retry.Keys()[0]))
+	m = next.(model)
+	if m.banner.err != nil {
+		t.Errorf("banner = %#v, want it cleared while retrying", m.banner)
+	}
+	var loaded bool
+	for _, msg := range runCmd(retry) {
+		loaded = loaded || msg == noticeMsg{text: "loaded"}
+	}
+	if !loaded || *runs != 2 {
+		t.Errorf("retrying ran the load %d times and loaded = %v, want it run again", *runs, loaded)
+	}
+}
+
+func TestDismissBanner(t *testing.T) {
+	m := initialModel()
+	next, _ := m.Update(errMsg{err: errors.New("no such anime")})
+	m = next.(model)
+
+	// errors that can't be retried are only dismissed
+	m = press(m, keys.Retry.Keys()[0])
+	if m.banner.err == nil {
+		t.Fatal("retry cleared a banner without a retry")
+	}
+	m = press(m, keys.DismissError.Keys()[0])
+	if m.banner.err != nil {
+		t.Errorf("banner = %#v, want it dismissed", m.banner)
+	}
+}
+
+func TestToasts(t *testing.T) {
+	m := initialModel()
+	if cmd := m.notify(noticeMsg{}); cmd != nil || len(m.toasts) != 0 {
+		t.Error("an empty notice made a toast")
+	}
+
+	var expired []tea.Cmd
+	for _, n := range []noticeMsg{{text: "one"}, {text: "two", warn: true}, {err: errors.New("three")}, {text: "four"}} {
+		expired = append(expired, m.notify(n))
+	}
+	if len(m.toasts) != maxToasts || m.toasts[0].text != "two" {
+		t.Fatalf("toasts = %+v, want the newest %d", m.toasts, maxToasts)
+	}
+	if kinds := [3]toastKind{m.toasts[0].kind, m.toasts[1].kind, m.toasts[2].kind}; kinds != [3]toastKind{toastWarning, toastError, toastSuccess} {
+		t.Errorf("kinds = %v", kinds)
+	}
+	if m.lastStatus.text != "four" {
+		t.Errorf("status = %q, want the last notice", m.lastStatus.text)
+	}
+
+	// the toast of "three" expires, the status line keeps the last notice
+	next, _ := m.Update(toastExpiredMsg{id: 3})
+	m = next.(model)
+	if len(m.toasts) != 2 || m.toasts[0].text != "two" || m.toasts[1].text != "four" {
+		t.Errorf("toasts = %+v, want three gone", m.toasts)
+	}
+	if m.lastStatus.text != "four" {
+		t.Errorf("status = %q, want it kept", m.lastStatus.text)
+	}
+	if len(expired) != 4 || expired[0] == nil {
+		t.Error("notify didn't schedule the toasts to expire")
+	}
+}
+
+func TestStatusLine(t *testing.T) {
+	at := time.Date(2026, 1, 1, 21, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		width int
+		last  status
+		want  string
+	}{
+		{"nothing yet", 30, status{}, strings.Repeat(" ", 21) + "sub · mpv"},
+		{"last notice", 30, status{toast{text: "added"}, at}, "21:05 added" + strings.Repeat(" ", 10) + "sub · mpv"},
+		{"too long", 30, status{toast{text: "added Frieren to the watchlist"}, at}, "21:05 added Frieren… sub · mpv"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := statusLine(tt.width, tt.last, "sub", "mpv")
+			if plain := ansi.Strip(got); plain != tt.want {
+				t.Errorf("statusLine = %q, want %q", plain, tt.want)
+			}
+			if w := lipgloss.Width(got); w != tt.width {
+				t.Errorf("status line is %d cells wide, want %d", w, tt.width)
+			}
+		})
+	}
+}
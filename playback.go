@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchedThreshold is how much of an episode has to be played before it counts as watched
+const watchedThreshold = 0.85
+
+// trackable tells whether playback progress of a client can be followed,
+// only mpv reports it through its ipc socket, everything else counts as watched right away
+func trackable(client string) bool {
+	return client != "browser" && playerCmd == "mpv"
+}
+
+// playerSocket is where mpv is asked to listen for ipc commands
+func playerSocket() string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("anigarden-mpv-%d.sock", os.Getpid()))
+}
+
+// playbackTracker follows an episode playing in mpv and notes when it crosses the threshold,
+// the playback is recorded once the player exited
+type playbackTracker struct {
+	socket    string
+	stop      chan struct{}
+	done      chan struct{}
+	connected bool
+	reached   bool
+}
+
+func startTracker(socket string) *playbackTracker {
+	t := &playbackTracker{
+		socket: socket,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// finish stops the tracker after the player exited and tells whether the episode was watched,
+// when mpv never answered on its socket (no unix sockets, old mpv...) it counts as watched
+func (t *playbackTracker) finish() bool {
+	close(t.stop)
+	<-t.done
+	os.Remove(t.socket)
+
+	return !t.connected || t.reached
+}
+
+func (t *playbackTracker) run() {
+	defer close(t.done)
+
+	var conn net.Conn
+	for conn == nil {
+		select {
+		case <-t.stop:
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+		conn, _ = net.Dial("unix", t.socket)
+	}
+	defer conn.Close()
+	t.connected = true
+
+	reader := bufio.NewReader(conn)
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		percent, err := queryPercent(conn, reader)
+		if err != nil {
+			// mpv closes the socket when it exits
+			return
+		}
+		if percent >= watchedThreshold*100 {
+			t.reached = true
+			return
+		}
+	}
+}
+
+// savePlayback records an episode that was played, the anime is completed when the last
+// episode of an anime that finished airing was watched. The total is looked up from the api,
+// when that fails the playback is still recorded and the status left for the next one
+func savePlayback(animeId string, ep episode, watched bool) error {
+	completed := false
+	if watched {
+		if details, err := getAnimeDetails(animeId); err == nil {
+			total := details.totalEpisodes()
+			completed = total > 0 && ep.Number >= total
+		}
+	}
+	return recordPlayback(animeId, ep, completed, watched)
+}
+
+// queryPercent asks mpv how far into the file it is, events mpv sends on its own are skipped
+func queryPercent(conn net.Conn, reader *bufio.Reader) (float64, error) {
+	const requestId = 1
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err := fmt.Fprintf(conn, `{"command": ["get_property", "percent-pos"], "request_id": %d}`+"\n", requestId)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return 0, err
+		}
+
+		var res struct {
+			Data      float64 `json:"data"`
+			Error     string  `json:"error"`
+			RequestId int     `json:"request_id"`
+		}
+		if err := json.Unmarshal(line, &res); err != nil || res.RequestId != requestId {
+			continue
+		}
+		// percent-pos is unavailable until the stream starts playing
+		if res.Error != "success" {
+			return 0, nil
+		}
+		return res.Data, nil
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSavePlayback(t *testing.T) {
+	details := func(status string, sub, dub int) string {
+		return fmt.Sprintf(`{"anime": {"info": {"id": "a", "stats": {"episodes": {"sub": %d, "dub": %d}}}, "moreInfo": {"status": %q}}}`, sub, dub, status)
+	}
+	tests := []struct {
+		name    string
+		details string // answer of the api, empty when the lookup fails
+		status  watchStatus
+		number  int
+		watched bool
+		want    watchStatus
+	}{
+		{"first episode starts watching", details("Finished Airing", 12, 12), statusPlanToWatch, 1, true, statusWatching},
+		{"last episode completes", details("Finished Airing", 12, 12), statusWatching, 12, true, statusCompleted},
+		{"the longer of sub and dub is the total", details("Finished Airing", 12, 24), statusWatching, 12, true, statusWatching},
+		{"latest episode of an airing anime", details("Currently Airing", 12, 12), statusWatching, 12, true, statusWatching},
+		{"last episode closed early", details("Finished Airing", 12, 12), statusWatching, 12, false, statusWatching},
+		{"planned anime finished in one go", details("Finished Airing", 1, 0), statusPlanToWatch, 1, true, statusCompleted},
+		{"dropped anime stay dropped", details("Finished Airing", 12, 12), statusDropped, 12, true, statusDropped},
+		{"on hold anime stay on hold", details("Finished Airing", 12, 12), statusOnHold, 3, true, statusOnHold},
+		{"failed lookup still records", "", statusWatching, 12, true, statusWatching},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			routes := fakeAPI{}
+			if tt.details != "" {
+				routes["/anime/a"] = tt.details
+			}
+			useFakeAPI(t, routes)
+			if err := addAnimeToList(1, "a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := setWatchStatus("a", tt.status); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := savePlayback("a", episode{ID: "a?ep=1", Number: tt.number}, tt.watched); err != nil {
+				t.Fatal(err)
+			}
+
+			entry, err := getWatchlistEntry("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry.status != tt.want {
+				t.Errorf("status = %s, want %s", entry.status, tt.want)
+			}
+			watched, err := getWatchedEpisodes("a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if watched[tt.number] != tt.watched {
+				t.Errorf("episode %d watched = %v, want %v", tt.number, watched[tt.number], tt.watched)
+			}
+		})
+	}
+}
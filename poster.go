@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	imgcolor "image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// imageModes are the ways posters can be drawn, auto picks one from the terminal
+var imageModes = []string{"auto", "kitty", "sixel", "halfblocks", "off"}
+
+// posters are drawn at most posterWidth cells wide, the pixel size of a cell
+// is asked from the terminal and the defaults are used when it doesn't answer
+const (
+	posterWidth    = 20
+	posterMaxRows  = 40
+	defaultCellW   = 10
+	defaultCellH   = 20
+	posterCacheDir = "posters"
+)
+
+// the poster cache drops posters unused for posterCacheAge, and the least recently
+// used ones once it's bigger than posterCacheSize bytes
+const (
+	posterCacheAge  = 30 * 24 * time.Hour
+	posterCacheSize = 50 << 20
+)
+
+type posterMsg struct {
+	animeId string
+	img     image.Image
+}
+
+// detectImageMode guesses what the terminal can draw from its environment,
+// graphics don't make it through tmux so it gets half blocks
+func detectImageMode() string {
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("TMUX") != "" || strings.HasPrefix(term, "screen"):
+		return "halfblocks"
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || program == "ghostty" || term == "xterm-ghostty":
+		return "kitty"
+	case strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") || strings.Contains(term, "sixel") ||
+		program == "WezTerm" || program == "iTerm.app" || os.Getenv("KONSOLE_VERSION") != "":
+		return "sixel"
+	default:
+		return "halfblocks"
+	}
+}
+
+// imageMode is the configured mode with auto resolved
+func imageMode() string {
+	if cfg.Images == "auto" {
+		return detectImageMode()
+	}
+	return cfg.Images
+}
+
+func getCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	cacheDir := filepath.Join(dir, "anigarden", posterCacheDir)
+	if err := os.MkdirAll(cacheDir, 0775); err != nil {
+		return "", err
+	}
+	return cacheDir, nil
+}
+
+// cachedPoster returns the poster at url, downloading it the first time
+func cachedPoster(url string) (image.Image, error) {
+	dir, err := getCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(url))
+	file := filepath.Join(dir, hex.EncodeToString(sum[:16])+path.Ext(url))
+
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		data, err = downloadPoster(url)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.WriteFile(file, data, 0664); err == nil {
+			prunePosterCache(dir, time.Now())
+		}
+	case err == nil:
+		// the modification time is when the poster was last used
+		now := time.Now()
+		os.Chtimes(file, now, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode poster: %w", err)
+	}
+	return img, nil
+}
+
+// prunePosterCache removes the posters that are too old or don't fit in the cache, newest first
+func prunePosterCache(dir string, now time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			files = append(files, info)
+		}
+	}
+	slices.SortFunc(files, func(a, b os.FileInfo) int { return b.ModTime().Compare(a.ModTime()) })
+
+	var size int64
+	for _, f := range files {
+		size += f.Size()
+		if now.Sub(f.ModTime()) > posterCacheAge || size > posterCacheSize {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+}
+
+func downloadPoster(url string) ([]byte, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download poster: %s", res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// fetchPoster loads the poster of an anime from the url the anime lists came with,
+// the info page goes without one when it fails
+func fetchPoster(animeId, url string) tea.Msg {
+	if imageMode() == "off" || url == "" {
+		return nil
+	}
+	img, err := cachedPoster(url)
+	if err != nil {
+		return nil
+	}
+	return posterMsg{animeId, img}
+}
+
+// posterSize is the size in cells of a poster drawn at most width cells wide
+func posterSize(img image.Image, width int) (int, int) {
+	cols := min(posterWidth, width)
+	if img == nil || cols <= 0 || img.Bounds().Dx() == 0 {
+		return 0, 0
+	}
+	b := img.Bounds()
+	// cells are about twice as high as wide
+	rows := cols * b.Dy() / b.Dx() / 2
+	return cols, min(max(rows, 1), posterMaxRows)
+}
+
+// scaleImage resizes img to w by h pixels, every pixel is the average of the pixels it covers
+func scaleImage(img image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := img.Bounds()
+	for y := range h {
+		y0 := b.Min.Y + y*b.Dy()/h
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/h, y0+1)
+		for x := range w {
+			x0 := b.Min.X + x*b.Dx()/w
+			x1 := max(b.Min.X+(x+1)*b.Dx()/w, x0+1)
+
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+cr>>8, g+cg>>8, bl+cb>>8, n+1
+				}
+			}
+			dst.SetRGBA(x, y, imgcolor.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255})
+		}
+	}
+	return dst
+}
+
+// renderPoster draws img at most width cells wide in the given mode, one string per row of cells
+func renderPoster(img image.Image, width int, mode string) string {
+	cols, rows := posterSize(img, width)
+	if rows == 0 {
+		return ""
+	}
+	switch mode {
+	case "kitty":
+		return renderKitty(img, cols, rows)
+	case "sixel":
+		return renderSixel(img, cols, rows)
+	case "halfblocks":
+		return renderHalfBlocks(img, cols, rows)
+	}
+	return ""
+}
+
+// renderHalfBlocks draws two pixels per cell, the top one as the colour of ▀ and the bottom one as its background
+func renderHalfBlocks(img image.Image, cols, rows int) string {
+	scaled := scaleImage(img, cols, rows*2)
+	lines := make([]string, rows)
+	for y := range rows {
+		var line strings.Builder
+		for x := range cols {
+			top, bottom := scaled.RGBAAt(x, y*2), scaled.RGBAAt(x, y*2+1)
+			line.WriteString(lipgloss.NewStyle().
+				Foreground(lipgloss.Color(hexRGB(top))).
+				Background(lipgloss.Color(hexRGB(bottom))).
+				Render("▀"))
+		}
+		lines[y] = line.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hexRGB(c imgcolor.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// kittyDiacritics mark the row of a unicode placeholder, the column of the cells after
+// the first one of a row is counted on by the terminal
+var kittyDiacritics = []rune{
+	0x0305, 0x030D, 0x030E, 0x0310, 0x0312, 0x033D, 0x033E, 0x033F, 0x0346, 0x034A,
+	0x034B, 0x034C, 0x0350, 0x0351, 0x0352, 0x0357, 0x035B, 0x0363, 0x0364, 0x0365,
+	0x0366, 0x0367, 0x0368, 0x0369, 0x036A, 0x036B, 0x036C, 0x036D, 0x036E, 0x036F,
+	0x0483, 0x0484, 0x0485, 0x0486, 0x0487, 0x0592, 0x0593, 0x0594, 0x0595, 0x0597,
+}
+
+const kittyPlaceholder = '\U0010EEEE'
+
+// renderKitty sends the poster with the kitty graphics protocol and places it with unicode
+// placeholders. They're plain text to the renderer so the poster goes away with the page.
+// The image is sent again whenever its first row is redrawn, which only replaces it
+func renderKitty(img image.Image, cols, rows int) string {
+	cellW, cellH := cellSize()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleImage(img, cols*cellW, rows*cellH)); err != nil {
+		return ""
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	// the image id is also the colour of the placeholders, 24 bits of it
+	id := crc32.ChecksumIEEE(buf.Bytes())&0xffffff | 1
+
+	var transmit strings.Builder
+	for i := 0; i < len(data); i += 4096 {
+		chunk := data[i:min(i+4096, len(data))]
+		more := 0
+		if i+4096 < len(data) {
+			more = 1
+		}
+		if i == 0 {
+			fmt.Fprintf(&transmit, "\x1b_Ga=T,U=1,f=100,q=2,i=%d,c=%d,r=%d,m=%d;%s\x1b\\", id, cols, rows, more, chunk)
+		} else {
+			fmt.Fprintf(&transmit, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+
+	rows = min(rows, len(kittyDiacritics))
+	fg := fmt.Sprintf("\x1b[38;2;%d;%d;%dm", id>>16&0xff, id>>8&0xff, id&0xff)
+	lines := make([]string, rows)
+	for y := range rows {
+		line := fg + string(kittyPlaceholder) + string(kittyDiacritics[y]) + string(kittyDiacritics[0]) +
+			strings.Repeat(string(kittyPlaceholder), cols-1) + "\x1b[39m"
+		if y == 0 {
+			line = transmit.String() + line
+		}
+		lines[y] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// renderSixel draws every row of cells as its own sixel strip. The cursor is saved around
+// a strip and moved over it with spaces, so a row redrawn by the renderer redraws its strip
+func renderSixel(img image.Image, cols, rows int) string {
+	cellW, cellH := cellSize()
+	scaled := scaleImage(img, cols*cellW, rows*cellH)
+
+	lines := make([]string, rows)
+	for y := range rows {
+		strip := scaled.SubImage(image.Rect(0, y*cellH, cols*cellW, (y+1)*cellH)).(*image.RGBA)
+		lines[y] = "\x1b7" + encodeSixel(strip) + "\x1b8" + strings.Repeat(" ", cols)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// encodeSixel encodes img with the 216 colours of the 6x6x6 cube
+func encodeSixel(img *image.RGBA) string {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	index := func(c imgcolor.RGBA) int {
+		return int(c.R)*6/256*36 + int(c.G)*6/256*6 + int(c.B)*6/256
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "\x1bP0;1;0q\"1;1;%d;%d", w, h)
+
+	used := map[int]bool{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			used[index(img.RGBAAt(x, y))] = true
+		}
+	}
+	for c := range 216 {
+		if used[c] {
+			// sixel colours are percentages
+			fmt.Fprintf(&out, "#%d;2;%d;%d;%d", c, c/36*20, c/6%6*20, c%6*20)
+		}
+	}
+
+	for band := 0; band < h; band += 6 {
+		first := true
+		for c := range 216 {
+			if !used[c] {
+				continue
+			}
+
+			sixels := make([]byte, w)
+			found := false
+			for x := range w {
+				var bits byte
+				for bit := range 6 {
+					y := band + bit
+					if y < h && index(img.RGBAAt(b.Min.X+x, b.Min.Y+y)) == c {
+						bits |= 1 << bit
+					}
+				}
+				sixels[x] = '?' + bits
+				found = found || bits != 0
+			}
+			if !found {
+				continue
+			}
+
+			if !first {
+				out.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(&out, "#%d", c)
+			writeSixelRuns(&out, sixels)
+		}
+		out.WriteByte('-')
+	}
+
+	out.WriteString("\x1b\\")
+	return out.String()
+}
+
+// writeSixelRuns writes the sixels of a band, runs of the same sixel are shortened to !count
+func writeSixelRuns(out *strings.Builder, sixels []byte) {
+	for i := 0; i < len(sixels); {
+		j := i
+		for j < len(sixels) && sixels[j] == sixels[i] {
+			j++
+		}
+		if j-i > 3 {
+			fmt.Fprintf(out, "!%d%c", j-i, sixels[i])
+		} else {
+			out.WriteString(strings.Repeat(string(sixels[i]), j-i))
+		}
+		i = j
+	}
+}
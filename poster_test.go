@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	imgcolor "image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// testPoster is a w by h image with a gradient, so scaling has something to average
+func testPoster(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetRGBA(x, y, imgcolor.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestDetectImageMode(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"kitty", map[string]string{"KITTY_WINDOW_ID": "1"}, "kitty"},
+		{"ghostty", map[string]string{"TERM_PROGRAM": "ghostty"}, "kitty"},
+		{"kitty in tmux", map[string]string{"KITTY_WINDOW_ID": "1", "TMUX": "/tmp/tmux-1000/default,1,0"}, "halfblocks"},
+		{"foot", map[string]string{"TERM": "foot"}, "sixel"},
+		{"wezterm", map[string]string{"TERM_PROGRAM": "WezTerm"}, "sixel"},
+		{"anything else", map[string]string{"TERM": "xterm-256color"}, "halfblocks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"TERM", "TERM_PROGRAM", "TMUX", "KITTY_WINDOW_ID", "KONSOLE_VERSION"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := detectImageMode(); got != tt.want {
+				t.Errorf("detectImageMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPosterSize(t *testing.T) {
+	tests := []struct {
+		name               string
+		img                image.Image
+		width              int
+		wantCols, wantRows int
+	}{
+		{"portrait", testPoster(200, 300), 80, posterWidth, 15},
+		{"narrow page", testPoster(200, 300), 10, 10, 7},
+		{"very tall", testPoster(10, 1000), 80, posterWidth, posterMaxRows},
+		{"very wide", testPoster(1000, 10), 80, posterWidth, 1},
+		{"no room", testPoster(200, 300), 0, 0, 0},
+		{"no poster", nil, 80, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cols, rows := posterSize(tt.img, tt.width)
+			if cols != tt.wantCols || rows != tt.wantRows {
+				t.Errorf("posterSize = %dx%d, want %dx%d", cols, rows, tt.wantCols, tt.wantRows)
+			}
+		})
+	}
+}
+
+func TestRenderPosterWidth(t *testing.T) {
+	img := testPoster(200, 300)
+	for _, width := range []int{posterWidth, 12} {
+		cols, rows := posterSize(img, width)
+		for _, mode := range []string{"kitty", "sixel", "halfblocks"} {
+			t.Run(mode, func(t *testing.T) {
+				lines := strings.Split(renderPoster(img, width, mode), "\n")
+				if len(lines) != rows {
+					t.Fatalf("got %d rows, want %d", len(lines), rows)
+				}
+				for i, line := range lines {
+					if got := lipgloss.Width(line); got != cols {
+						t.Errorf("row %d is %d cells wide, want %d", i, got, cols)
+					}
+				}
+			})
+		}
+	}
+
+	if got := renderPoster(img, posterWidth, "off"); got != "" {
+		t.Errorf("off drew %q", got)
+	}
+}
+
+func TestCachedPoster(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	var poster bytes.Buffer
+	if err := png.Encode(&poster, testPoster(20, 30)); err != nil {
+		t.Fatal(err)
+	}
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/one-piece.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(poster.Bytes())
+	}))
+	t.Cleanup(server.Close)
+
+	for i := range 2 {
+		img, err := cachedPoster(server.URL + "/one-piece.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 30 {
+			t.Errorf("poster is %v, want 20x30", b)
+		}
+		if hits != 1 {
+			t.Errorf("after %d loads the poster was downloaded %d times, want once", i+1, hits)
+		}
+	}
+
+	dir, err := getCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files, err := os.ReadDir(dir); err != nil || len(files) != 1 || !strings.HasSuffix(files[0].Name(), ".png") {
+		t.Errorf("cache = %v, %v, want the png", files, err)
+	}
+
+	if _, err := cachedPoster(server.URL + "/missing.png"); err == nil {
+		t.Error("loading a missing poster worked")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("cache has %d files, want the failed download left out", len(files))
+	}
+}
+
+func TestPrunePosterCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	posters := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"new.png", posterCacheSize / 2, 0},
+		{"used.png", posterCacheSize / 2, time.Hour},
+		// past the size of the cache, the least recently used goes
+		{"full.png", 10, 2 * time.Hour},
+		{"old.png", 10, posterCacheAge + time.Hour},
+	}
+	for _, p := range posters {
+		file := filepath.Join(dir, p.name)
+		if err := os.WriteFile(file, make([]byte, p.size), 0664); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, now.Add(-p.age), now.Add(-p.age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prunePosterCache(dir, now)
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, f := range files {
+		kept = append(kept, f.Name())
+	}
+	if want := []string{"new.png", "used.png"}; !slices.Equal(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+}
+
+func TestFetchAnimeInfoPoster(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want string
+	}{
+		{"info without a poster", `{"anime": {"id": "one-piece-100"}}`, "https://cdn.example/list.jpg"},
+		{"info with a poster", `{"anime": {"id": "one-piece-100", "poster": "https://cdn.example/info.jpg"}}`, "https://cdn.example/info.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeAPI(t, fakeAPI{"/qtip/one-piece-100": tt.info})
+			msg, ok := fetchAnimeInfo("one-piece-100", "https://cdn.example/list.jpg").(animeInfoMsg)
+			if !ok {
+				t.Fatalf("fetchAnimeInfo = %#v", msg)
+			}
+			if msg.anime.Poster != tt.want {
+				t.Errorf("poster = %q, want %q", msg.anime.Poster, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+)
+
+// useProxy routes streams through a local proxy that adds the referer header,
+// so players that can't send headers can still play them
+var useProxy bool
+
+var (
+	proxyOnce     sync.Once
+	proxyInstance *streamProxy
+	proxyErr      error
+)
+
+// headers copied from the upstream response to the player
+var proxiedHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"}
+
+// streamProxy only fetches the urls it wrapped, they carry a token made up when it starts
+// so nothing else on the machine can use it to fetch arbitrary urls
+type streamProxy struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// getProxy starts the proxy on first use and returns the running instance
+func getProxy() (*streamProxy, error) {
+	proxyOnce.Do(func() {
+		proxyInstance, proxyErr = startProxy()
+	})
+	return proxyInstance, proxyErr
+}
+
+func startProxy() (*streamProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start stream proxy: %w", err)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to start stream proxy: %w", err)
+	}
+
+	p := &streamProxy{addr: listener.Addr().String(), token: hex.EncodeToString(token), client: &http.Client{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", p.handleStream)
+
+	go http.Serve(listener, mux)
+
+	return p, nil
+}
+
+// wrap turns an upstream url into a url served by the proxy
+func (p *streamProxy) wrap(target string) string {
+	return fmt.Sprintf("http://%s/stream?t=%s&u=%s", p.addr, p.token, neturl.QueryEscape(target))
+}
+
+func (p *streamProxy) handleStream(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("t")), []byte(p.token)) != 1 {
+		http.Error(w, "unknown stream", http.StatusForbidden)
+		return
+	}
+
+	target, err := neturl.Parse(r.URL.Query().Get("u"))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		http.Error(w, "invalid stream url", http.StatusBadRequest)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Header.Set("Referer", streamReferer)
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+
+	if isPlaylist(target, res) {
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		playlist := p.rewritePlaylist(target, string(body))
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.WriteHeader(res.StatusCode)
+		io.WriteString(w, playlist)
+		return
+	}
+
+	for _, header := range proxiedHeaders {
+		if value := res.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+func isPlaylist(target *neturl.URL, res *http.Response) bool {
+	contentType := strings.ToLower(res.Header.Get("Content-Type"))
+	return strings.Contains(contentType, "mpegurl") || strings.HasSuffix(target.Path, ".m3u8")
+}
+
+// rewritePlaylist points every segment, key and nested playlist back at the proxy
+func (p *streamProxy) rewritePlaylist(base *neturl.URL, playlist string) string {
+	var out strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(playlist))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			out.WriteString(line)
+
+		case strings.HasPrefix(trimmed, "#"):
+			// tags like #EXT-X-KEY and #EXT-X-MAP carry their uri in an attribute
+			out.WriteString(p.rewriteURIAttribute(base, line))
+
+		default:
+			out.WriteString(p.wrap(resolveURL(base, trimmed)))
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
+
+func (p *streamProxy) rewriteURIAttribute(base *neturl.URL, line string) string {
+	start := strings.Index(line, `URI="`)
+	if start < 0 {
+		return line
+	}
+	start += len(`URI="`)
+
+	end := strings.Index(line[start:], `"`)
+	if end < 0 {
+		return line
+	}
+	end += start
+
+	return line[:start] + p.wrap(resolveURL(base, line[start:end])) + line[end:]
+}
+
+func resolveURL(base *neturl.URL, ref string) string {
+	u, err := neturl.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
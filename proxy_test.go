@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+)
+
+func TestRewritePlaylist(t *testing.T) {
+	p := &streamProxy{addr: "127.0.0.1:9000", token: "secret"}
+	base, _ := neturl.Parse("https://cdn.example/hls/720/index.m3u8")
+	wrapped := func(u string) string {
+		return "http://127.0.0.1:9000/stream?t=secret&u=" + neturl.QueryEscape(u)
+	}
+
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{
+			name:     "relative segments",
+			playlist: "#EXTM3U\n#EXTINF:10,\nseg0.ts\n\n#EXT-X-ENDLIST",
+			want:     "#EXTM3U\n#EXTINF:10,\n" + wrapped("https://cdn.example/hls/720/seg0.ts") + "\n\n#EXT-X-ENDLIST\n",
+		},
+		{
+			name:     "absolute segments",
+			playlist: "https://other.example/seg1.ts",
+			want:     wrapped("https://other.example/seg1.ts") + "\n",
+		},
+		{
+			name:     "uri attributes",
+			playlist: `#EXT-X-KEY:METHOD=AES-128,URI="../key.bin",IV=0x1`,
+			want:     `#EXT-X-KEY:METHOD=AES-128,URI="` + wrapped("https://cdn.example/hls/key.bin") + `",IV=0x1` + "\n",
+		},
+		{
+			name:     "tags without uri",
+			playlist: "#EXT-X-TARGETDURATION:10",
+			want:     "#EXT-X-TARGETDURATION:10\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.rewritePlaylist(base, tt.playlist); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleStream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Referer") != streamReferer {
+			http.Error(w, "no referer", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			io.WriteString(w, "#EXTM3U\nseg0.ts\n")
+		default:
+			w.Header().Set("Content-Range", r.Header.Get("Range"))
+			io.WriteString(w, "segment")
+		}
+	}))
+	defer upstream.Close()
+
+	p := &streamProxy{addr: "127.0.0.1:9000", token: "secret", client: upstream.Client()}
+
+	tests := []struct {
+		name      string
+		token     string
+		target    string
+		rng       string
+		want      int
+		wantBody  string
+		wantRange string
+	}{
+		{"playlists are rewritten", "secret", upstream.URL + "/index.m3u8", "", http.StatusOK,
+			"#EXTM3U\n" + p.wrap(upstream.URL+"/seg0.ts") + "\n", ""},
+		{"segments are copied with their range", "secret", upstream.URL + "/seg0.ts", "bytes=0-6", http.StatusOK, "segment", "bytes=0-6"},
+		{"only http urls", "secret", "file:///etc/passwd", "", http.StatusBadRequest, "", ""},
+		// urls the proxy didn't wrap are refused before anything is fetched
+		{"no token", "", upstream.URL + "/seg0.ts", "", http.StatusForbidden, "", ""},
+		{"wrong token", "guess", upstream.URL + "/seg0.ts", "", http.StatusForbidden, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := neturl.Values{"u": {tt.target}}
+			if tt.token != "" {
+				query.Set("t", tt.token)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/stream?"+query.Encode(), nil)
+			if tt.rng != "" {
+				req.Header.Set("Range", tt.rng)
+			}
+			rec := httptest.NewRecorder()
+			p.handleStream(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Content-Range"); got != tt.wantRange {
+				t.Errorf("content range = %q, want %q", got, tt.wantRange)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// syncService is a tracker that watchlist changes are pushed to
+type syncService interface {
+	// name is how the service is stored in the sync queue and shown to the user
+	name() string
+	// enabled reports whether the user logged in to the service
+	enabled() bool
+	// push sends the state of an entry, progress is the last watched episode
+	push(entry watchlistEntry, progress int) error
+}
+
+// syncServices are every tracker anigarden can sync with
+var syncServices = []syncService{anilistService{}, malService{}}
+
+// syncInterval is how often queued updates are retried while the tui runs
+const syncInterval = 5 * time.Minute
+
+var syncMu sync.Mutex
+
+// errNoServiceId is returned by push when the anime isn't known to the service,
+// retrying wouldn't help so the update is dropped
+var errNoServiceId = errors.New("anime has no id on this service")
+
+type syncResultMsg struct {
+	pushed  int
+	skipped []string
+	failed  []string
+}
+
+type syncTickMsg struct{}
+
+func enabledSyncServices() []syncService {
+	var services []syncService
+	for _, s := range syncServices {
+		if s.enabled() {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+func findSyncService(name string) (syncService, bool) {
+	for _, s := range syncServices {
+		if s.name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// queueSync marks an anime as changed for every service the user is logged in to,
+// the queue keeps one row per anime and service so only the latest state is pushed.
+// anime the user opted out of syncing are never queued
+func queueSync(animeId string) error {
+	for _, s := range enabledSyncServices() {
+		_, err := db.Exec(`
+		INSERT INTO sync_queue (service, anime_id)
+		SELECT ?, anime_id FROM watchlist WHERE anime_id = ? AND sync = 1
+		ON CONFLICT (service, anime_id) DO UPDATE SET queued_at = CURRENT_TIMESTAMP
+		`, s.name(), animeId)
+		if err != nil {
+			return &storageError{"queue sync of " + animeId, err}
+		}
+	}
+	return nil
+}
+
+type syncJob struct {
+	service  string
+	animeId  string
+	attempts int
+}
+
+func getSyncQueue() ([]syncJob, error) {
+	rows, err := db.Query(`SELECT service, anime_id, attempts FROM sync_queue ORDER BY queued_at`)
+	if err != nil {
+		return nil, &storageError{"get sync queue", err}
+	}
+	defer rows.Close()
+
+	var jobs []syncJob
+	for rows.Next() {
+		var job syncJob
+		if err := rows.Scan(&job.service, &job.animeId, &job.attempts); err != nil {
+			return nil, &storageError{"scan sync queue", err}
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &storageError{"iterate sync queue", err}
+	}
+	return jobs, nil
+}
+
+func finishSyncJob(job syncJob, pushErr error) error {
+	var err error
+	if pushErr == nil {
+		_, err = db.Exec(`DELETE FROM sync_queue WHERE service = ? AND anime_id = ?`, job.service, job.animeId)
+	} else {
+		_, err = db.Exec(`UPDATE sync_queue SET attempts = attempts + 1, last_error = ? WHERE service = ? AND anime_id = ?`,
+			pushErr.Error(), job.service, job.animeId)
+	}
+	if err != nil {
+		return &storageError{"update sync queue", err}
+	}
+	return nil
+}
+
+// getProgress returns the highest watched episode number in the history of an anime
+func getProgress(animeId string) (int, error) {
+	var progress int
+	err := db.QueryRow(`SELECT COALESCE(MAX(episode_number), 0) FROM history WHERE anime_id = ? AND watched = 1`, animeId).Scan(&progress)
+	if err != nil {
+		return 0, &storageError{"get progress of " + animeId, err}
+	}
+	return progress, nil
+}
+
+// processSyncQueue pushes every queued update, failed updates stay queued for the next run
+func processSyncQueue() (syncResultMsg, error) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+
+	var result syncResultMsg
+
+	jobs, err := getSyncQueue()
+	if err != nil {
+		return result, err
+	}
+
+	for _, job := range jobs {
+		service, ok := findSyncService(job.service)
+		if !ok || !service.enabled() {
+			continue
+		}
+
+		entry, err := getWatchlistEntry(job.animeId)
+		if errors.Is(err, errNotInWatchlist) || (err == nil && !entry.sync) {
+			// the anime was removed or opted out before it was synced, there is nothing left to push
+			if err := finishSyncJob(job, nil); err != nil {
+				return result, err
+			}
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		progress, err := getProgress(job.animeId)
+		if err != nil {
+			return result, err
+		}
+
+		pushErr := service.push(entry, progress)
+		if errors.Is(pushErr, errNoServiceId) {
+			result.skipped = append(result.skipped, fmt.Sprintf("%s: %s", job.service, job.animeId))
+			pushErr = nil
+		} else if pushErr != nil {
+			result.failed = append(result.failed, fmt.Sprintf("%s: %s: %v", job.service, job.animeId, pushErr))
+		} else {
+			result.pushed++
+		}
+		if err := finishSyncJob(job, pushErr); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func syncPending() tea.Msg {
+	if len(enabledSyncServices()) == 0 {
+		return nil
+	}
+	result, err := processSyncQueue()
+	if err != nil {
+		return noticeMsg{err: err}
+	}
+	return result
+}
+
+// handleSync queues an anime for syncing and pushes the queue right away
+func handleSync(animeId string) tea.Cmd {
+	if len(enabledSyncServices()) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		if err := queueSync(animeId); err != nil {
+			return noticeMsg{err: err}
+		}
+		return syncPending()
+	}
+}
+
+func scheduleSync() tea.Cmd {
+	return tea.Tick(syncInterval, func(time.Time) tea.Msg { return syncTickMsg{} })
+}
+
+// credentials of a service are kept in a json file per service in the app dir
+func credentialsPath(service string) (string, error) {
+	dir, err := getAppDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, service+".json"), nil
+}
+
+func loadCredentials(service string, v any) error {
+	path, err := credentialsPath(service)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func saveCredentials(service string, v any) error {
+	path, err := credentialsPath(service)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func removeCredentials(service string) error {
+	path, err := credentialsPath(service)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r syncResultMsg) String() string {
+	text := fmt.Sprintf("synced %d updates", r.pushed)
+	if len(r.skipped) > 0 {
+		text += fmt.Sprintf(", skipped %d unknown to the service (%s)", len(r.skipped), strings.Join(r.skipped, "; "))
+	}
+	if len(r.failed) > 0 {
+		text += fmt.Sprintf(", %d failed and will be retried (%s)", len(r.failed), strings.Join(r.failed, "; "))
+	}
+	return text
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// malRequest is a request sent to the myanimelist stub server
+type malRequest struct {
+	method, path, token string
+	form                neturl.Values
+}
+
+// useMalStub logs in to a local myanimelist that answers with handler,
+// the requests it got are appended to requests
+func useMalStub(t *testing.T, expiresAt time.Time, handler func(w http.ResponseWriter, r *http.Request), requests *[]malRequest) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		*requests = append(*requests, malRequest{r.Method, r.URL.Path, r.Header.Get("Authorization"), r.PostForm})
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("ANIGARDEN_MAL_URL", server.URL)
+	t.Setenv("ANIGARDEN_MAL_AUTH_URL", server.URL)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	creds := malCredentials{ClientID: "client", AccessToken: "old", RefreshToken: "refresh", ExpiresAt: expiresAt}
+	if err := saveCredentials("myanimelist", creds); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// malOK answers a token refresh with a new token and every other request with 200
+func malOK(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		w.Write([]byte(`{"access_token": "new", "refresh_token": "refresh2", "expires_in": 3600}`))
+	}
+}
+
+// addSyncedAnime puts one piece in the watchlist with a score and three watched episodes
+func addSyncedAnime(t *testing.T, malId string) {
+	t.Helper()
+	useFakeAPI(t, fakeAPI{"/anime/one-piece-100": `{"anime": {"info": {"id": "one-piece-100", "malId": ` + malId + `}}}`})
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setScore("one-piece-100", 8); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := recordPlayback("one-piece-100", episode{ID: "one-piece-100?ep=" + strconv.Itoa(i), Number: i}, false, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// playback that didn't reach the threshold doesn't count as progress
+	if err := recordPlayback("one-piece-100", episode{ID: "one-piece-100?ep=4", Number: 4}, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncQueue(t *testing.T) {
+	useTestDB(t)
+	var requests []malRequest
+	useMalStub(t, time.Now().Add(time.Hour), malOK, &requests)
+	addSyncedAnime(t, "21")
+
+	if err := queueSync("one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := getWatchlistEntry("one-piece-100")
+	if err != nil || entry.syncState != syncStatePending {
+		t.Fatalf("entry = %+v, %v, want a pending sync", entry, err)
+	}
+
+	result, err := processSyncQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.pushed != 1 || len(result.failed) != 0 || len(result.skipped) != 0 {
+		t.Errorf("result = %+v, want one pushed update", result)
+	}
+
+	want := []malRequest{{
+		method: http.MethodPatch,
+		path:   "/anime/21/my_list_status",
+		token:  "Bearer old",
+		form: neturl.Values{
+			"status":               {"watching"},
+			"num_watched_episodes": {"3"},
+			"score":                {"8"},
+			"num_times_rewatched":  {"0"},
+		},
+	}}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %+v, want %+v", requests, want)
+	}
+	if jobs, err := getSyncQueue(); err != nil || len(jobs) != 0 {
+		t.Errorf("queue = %+v, %v, want the pushed update removed", jobs, err)
+	}
+}
+
+func TestSyncOptOut(t *testing.T) {
+	useTestDB(t)
+	var requests []malRequest
+	useMalStub(t, time.Now().Add(time.Hour), malOK, &requests)
+	addSyncedAnime(t, "21")
+
+	if err := setSync("one-piece-100", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := queueSync("one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := getSyncQueue(); err != nil || len(jobs) != 0 {
+		t.Errorf("queue = %+v, %v, want nothing queued", jobs, err)
+	}
+	if _, err := processSyncQueue(); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 0 {
+		t.Errorf("requests = %+v, want none for an opted out anime", requests)
+	}
+}
+
+func TestSyncFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		malId       string
+		handler     func(w http.ResponseWriter, r *http.Request)
+		wantSkipped int
+		wantFailed  int
+		wantQueued  int
+	}{
+		{"unknown to myanimelist", "0", malOK, 1, 0, 0},
+		{"server error", "21", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			var requests []malRequest
+			useMalStub(t, time.Now().Add(time.Hour), tt.handler, &requests)
+			addSyncedAnime(t, tt.malId)
+
+			if err := queueSync("one-piece-100"); err != nil {
+				t.Fatal(err)
+			}
+			result, err := processSyncQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.skipped) != tt.wantSkipped || len(result.failed) != tt.wantFailed {
+				t.Errorf("result = %+v, want %d skipped and %d failed", result, tt.wantSkipped, tt.wantFailed)
+			}
+			jobs, err := getSyncQueue()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != tt.wantQueued {
+				t.Fatalf("queue = %+v, want %d jobs", jobs, tt.wantQueued)
+			}
+			if tt.wantQueued == 0 {
+				return
+			}
+			if jobs[0].attempts != 1 {
+				t.Errorf("attempts = %d, want 1", jobs[0].attempts)
+			}
+			entry, err := getWatchlistEntry("one-piece-100")
+			if err != nil || entry.syncState != syncStateFailed {
+				t.Errorf("entry = %+v, %v, want a failed sync", entry, err)
+			}
+		})
+	}
+}
+
+func TestMalPushRefreshesExpiredToken(t *testing.T) {
+	useTestDB(t)
+	var requests []malRequest
+	useMalStub(t, time.Now().Add(-time.Hour), malOK, &requests)
+	addSyncedAnime(t, "21")
+
+	entry, err := getWatchlistEntry("one-piece-100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (malService{}).push(entry, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 || requests[0].path != "/token" {
+		t.Fatalf("requests = %+v, want a refresh and then the update", requests)
+	}
+	if got := requests[0].form.Get("grant_type"); got != "refresh_token" {
+		t.Errorf("grant_type = %q", got)
+	}
+	if requests[1].token != "Bearer new" {
+		t.Errorf("update sent with %q, want the refreshed token", requests[1].token)
+	}
+	creds, err := loadMalCredentials()
+	if err != nil || creds.AccessToken != "new" || creds.RefreshToken != "refresh2" {
+		t.Errorf("credentials = %+v, %v, want the refreshed tokens saved", creds, err)
+	}
+}
+
+func TestMalPushUnscored(t *testing.T) {
+	useTestDB(t)
+	var requests []malRequest
+	useMalStub(t, time.Now().Add(time.Hour), malOK, &requests)
+	addSyncedAnime(t, "21")
+	if err := setScore("one-piece-100", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := getWatchlistEntry("one-piece-100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (malService{}).push(entry, 3); err != nil {
+		t.Fatal(err)
+	}
+	// the score on myanimelist is left alone
+	if len(requests) != 1 || requests[0].form.Has("score") {
+		t.Errorf("requests = %+v, want one update without a score", requests)
+	}
+}
+
+func TestMalPushRetriesUnauthorized(t *testing.T) {
+	tests := []struct {
+		name       string
+		revoked    bool // the refreshed token is refused too
+		wantTokens []string
+		wantErr    bool
+	}{
+		{"refreshed", false, []string{"Bearer old", "", "Bearer new"}, false},
+		{"still refused", true, []string{"Bearer old", "", "Bearer new"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestDB(t)
+			var requests []malRequest
+			// the token hasn't expired yet, myanimelist refuses it anyway
+			useMalStub(t, time.Now().Add(time.Hour), func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/token" || (r.Header.Get("Authorization") == "Bearer new" && !tt.revoked) {
+					malOK(w, r)
+					return
+				}
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+			}, &requests)
+			addSyncedAnime(t, "21")
+
+			entry, err := getWatchlistEntry("one-piece-100")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := (malService{}).push(entry, 3); (err != nil) != tt.wantErr {
+				t.Fatalf("push = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var tokens []string
+			for _, r := range requests {
+				tokens = append(tokens, r.token)
+			}
+			if !reflect.DeepEqual(tokens, tt.wantTokens) || requests[1].path != "/token" {
+				t.Errorf("requests = %+v, want the update retried once after a refresh", requests)
+			}
+		})
+	}
+}
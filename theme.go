@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Theme holds the colours of every page. A colour is an ansi number like "205", a hex colour
+// like "#ee6ff8", or a light and a dark colour separated by "|" to follow the terminal background
+type Theme struct {
+	Base           string `toml:"base"`            // built-in theme the missing colours come from, user themes only
+	Accent         string `toml:"accent"`          // spinners, notifications and the filter cursor
+	Primary        string `toml:"primary"`         // background of titles and the active tab
+	OnPrimary      string `toml:"on_primary"`      // text on the primary colour
+	Text           string `toml:"text"`            // item titles
+	Subtle         string `toml:"subtle"`          // item descriptions and the status bar
+	Muted          string `toml:"muted"`           // genres, inactive tabs, help and dimmed items
+	Selected       string `toml:"selected"`        // title of the selected item
+	SelectedSubtle string `toml:"selected_subtle"` // description and border of the selected item
+	Prompt         string `toml:"prompt"`          // filter prompt
+	Error          string `toml:"error"`           // error notifications and banners
+	Warning        string `toml:"warning"`         // warning notifications
+	Filler         string `toml:"filler"`          // filler episodes
+}
+
+// colors returns the colour fields by their config keys
+func (t *Theme) colors() map[string]*string {
+	return map[string]*string{
+		"accent":          &t.Accent,
+		"primary":         &t.Primary,
+		"on_primary":      &t.OnPrimary,
+		"text":            &t.Text,
+		"subtle":          &t.Subtle,
+		"muted":           &t.Muted,
+		"selected":        &t.Selected,
+		"selected_subtle": &t.SelectedSubtle,
+		"prompt":          &t.Prompt,
+		"error":           &t.Error,
+		"warning":         &t.Warning,
+		"filler":          &t.Filler,
+	}
+}
+
+// builtinThemeNames are the built-in themes in the order the switcher lists them
+var builtinThemeNames = []string{"default", "dark", "light", "high-contrast", "nord"}
+
+var builtinThemes = map[string]Theme{
+	// the colours anigarden always had, they follow the terminal background
+	"default": {
+		Accent:         "205",
+		Primary:        "62",
+		OnPrimary:      "230",
+		Text:           "#1a1a1a|#dddddd",
+		Subtle:         "#A49FA5|#777777",
+		Muted:          "#909090|#626262",
+		Selected:       "#EE6FF8",
+		SelectedSubtle: "#F793FF|#AD58B4",
+		Prompt:         "#04B575|#ECFD65",
+		Error:          "196",
+		Warning:        "#af8700|#ffd75f",
+		Filler:         "#d78700|#ffaf5f",
+	},
+	"dark": {
+		Accent:         "#ff79c6",
+		Primary:        "#6272a4",
+		OnPrimary:      "#f8f8f2",
+		Text:           "#f8f8f2",
+		Subtle:         "#8b8fa3",
+		Muted:          "#6272a4",
+		Selected:       "#bd93f9",
+		SelectedSubtle: "#9580d0",
+		Prompt:         "#50fa7b",
+		Error:          "#ff5555",
+		Warning:        "#f1fa8c",
+		Filler:         "#ffb86c",
+	},
+	"light": {
+		Accent:         "#d7005f",
+		Primary:        "#005f87",
+		OnPrimary:      "#ffffff",
+		Text:           "#1c1c1c",
+		Subtle:         "#6c6c6c",
+		Muted:          "#8a8a8a",
+		Selected:       "#af005f",
+		SelectedSubtle: "#d75f87",
+		Prompt:         "#008700",
+		Error:          "#d70000",
+		Warning:        "#af8700",
+		Filler:         "#af5f00",
+	},
+	// only the 16 basic colours at full strength, readable on any palette
+	"high-contrast": {
+		Accent:         "4|11",
+		Primary:        "0|15",
+		OnPrimary:      "15|0",
+		Text:           "0|15",
+		Subtle:         "8|7",
+		Muted:          "8|7",
+		Selected:       "4|11",
+		SelectedSubtle: "4|14",
+		Prompt:         "2|10",
+		Error:          "1|9",
+		Warning:        "3|11",
+		Filler:         "5|13",
+	},
+	"nord": {
+		Accent:         "#88c0d0",
+		Primary:        "#5e81ac",
+		OnPrimary:      "#eceff4",
+		Text:           "#2e3440|#d8dee9",
+		Subtle:         "#4c566a|#81a1c1",
+		Muted:          "#7b88a1|#4c566a",
+		Selected:       "#b48ead",
+		SelectedSubtle: "#8f6f8a|#a3be8c",
+		Prompt:         "#a3be8c",
+		Error:          "#bf616a",
+		Warning:        "#ebcb8b",
+		Filler:         "#d08770",
+	},
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+func validColor(s string) bool {
+	for _, part := range strings.Split(s, "|") {
+		if n, err := strconv.Atoi(part); err == nil {
+			if n < 0 || n > 255 {
+				return false
+			}
+			continue
+		}
+		if !hexColor.MatchString(part) {
+			return false
+		}
+	}
+	return strings.Count(s, "|") <= 1
+}
+
+func color(s string) lipgloss.TerminalColor {
+	if light, dark, ok := strings.Cut(s, "|"); ok {
+		return lipgloss.AdaptiveColor{Light: light, Dark: dark}
+	}
+	return lipgloss.Color(s)
+}
+
+// validateThemes checks the user themes and the theme picked in the config
+func (c config) validateThemes() []string {
+	var errs []string
+	for name, t := range c.Themes {
+		if _, ok := builtinThemes[name]; ok {
+			errs = append(errs, fmt.Sprintf("themes.%s can't replace a built-in theme, give it another name", name))
+		}
+		if t.Base != "" {
+			if _, ok := builtinThemes[t.Base]; !ok {
+				errs = append(errs, fmt.Sprintf("themes.%s.base must be one of %s, got %q", name, strings.Join(builtinThemeNames, ", "), t.Base))
+			}
+		}
+		for key, value := range t.colors() {
+			if *value != "" && !validColor(*value) {
+				errs = append(errs, fmt.Sprintf("themes.%s.%s must be a colour like 205, #ee6ff8 or #1a1a1a|#dddddd, got %q", name, key, *value))
+			}
+		}
+	}
+	if _, err := c.resolveTheme(c.Theme); err != nil {
+		errs = append(errs, err.Error())
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// themeNames lists the built-in themes and then the user themes of the config
+func (c config) themeNames() []string {
+	var names []string
+	for name := range c.Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(slices.Clone(builtinThemeNames), names...)
+}
+
+// resolveTheme returns the theme with the given name, user themes get the colours they leave out from their base
+func (c config) resolveTheme(name string) (Theme, error) {
+	if t, ok := builtinThemes[name]; ok {
+		return t, nil
+	}
+	t, ok := c.Themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("theme must be one of %s, got %q", strings.Join(c.themeNames(), ", "), name)
+	}
+
+	base := t.Base
+	if base == "" {
+		base = "default"
+	}
+	resolved := builtinThemes[base]
+	baseColors := resolved.colors()
+	for key, value := range t.colors() {
+		if *value != "" {
+			*baseColors[key] = *value
+		}
+	}
+	return resolved, nil
+}
+
+// themeName is the theme in use, set from the config or the --theme flag
+var themeName = "default"
+
+var theme = builtinThemes["default"]
+
+// styles built from the theme, applyTheme rebuilds them
+var (
+	accentStyle        lipgloss.Style
+	spinnerStyle       lipgloss.Style
+	titleStyle         lipgloss.Style
+	mutedStyle         lipgloss.Style
+	noticeStyle        lipgloss.Style
+	noticeErrorStyle   lipgloss.Style
+	noticeWarningStyle lipgloss.Style
+	bannerStyle        lipgloss.Style
+	activeTabStyle     lipgloss.Style
+	inactiveTabStyle   lipgloss.Style
+	typeBadgeStyle     lipgloss.Style
+	badgeStyle         lipgloss.Style
+)
+
+func init() {
+	applyTheme(theme)
+}
+
+// applyTheme makes t the theme of new styles, models holding styles are updated by model.restyle
+func applyTheme(t Theme) {
+	theme = t
+	accentStyle = lipgloss.NewStyle().Foreground(color(t.Accent))
+	spinnerStyle = accentStyle
+	titleStyle = lipgloss.NewStyle().Background(color(t.Primary)).Foreground(color(t.OnPrimary)).Padding(0, 1)
+	mutedStyle = lipgloss.NewStyle().Foreground(color(t.Muted))
+	noticeStyle = lipgloss.NewStyle().Foreground(color(t.Accent)).Padding(0, 1)
+	noticeErrorStyle = lipgloss.NewStyle().Foreground(color(t.Error)).Padding(0, 1)
+	noticeWarningStyle = lipgloss.NewStyle().Foreground(color(t.Warning)).Padding(0, 1)
+	bannerStyle = lipgloss.NewStyle().Background(color(t.Error)).Foreground(color(t.OnPrimary)).Padding(0, 1)
+	activeTabStyle = titleStyle
+	inactiveTabStyle = mutedStyle.Padding(0, 1)
+	typeBadgeStyle = titleStyle
+	badgeStyle = lipgloss.NewStyle().Foreground(color(t.Subtle))
+}
+
+func newSpinner() spinner.Model {
+	s := spinner.New()
+	s.Spinner = spinner.Points
+	s.Style = spinnerStyle
+	return s
+}
+
+// newDelegate is the list delegate with the item colours of the theme
+func newDelegate() list.DefaultDelegate {
+	d := list.NewDefaultDelegate()
+	d.Styles.NormalTitle = d.Styles.NormalTitle.Foreground(color(theme.Text))
+	d.Styles.NormalDesc = d.Styles.NormalDesc.Foreground(color(theme.Subtle))
+	d.Styles.SelectedTitle = d.Styles.SelectedTitle.Foreground(color(theme.Selected)).BorderForeground(color(theme.SelectedSubtle))
+	d.Styles.SelectedDesc = d.Styles.SelectedTitle.Foreground(color(theme.SelectedSubtle))
+	d.Styles.DimmedTitle = d.Styles.DimmedTitle.Foreground(color(theme.Muted))
+	d.Styles.DimmedDesc = d.Styles.DimmedDesc.Foreground(color(theme.Muted))
+	return d
+}
+
+// newList creates a list drawn with the theme, sized later with SetSize
+func newList(items []list.Item) list.Model {
+	l := list.New(items, newDelegate(), 0, 0)
+	l.KeyMap = listKeyMap()
+	setListStyles(&l)
+	return l
+}
+
+func setListStyles(l *list.Model) {
+	l.Styles.Title = titleStyle
+	l.Styles.FilterPrompt = l.Styles.FilterPrompt.Foreground(color(theme.Prompt))
+	l.Styles.FilterCursor = l.Styles.FilterCursor.Foreground(color(theme.Accent))
+	l.Styles.StatusBar = l.Styles.StatusBar.Foreground(color(theme.Subtle))
+	l.Styles.StatusBarActiveFilter = l.Styles.StatusBarActiveFilter.Foreground(color(theme.Text))
+	l.Styles.NoItems = mutedStyle
+	l.Styles.ActivePaginationDot = l.Styles.ActivePaginationDot.Foreground(color(theme.Text))
+	l.Styles.InactivePaginationDot = l.Styles.InactivePaginationDot.Foreground(color(theme.Muted))
+	l.FilterInput.PromptStyle = l.Styles.FilterPrompt
+	l.FilterInput.Cursor.Style = l.Styles.FilterCursor
+	l.Paginator.ActiveDot = l.Styles.ActivePaginationDot.String()
+	l.Paginator.InactiveDot = l.Styles.InactivePaginationDot.String()
+	l.Help.Styles.ShortKey = mutedStyle
+	l.Help.Styles.FullKey = mutedStyle
+	l.Help.Styles.ShortDesc = l.Help.Styles.ShortDesc.Foreground(color(theme.Subtle))
+	l.Help.Styles.FullDesc = l.Help.Styles.FullDesc.Foreground(color(theme.Subtle))
+}
+
+// restyleList redraws a list that was created before the theme changed, d is its delegate built again
+func restyleList(l *list.Model, d list.ItemDelegate) {
+	l.SetDelegate(d)
+	setListStyles(l)
+}
+
+type themeItem string
+
+// list.item implementation
+func (t themeItem) Title() string {
+	return string(t)
+}
+
+func (t themeItem) Description() string {
+	if _, ok := builtinThemes[string(t)]; ok {
+		return "built-in"
+	}
+	return "from config.toml"
+}
+
+func (t themeItem) FilterValue() string {
+	return string(t)
+}
+
+// theme picker, moving through the themes previews them and esc goes back to the one in use before
+type themePickerModel struct {
+	list     list.Model
+	previous string
+	done     bool
+}
+
+func initThemePicker(width, height int) themePickerModel {
+	names := cfg.themeNames()
+	items := make([]list.Item, len(names))
+	for i, name := range names {
+		items[i] = themeItem(name)
+	}
+
+	l := newList(items)
+	l.Title = "Theme"
+	l.SetFilteringEnabled(false)
+	l.SetShowHelp(false)
+	l.Select(slices.Index(names, themeName))
+
+	w, v := docStyle.GetFrameSize()
+	l.SetSize(width-w, height-v)
+
+	return themePickerModel{list: l, previous: themeName}
+}
+
+// setTheme switches to the theme with the given name
+func setTheme(name string) error {
+	t, err := cfg.resolveTheme(name)
+	if err != nil {
+		return err
+	}
+	themeName = name
+	applyTheme(t)
+	return nil
+}
+
+func (p themePickerModel) Update(msg tea.Msg) (themePickerModel, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch {
+		case key.Matches(msg, keys.Select):
+			p.done = true
+			name := themeName
+			return p, func() tea.Msg {
+				return noticeMsg{text: fmt.Sprintf("using the %s theme, set theme = %q in config.toml to keep it", name, name)}
+			}
+
+		case key.Matches(msg, keys.Cancel, keys.Quit):
+			p.done = true
+			setTheme(p.previous)
+			return p, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	p.list, cmd = p.list.Update(msg)
+	if selected, ok := p.list.SelectedItem().(themeItem); ok && string(selected) != themeName {
+		if err := setTheme(string(selected)); err != nil {
+			return p, func() tea.Msg { return noticeMsg{err: err} }
+		}
+		restyleList(&p.list, newDelegate())
+	}
+	return p, cmd
+}
+
+func (p themePickerModel) View() string {
+	return docStyle.Render(p.list.View())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestValidColor(t *testing.T) {
+	tests := []struct {
+		color string
+		want  bool
+	}{
+		{"205", true},
+		{"0", true},
+		{"256", false},
+		{"-1", false},
+		{"#ee6ff8", true},
+		{"#fff", true},
+		{"#ee6ff", false},
+		{"ee6ff8", false},
+		{"#1a1a1a|#dddddd", true},
+		{"236|#dddddd", true},
+		{"#1a1a1a|#dddddd|#000000", false},
+		{"red", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color, func(t *testing.T) {
+			if got := validColor(tt.color); got != tt.want {
+				t.Errorf("validColor(%q) = %v, want %v", tt.color, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveTheme(t *testing.T) {
+	c := defaultConfig()
+	c.Themes = map[string]Theme{
+		"mine":    {Accent: "#ff0000"},
+		"my-nord": {Base: "nord", Error: "1"},
+	}
+
+	tests := []struct {
+		name    string
+		want    func() Theme
+		wantErr bool
+	}{
+		{"light", func() Theme { return builtinThemes["light"] }, false},
+		{"mine", func() Theme {
+			t := builtinThemes["default"]
+			t.Accent = "#ff0000"
+			return t
+		}, false},
+		{"my-nord", func() Theme {
+			t := builtinThemes["nord"]
+			t.Error = "1"
+			return t
+		}, false},
+		{"nope", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.resolveTheme(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want()) {
+				t.Errorf("resolveTheme(%q) = %+v, want %+v", tt.name, got, tt.want())
+			}
+		})
+	}
+
+	// resolving a user theme leaves the built-in theme it's based on alone
+	if builtinThemes["nord"].Error == "1" {
+		t.Error("resolving my-nord changed the nord theme")
+	}
+}
+
+func TestValidateThemes(t *testing.T) {
+	tests := []struct {
+		name   string
+		themes map[string]Theme
+		theme  string
+		want   []string
+	}{
+		{"valid", map[string]Theme{"mine": {Base: "dark", Text: "#fff"}}, "mine", nil},
+		{"replaces a built-in theme", map[string]Theme{"nord": {}}, "default", []string{"themes.nord can't replace a built-in theme"}},
+		{"unknown base", map[string]Theme{"mine": {Base: "solarized"}}, "default", []string{"themes.mine.base must be one of"}},
+		{"bad colour", map[string]Theme{"mine": {Accent: "pink"}}, "default", []string{"themes.mine.accent must be a colour"}},
+		{"unknown theme", nil, "mine", []string{`got "mine"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := defaultConfig()
+			c.Themes, c.Theme = tt.themes, tt.theme
+			errs := c.validateThemes()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("validateThemes() = %q, want %d errors", errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i], want) {
+					t.Errorf("error %d = %q, want it to mention %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestThemePicker(t *testing.T) {
+	t.Cleanup(func() { setTheme("default") })
+
+	p := initThemePicker(80, 24)
+	p, _ = p.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if themeName != "dark" || theme != builtinThemes["dark"] {
+		t.Fatalf("theme = %q, want moving down to preview dark", themeName)
+	}
+
+	// esc goes back to the theme from before the picker
+	p, _ = p.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if !p.done || themeName != "default" || theme != builtinThemes["default"] {
+		t.Errorf("done = %v, theme = %q, want the picker closed on default", p.done, themeName)
+	}
+
+	p = initThemePicker(80, 24)
+	p, _ = p.Update(tea.KeyMsg{Type: tea.KeyDown})
+	p, cmd := p.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !p.done || themeName != "dark" {
+		t.Errorf("done = %v, theme = %q, want the picker closed on dark", p.done, themeName)
+	}
+	if msg, ok := cmd().(noticeMsg); !ok || !strings.Contains(msg.text, `theme = "dark"`) {
+		t.Errorf("notice = %#v, want it to tell how to keep the theme", msg)
+	}
+}
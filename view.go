@@ -1,13 +1,20 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"image"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -22,49 +29,152 @@ const (
 )
 
 // helper functions
+// selectedAnime returns the selected anime of lists holding anime or watchlist items
+func selectedAnime(l list.Model) (anime, bool) {
+	return itemAnime(l.SelectedItem())
+}
+
+func itemAnime(item list.Item) (anime, bool) {
+	switch item := item.(type) {
+	case anime:
+		return item, true
+	case watchlistItem:
+		return item.anime, true
+	}
+	return anime{}, false
+}
+
+// listState is what's kept of a list of anime when it's rebuilt, so it's found as it was left
+type listState struct {
+	filter   string
+	selected string // id of the selected anime
+	index    int
+}
+
+func saveListState(l list.Model) listState {
+	state := listState{index: l.Index()}
+	if l.FilterState() == list.FilterApplied {
+		state.filter = l.FilterValue()
+	}
+	if selected, ok := selectedAnime(l); ok {
+		state.selected = selected.ID
+	}
+	return state
+}
+
+// restore applies the filter again and selects the same anime, or the same row when it's gone
+func (s listState) restore(l *list.Model) {
+	if s.filter != "" {
+		l.SetFilterText(s.filter)
+	}
+	index := s.index
+	for i, item := range l.VisibleItems() {
+		if a, ok := itemAnime(item); ok && a.ID == s.selected {
+			index = i
+			break
+		}
+	}
+	l.Select(min(index, max(len(l.VisibleItems())-1, 0)))
+}
+
 // function to get selected anime and shove it into fetchAnimeInfo or watchAnime or addAnimeToWatchlist
 func handleGetAnimeInfo(l list.Model) tea.Cmd {
-	if selected, ok := l.SelectedItem().(anime); ok {
-		return func() tea.Msg { return fetchAnimeInfo(selected.ID) }
+	if selected, ok := selectedAnime(l); ok {
+		return retryable(func() tea.Msg { return fetchAnimeInfo(selected.ID, selected.Poster) })
 	}
 	return nil
 }
 
 func handleWatchAnime(l list.Model, animeId, lang, client string) tea.Cmd {
 	if selected, ok := l.SelectedItem().(episode); ok {
-		return func() tea.Msg { return watchAnime(selected.ID, animeId, lang, client) }
+		return retryable(func() tea.Msg { return watchAnime(selected, animeId, lang, client) })
 	}
 	return nil
 }
 
-func handleAddToWatchlist(l list.Model) {
-	if selected, ok := l.SelectedItem().(anime); ok {
-		addAnimeToWatchlist(selected.ID)
+// handleRecordPlayback saves a playback to the history once the player is done with it,
+// a watched episode is pushed to the trackers right away
+func handleRecordPlayback(msg playerExitMsg) tea.Cmd {
+	return func() tea.Msg {
+		if err := savePlayback(msg.animeId, msg.ep, msg.watched); err != nil {
+			return noticeMsg{err: err}
+		}
+		if !msg.watched {
+			return nil
+		}
+		if cmd := handleSync(msg.animeId); cmd != nil {
+			return cmd()
+		}
+		return nil
+	}
+}
+
+func handlePickQuality(l list.Model, lang string) tea.Cmd {
+	if selected, ok := l.SelectedItem().(episode); ok {
+		return retryable(func() tea.Msg { return fetchQualities(selected, lang) })
+	}
+	return nil
+}
+
+func handleWatchVariant(l list.Model, subFile, animeId string, ep episode, client string) tea.Cmd {
+	if selected, ok := l.SelectedItem().(variant); ok {
+		return retryable(func() tea.Msg { return watchVariant(selected, subFile, animeId, ep, client) })
 	}
+	return nil
+}
+
+func handleRemoveFromWatchlist(l list.Model, listId int) tea.Cmd {
+	if selected, ok := selectedAnime(l); ok {
+		return func() tea.Msg {
+			if err := removeAnimeFromList(listId, selected.ID); err != nil {
+				return noticeMsg{err: err}
+			}
+			return fetchWatchlist(listId)
+		}
+	}
+	return nil
+}
+
+// handleUpdateEntry runs update and sends the updated watchlist entry of animeId
+func handleUpdateEntry(animeId string, update func() error) tea.Cmd {
+	return tea.Sequence(func() tea.Msg {
+		if err := update(); err != nil {
+			if errors.Is(err, errNotInWatchlist) {
+				return noticeMsg{text: "add the anime to your watchlist first", warn: true}
+			}
+			return noticeMsg{err: err}
+		}
+		return fetchWatchlistEntry(animeId)
+	}, handleSync(animeId))
 }
 
-func handleRemoveFromWatchlist(l list.Model) {
-	if selected, ok := l.SelectedItem().(anime); ok {
-		removeAnimeFromWatchlist(selected.ID)
+func handleChangeStatus(l list.Model) tea.Cmd {
+	if selected, ok := l.SelectedItem().(watchlistItem); ok {
+		status := selected.status.next()
+		return handleUpdateEntry(selected.ID, func() error { return setWatchStatus(selected.ID, status) })
 	}
+	return nil
 }
 
 func setCustomHelp(l *list.Model, page page) {
+	// the list enables its quit key again whenever its filter changes, so it gets the remapped one
+	l.KeyMap.Quit = keys.Quit
+
 	switch page {
 	case homePage:
 		l.AdditionalShortHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Search, keys.Watchlist, keys.AddToWatchlist}
+			return []key.Binding{keys.Search, keys.Watchlist, keys.AddToList}
 		}
 		l.AdditionalFullHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Search, keys.Watchlist, keys.AddToWatchlist, keys.Info}
+			return []key.Binding{keys.Search, keys.Watchlist, keys.AddToList, keys.Info, keys.ToggleRows, keys.Back, keys.ReloadConfig, keys.PickTheme}
 		}
 
 	case searchPage:
 		l.AdditionalShortHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Home, keys.Watchlist, keys.AddToWatchlist}
+			return []key.Binding{keys.Home, keys.Watchlist, keys.AddToList}
 		}
 		l.AdditionalFullHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Home, keys.Watchlist, keys.Focus, keys.Info}
+			return []key.Binding{keys.Home, keys.Watchlist, keys.Focus, keys.Info, keys.ToggleRows, keys.Back, keys.ReloadConfig, keys.PickTheme}
 		}
 
 	case infoPage:
@@ -72,15 +182,16 @@ func setCustomHelp(l *list.Model, page page) {
 			return []key.Binding{keys.ToggleDub, keys.ToggleClient, keys.Watch, keys.Home, keys.Search, keys.Watchlist}
 		}
 		l.AdditionalFullHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Home, keys.Search, keys.Watchlist, keys.ToggleDub, keys.Watch, keys.ToggleClient}
+			return []key.Binding{keys.Home, keys.Search, keys.Watchlist, keys.ToggleDub, keys.Watch, keys.ToggleClient, keys.Quality, keys.ScoreUp, keys.ScoreDown, keys.EditNotes, keys.Rewatch, keys.ToggleSync, keys.EditMapping, keys.SwitchFocus, keys.JumpToEpisode, keys.NextUnwatched, keys.ToggleFiller, keys.NextRange, keys.PrevRange, keys.Back, keys.ReloadConfig, keys.PickTheme}
 		}
 
 	case watchlistPage:
 		l.AdditionalShortHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Home, keys.Search, keys.RemoveFromWatchlist}
+			return []key.Binding{keys.Home, keys.Search, keys.ChangeStatus, keys.NextStatusTab}
 		}
 		l.AdditionalFullHelpKeys = func() []key.Binding {
-			return []key.Binding{keys.Home, keys.Search, keys.RemoveFromWatchlist, keys.Info}
+			return []key.Binding{keys.Home, keys.Search, keys.RemoveFromWatchlist, keys.Info, keys.ChangeStatus, keys.NextStatusTab, keys.PrevStatusTab, keys.Sort,
+				keys.NextList, keys.PrevList, keys.FilterTag, keys.EditTags, keys.DeleteList, keys.Export, keys.Import, keys.PullAnilist, keys.ToggleSync, keys.ToggleRows, keys.Back, keys.ReloadConfig, keys.PickTheme}
 		}
 	}
 }
@@ -89,16 +200,14 @@ func setCustomHelp(l *list.Model, page page) {
 type homeModel struct {
 	list    list.Model
 	spinner spinner.Model
-	err     error
 	loaded  bool
+	compact bool
 	width   int
 	height  int
 }
 
 func initHomeModel() homeModel {
-	s := spinner.New()
-	s.Spinner = spinner.Points
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	s := newSpinner()
 	return homeModel{spinner: s}
 }
 
@@ -117,7 +226,7 @@ func (h homeModel) Update(msg tea.Msg) (homeModel, tea.Cmd) {
 		for i, a := range msg.animes {
 			items[i] = a
 		}
-		l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+		l := newAnimeList(items, h.compact)
 		l.Title = "Home"
 
 		// update list size
@@ -133,16 +242,13 @@ func (h homeModel) Update(msg tea.Msg) (homeModel, tea.Cmd) {
 		if h.list.FilterState() == list.Filtering {
 			break
 		}
-		switch msg.String() {
-		case " ", "enter":
+		switch {
+		case key.Matches(msg, keys.Info):
 			return h, handleGetAnimeInfo(h.list)
 
-		case "a":
-			handleAddToWatchlist(h.list)
+		case key.Matches(msg, keys.AddToList):
+			return h, handleOpenListPicker(h.list)
 		}
-
-	case errMsg:
-		h.err = msg.err
 	}
 
 	if !h.loaded {
@@ -160,9 +266,6 @@ func (h homeModel) View() string {
 	if !h.loaded {
 		return docStyle.Render(fmt.Sprintf("%s loading anime list...", h.spinner.View()))
 	}
-	if h.err != nil {
-		return docStyle.Render(h.err.Error())
-	}
 	return docStyle.Render(h.list.View())
 }
 
@@ -172,8 +275,8 @@ type searchModel struct {
 	list      list.Model
 	spinner   spinner.Model
 	spinning  bool
-	err       error
 	loaded    bool
+	compact   bool
 	width     int
 	height    int
 }
@@ -184,9 +287,7 @@ func initSearchModel() searchModel {
 	ti.Width = 20
 	ti.Cursor.Blink = true
 
-	s := spinner.New()
-	s.Spinner = spinner.Points
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
+	s := newSpinner()
 	return searchModel{textInput: ti, spinner: s}
 }
 
@@ -194,29 +295,29 @@ func (s searchModel) Update(msg tea.Msg) (searchModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if s.textInput.Focused() {
-			switch msg.String() {
-			case "enter":
+			switch {
+			case key.Matches(msg, keys.Confirm):
 				name := s.textInput.Value()
 				s.spinner.Tick()
 				s.spinning = true
-				return s, tea.Batch(s.spinner.Tick, func() tea.Msg { return searchAnime(name) })
-			case "esc":
+				return s, tea.Batch(s.spinner.Tick, retryable(func() tea.Msg { return searchAnime(name) }))
+			case key.Matches(msg, keys.Cancel):
 				s.textInput.Blur()
 				return s, nil
 			}
 		}
 		if !s.textInput.Focused() && s.list.FilterState() != list.Filtering {
 			// when neither input nor filter is focused, allow `t` to focus textInput
-			switch msg.String() {
-			case "t":
+			switch {
+			case key.Matches(msg, keys.Focus):
 				s.textInput.Focus()
 				return s, nil
 
-			case " ", "enter":
+			case key.Matches(msg, keys.Info):
 				return s, handleGetAnimeInfo(s.list)
 
-			case "a":
-				handleAddToWatchlist(s.list)
+			case key.Matches(msg, keys.AddToList):
+				return s, handleOpenListPicker(s.list)
 			}
 		}
 
@@ -225,7 +326,7 @@ func (s searchModel) Update(msg tea.Msg) (searchModel, tea.Cmd) {
 		s.height = msg.Height
 		if s.loaded {
 			w, h := docStyle.GetFrameSize()
-			s.list.SetSize(s.width-w, s.height-h)
+			s.list.SetSize(s.width-w, s.height-h-1) // leave room for the search bar
 		}
 
 	case searchResultsMsg:
@@ -233,22 +334,23 @@ func (s searchModel) Update(msg tea.Msg) (searchModel, tea.Cmd) {
 		for i, a := range msg.animes {
 			items[i] = a
 		}
-		l := list.New(items, list.NewDefaultDelegate(), 10, 10)
+		l := newAnimeList(items, s.compact)
 		l.Title = "Results"
 
 		setCustomHelp(&l, searchPage)
 
 		// Get doc padding
 		w, v := docStyle.GetFrameSize()
-		l.SetSize(s.width-w, s.height-v)
+		l.SetSize(s.width-w, s.height-v-1)
 
 		s.list = l
 		s.textInput.Blur()
 		s.loaded = true
 		s.spinning = false
 
+	// the error is on the banner, the search bar is usable again
 	case errMsg:
-		s.err = msg.err
+		s.spinning = false
 		return s, nil
 	}
 
@@ -272,9 +374,6 @@ func (s searchModel) Update(msg tea.Msg) (searchModel, tea.Cmd) {
 }
 
 func (s searchModel) View() string {
-	if s.err != nil {
-		return docStyle.Render(s.err.Error())
-	}
 	if s.spinning {
 		return docStyle.Render(fmt.Sprintf("%s\n%s searching...", s.textInput.View(), s.spinner.View()))
 	}
@@ -286,55 +385,392 @@ func (s searchModel) View() string {
 
 // info page
 type infoModel struct {
-	id         string
-	name       string
-	body       string
-	genres     []string
-	lang       string
-	client     string
-	err        error
-	leftWidth  int
-	rightWidth int
-	height     int
-	list       list.Model
-	spinner    spinner.Model
-	spinning   bool
-	loaded     bool
-}
-
-func initInfoModel(anime anime, width int, height int) infoModel {
-	leftWidth := int(float64(width) * 0.4)
-	rightWidth := width - leftWidth
-	s := spinner.New()
-	s.Spinner = spinner.Points
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-
-	return infoModel{
-		id:         anime.ID,
-		name:       anime.Name,
-		body:       anime.Body,
-		genres:     anime.Genres,
-		lang:       "sub",
-		client:     "browser",
-		leftWidth:  leftWidth,
-		rightWidth: rightWidth,
-		height:     height,
-		spinner:    s,
-		loaded:     false,
+	id       string
+	name     string
+	body     string
+	genres   []string
+	lang     string
+	client   string
+	layout   infoLayout
+	list     list.Model
+	spinner  spinner.Model
+	spinning bool
+	activity string
+	loaded   bool
+
+	// every episode of the anime, shown leaves filler out while it's hidden
+	// and the list only holds the shown episodes of the selected range,
+	// or all of them while its filter is on (allShown)
+	episodes   []episode
+	shown      []episode
+	hideFiller bool
+	ranges     []episodeRange
+	rangeIdx   int
+	allShown   bool
+	watched    map[int]bool
+	jump       textinput.Model
+	jumping    bool
+
+	// watchlist entry, only set when the anime is in the watchlist
+	entry        watchlistEntry
+	inWatchlist  bool
+	notes        textarea.Model
+	editingNotes bool
+
+	// tracker ids, editable to fix mismatches
+	ids            animeIds
+	mapping        textinput.Model
+	editingMapping bool
+
+	// poster, drawn once for the width of the left pane
+	poster     image.Image
+	posterView string
+
+	// the left pane scrolls, tab moves the scroll keys between it, the range sidebar and the episodes.
+	// left is what it was last laid out from
+	desc  viewport.Model
+	left  leftPane
+	focus infoFocus
+
+	// quality picker
+	qualities      list.Model
+	qualityEpisode episode
+	subFile        string
+	picking        bool
+}
+
+// infoFocus is the pane of the info page the scroll keys go to
+type infoFocus int
+
+const (
+	focusEpisodes infoFocus = iota
+	focusRanges
+	focusDescription
+)
+
+// descKeyMap scrolls the description with the scroll keys of the config
+func descKeyMap() viewport.KeyMap {
+	return viewport.KeyMap{
+		PageDown:     keys.ScrollPageDown,
+		PageUp:       keys.ScrollPageUp,
+		HalfPageUp:   keys.ScrollHalfPageUp,
+		HalfPageDown: keys.ScrollHalfPageDown,
+		Up:           keys.ScrollUp,
+		Down:         keys.ScrollDown,
 	}
 }
 
+func initInfoModel(anime anime, lang, client string, width int, height int) infoModel {
+	s := newSpinner()
+
+	desc := viewport.New(0, 0)
+	desc.KeyMap = descKeyMap()
+
+	i := infoModel{
+		id:      anime.ID,
+		name:    anime.Name,
+		body:    cleanDescription(anime.Body),
+		desc:    desc,
+		genres:  anime.Genres,
+		lang:    lang,
+		client:  client,
+		spinner: s,
+		loaded:  false,
+	}
+	i.resize(width, height)
+	return i
+}
+
+// resize lays every pane out again for a window of the given size
+func (i *infoModel) resize(width, height int) {
+	i.layout = computeInfoLayout(width, height)
+	l := i.layout
+
+	i.desc.Width, i.desc.Height = l.descWidth, l.descHeight
+	i.posterView = renderPoster(i.poster, l.descWidth, imageMode())
+	if i.editingNotes {
+		i.notes.SetWidth(l.descWidth)
+	}
+	if i.editingMapping {
+		i.mapping.Width = l.descWidth
+	}
+	if i.jumping {
+		i.jump.Width = l.listWidth
+	}
+	if i.loaded {
+		i.list.SetSize(i.episodesWidth(), i.episodesHeight())
+	}
+	if i.picking {
+		i.qualities.SetSize(l.listWidth, l.listHeight)
+	}
+}
+
+// episodesWidth is what's left of the right pane for the episodes, next to the range sidebar of long series
+func (i infoModel) episodesWidth() int {
+	if len(i.ranges) > 1 {
+		return max(i.layout.listWidth-rangeWidth, 1)
+	}
+	return i.layout.listWidth
+}
+
+// episodesHeight leaves a line of the right pane to the episode summary
+func (i infoModel) episodesHeight() int {
+	return max(i.layout.listHeight-1, 1)
+}
+
+// showEpisodes splits the episodes that aren't hidden into ranges, the cursor goes to the
+// episode with the given number or the closest one shown after it
+func (i *infoModel) showEpisodes(number int) {
+	i.shown = i.episodes
+	if i.hideFiller {
+		i.shown = withoutFiller(i.episodes)
+	}
+	i.ranges = episodeRanges(i.shown)
+	i.list.SetSize(i.episodesWidth(), i.episodesHeight())
+	if len(i.ranges) <= 1 && i.focus == focusRanges {
+		i.focus = focusEpisodes
+	}
+
+	index := slices.IndexFunc(i.shown, func(ep episode) bool { return ep.Number >= number })
+	if index < 0 {
+		index = max(len(i.shown)-1, 0)
+	}
+	i.selectEpisode(index)
+}
+
+// showRange puts the episodes of range r in the list with the cursor on the index-th of them
+func (i *infoModel) showRange(r, index int) {
+	rng := i.ranges[r]
+	i.rangeIdx = r
+	i.allShown = false
+	i.list.Title = "Episodes"
+	if len(i.ranges) > 1 {
+		i.list.Title += " " + rng.label(i.shown)
+	}
+	i.list.ResetFilter()
+	i.list.SetItems(episodeItems(i.shown[rng.start:rng.end]))
+	i.list.Select(index)
+}
+
+// selectEpisode moves the cursor to the index-th episode of the anime, switching to its range
+func (i *infoModel) selectEpisode(index int) {
+	r := index / episodeRangeSize
+	i.showRange(r, index-i.ranges[r].start)
+}
+
+// filterAcross fills the list with every shown episode when its filter opens, so it searches them all,
+// and goes back to the range of the episode that was selected once the filter is cleared
+func (i *infoModel) filterAcross(before list.FilterState, number int) tea.Cmd {
+	after := i.list.FilterState()
+	switch {
+	case len(i.ranges) > 1 && before == list.Unfiltered && after == list.Filtering:
+		i.allShown = true
+		i.list.Title = "Episodes"
+		return i.list.SetItems(episodeItems(i.shown))
+	case i.allShown && after == list.Unfiltered:
+		if index, ok := episodeIndex(i.shown, number); ok {
+			i.selectEpisode(index)
+		} else {
+			i.showRange(i.rangeIdx, 0)
+		}
+	}
+	return nil
+}
+
+// nextFocus is the pane tab moves the focus to, the range sidebar only takes it when it's shown
+func (i infoModel) nextFocus() infoFocus {
+	switch i.focus {
+	case focusEpisodes:
+		if len(i.ranges) > 1 {
+			return focusRanges
+		}
+		return focusDescription
+	case focusRanges:
+		return focusDescription
+	}
+	return focusEpisodes
+}
+
+// jumpTo selects the episode numbered input
+func (i *infoModel) jumpTo(input string) tea.Cmd {
+	number, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil {
+		return func() tea.Msg { return noticeMsg{text: fmt.Sprintf("%q is not an episode number", input), warn: true} }
+	}
+	index, ok := episodeIndex(i.shown, number)
+	if _, filler := episodeIndex(i.episodes, number); !ok && filler {
+		return func() tea.Msg {
+			return noticeMsg{text: fmt.Sprintf("episode %d is filler, %s shows it", number, keys.ToggleFiller.Help().Key), warn: true}
+		}
+	}
+	if !ok {
+		return func() tea.Msg { return noticeMsg{text: fmt.Sprintf("there's no episode %d", number), warn: true} }
+	}
+	i.selectEpisode(index)
+	return nil
+}
+
+// Update lays the left pane out again once what it shows changed, so scrolling always knows its length
 func (i infoModel) Update(msg tea.Msg) (infoModel, tea.Cmd) {
+	i, cmd := i.update(msg)
+	if left := i.leftPane(); left != i.left {
+		i.left = left
+		i.desc.SetContent(left.render())
+	}
+	return i, cmd
+}
+
+func (i infoModel) update(msg tea.Msg) (infoModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		if msg.String() == " " || msg.String() == "enter" {
+		if i.editingNotes {
+			switch {
+			case key.Matches(msg, keys.SaveNotes):
+				i.editingNotes = false
+				i.notes.Blur()
+				id, notes := i.id, i.notes.Value()
+				return i, handleUpdateEntry(id, func() error { return setNotes(id, notes) })
+			case key.Matches(msg, keys.Cancel):
+				i.editingNotes = false
+				i.notes.Blur()
+				return i, nil
+			}
+
+			var cmd tea.Cmd
+			i.notes, cmd = i.notes.Update(msg)
+			return i, cmd
+		}
+
+		if i.editingMapping {
+			switch {
+			case key.Matches(msg, keys.Confirm):
+				i.editingMapping = false
+				i.mapping.Blur()
+				return i, handleSaveMapping(i.id, i.mapping.Value())
+			case key.Matches(msg, keys.Cancel):
+				i.editingMapping = false
+				i.mapping.Blur()
+				return i, nil
+			}
+
+			var cmd tea.Cmd
+			i.mapping, cmd = i.mapping.Update(msg)
+			return i, cmd
+		}
+
+		if i.jumping {
+			switch {
+			case key.Matches(msg, keys.Confirm):
+				i.jumping = false
+				i.jump.Blur()
+				return i, i.jumpTo(i.jump.Value())
+			case key.Matches(msg, keys.Cancel):
+				i.jumping = false
+				i.jump.Blur()
+				return i, nil
+			}
+
+			var cmd tea.Cmd
+			i.jump, cmd = i.jump.Update(msg)
+			return i, cmd
+		}
+
+		if i.loaded && i.list.FilterState() == list.Filtering {
+			break
+		}
+
+		if i.picking {
+			switch {
+			case key.Matches(msg, keys.Select):
+				i.picking = false
+				i.spinning = true
+				i.activity = "launching player..."
+				return i, tea.Batch(i.spinner.Tick, handleWatchVariant(i.qualities, i.subFile, i.id, i.qualityEpisode, i.client))
+			case key.Matches(msg, keys.Cancel):
+				i.picking = false
+				return i, nil
+			}
+
+			var cmd tea.Cmd
+			i.qualities, cmd = i.qualities.Update(msg)
+			return i, cmd
+		}
+
+		// moving through the episodes of long series
+		if i.loaded {
+			switch {
+			case key.Matches(msg, keys.NextRange):
+				if i.rangeIdx < len(i.ranges)-1 {
+					i.showRange(i.rangeIdx+1, 0)
+				}
+				return i, nil
+
+			case key.Matches(msg, keys.PrevRange):
+				if i.rangeIdx > 0 {
+					i.showRange(i.rangeIdx-1, 0)
+				}
+				return i, nil
+
+			case key.Matches(msg, keys.JumpToEpisode):
+				ti := textinput.New()
+				ti.Placeholder = "episode number"
+				ti.Width = i.layout.listWidth
+				i.jump = ti
+				i.jumping = true
+				return i, i.jump.Focus()
+
+			case key.Matches(msg, keys.NextUnwatched):
+				index, ok := nextUnwatched(i.shown, i.watched)
+				if !ok {
+					return i, func() tea.Msg { return noticeMsg{text: "every episode is watched", warn: true} }
+				}
+				i.selectEpisode(index)
+				return i, nil
+
+			case key.Matches(msg, keys.ToggleFiller):
+				number := 0
+				if ep, ok := i.list.SelectedItem().(episode); ok {
+					number = ep.Number
+				}
+				i.hideFiller = !i.hideFiller
+				i.showEpisodes(number)
+				return i, nil
+			}
+		}
+
+		if key.Matches(msg, keys.SwitchFocus) {
+			i.focus = i.nextFocus()
+			return i, nil
+		}
+
+		// the range sidebar moves through the ranges with the cursor keys of the list, watch goes back to the episodes
+		if i.loaded && i.focus == focusRanges {
+			switch {
+			case key.Matches(msg, i.list.KeyMap.CursorUp):
+				if i.rangeIdx > 0 {
+					i.showRange(i.rangeIdx-1, 0)
+				}
+				return i, nil
+			case key.Matches(msg, i.list.KeyMap.CursorDown):
+				if i.rangeIdx < len(i.ranges)-1 {
+					i.showRange(i.rangeIdx+1, 0)
+				}
+				return i, nil
+			case key.Matches(msg, keys.Watch):
+				i.focus = focusEpisodes
+				return i, nil
+			}
+		}
+
+		if key.Matches(msg, keys.Watch) {
 			// Start spinner for launching mpv
 			i.spinning = true
+			i.activity = "launching player..."
 			return i, tea.Batch(i.spinner.Tick, handleWatchAnime(i.list, i.id, i.lang, i.client))
 		}
 
 		// toggle between sub and dub
-		if msg.String() == "d" {
+		if key.Matches(msg, keys.ToggleDub) {
 			if i.lang == "sub" {
 				i.lang = "dub"
 				return i, nil
@@ -343,39 +779,120 @@ func (i infoModel) Update(msg tea.Msg) (infoModel, tea.Cmd) {
 			return i, nil
 		}
 
-		if msg.String() == "c" {
-			if i.client == "mpv" {
-				i.client = "browser"
-				return i, nil
-			}
-			i.client = "mpv"
+		if key.Matches(msg, keys.ToggleClient) {
+			i.client = nextClient(i.client)
 			return i, nil
 		}
 
+		// the browser player embeds its own stream so only mpv can pick a variant
+		if key.Matches(msg, keys.Quality) {
+			if i.client == "browser" {
+				return i, func() tea.Msg {
+					return noticeMsg{text: "quality selection needs the mpv or terminal client", warn: true}
+				}
+			}
+			i.spinning = true
+			i.activity = "loading qualities..."
+			return i, tea.Batch(i.spinner.Tick, handlePickQuality(i.list, i.lang))
+		}
+
+		id := i.id
+		switch {
+		case key.Matches(msg, keys.ScoreUp):
+			score := min(i.entry.score+1, 10)
+			return i, handleUpdateEntry(id, func() error { return setScore(id, score) })
+
+		case key.Matches(msg, keys.ScoreDown):
+			score := max(i.entry.score-1, 0)
+			return i, handleUpdateEntry(id, func() error { return setScore(id, score) })
+
+		case key.Matches(msg, keys.Rewatch):
+			return i, handleUpdateEntry(id, func() error { return incrementRewatches(id) })
+
+		case key.Matches(msg, keys.EditMapping):
+			ti := textinput.New()
+			ti.Placeholder = "mal=<id> anilist=<id> kitsu=<id>, empty to look them up again"
+			ti.Width = i.layout.descWidth
+			ti.SetValue(formatMapping(i.ids))
+			ti.CursorEnd()
+			i.mapping = ti
+			i.editingMapping = true
+			return i, i.mapping.Focus()
+
+		case key.Matches(msg, keys.ToggleSync):
+			sync := !i.entry.sync
+			return i, handleUpdateEntry(id, func() error { return setSync(id, sync) })
+
+		case key.Matches(msg, keys.EditNotes):
+			if !i.inWatchlist {
+				return i, func() tea.Msg { return noticeMsg{text: "add the anime to your watchlist first", warn: true} }
+			}
+			ta := textarea.New()
+			ta.Placeholder = "your thoughts on " + i.name
+			ta.SetWidth(i.layout.descWidth)
+			ta.SetHeight(6)
+			ta.SetValue(i.entry.notes)
+			i.notes = ta
+			i.editingNotes = true
+			return i, i.notes.Focus()
+		}
+
 	case tea.WindowSizeMsg:
-		i.leftWidth = int(float64(msg.Width) * 0.3)
-		i.rightWidth = msg.Width - i.leftWidth
+		i.resize(msg.Width, msg.Height)
 
 	case episodesMsg:
 		i.spinning = false
-		i.loaded = true
 
-		items := make([]list.Item, len(msg.episodes))
-		for i, ep := range msg.episodes {
-			items[i] = ep
+		// episodes are fetched again after playback, the cursor stays on the same episode
+		number := 0
+		if ep, ok := i.list.SelectedItem().(episode); ok && i.loaded {
+			number = ep.Number
 		}
-		l := list.New(items, list.NewDefaultDelegate(), 0, 0)
-		l.Title = "Episodes"
 
-		// Update list size
-		w, v := docStyle.GetFrameSize()
-		l.SetSize(i.rightWidth-w, i.height-v)
+		i.loaded = true
+		i.episodes, i.watched = msg.episodes, msg.watched
 
+		l := newList(nil)
+		l.SetDelegate(newEpisodeDelegate())
 		setCustomHelp(&l, infoPage)
 		i.list = l
+		i.showEpisodes(number)
+
+	case entryMsg:
+		i.entry = msg.entry
+		i.inWatchlist = true
+		return i, nil
+
+	case mappingMsg:
+		i.ids = msg.ids
+		return i, nil
+
+	case posterMsg:
+		if msg.animeId == i.id {
+			i.poster = msg.img
+			i.posterView = renderPoster(i.poster, i.layout.descWidth, imageMode())
+		}
+		return i, nil
+
+	case qualitiesMsg:
+		i.spinning = false
+
+		items := make([]list.Item, len(msg.variants))
+		for i, v := range msg.variants {
+			items[i] = v
+		}
+		l := newList(items)
+		l.Title = fmt.Sprintf("Quality - %s", msg.episode.Title())
+		l.SetFilteringEnabled(false)
+
+		l.SetSize(i.layout.listWidth, i.layout.listHeight)
+
+		i.qualities = l
+		i.qualityEpisode = msg.episode
+		i.subFile = msg.subFile
+		i.picking = true
 
 	case errMsg:
-		i.err = msg.err
 		i.spinning = false
 		return i, nil
 	}
@@ -386,69 +903,314 @@ func (i infoModel) Update(msg tea.Msg) (infoModel, tea.Cmd) {
 	i.spinner, spinnerCmd = i.spinner.Update(msg)
 	cmds = append(cmds, spinnerCmd)
 
+	// keys scroll the focused pane only
+	if _, ok := msg.(tea.KeyMsg); ok && i.focus == focusDescription {
+		var descCmd tea.Cmd
+		i.desc, descCmd = i.desc.Update(msg)
+		return i, tea.Batch(append(cmds, descCmd)...)
+	}
+
 	if i.loaded {
+		number := 0
+		if ep, ok := i.list.SelectedItem().(episode); ok {
+			number = ep.Number
+		}
+		before := i.list.FilterState()
+
 		var listCmd tea.Cmd
 		i.list, listCmd = i.list.Update(msg)
-		cmds = append(cmds, listCmd)
+		cmds = append(cmds, listCmd, i.filterAcross(before, number))
 	}
 
 	return i, tea.Batch(cmds...)
 }
 
-func (i infoModel) View() string {
-	if i.err != nil {
-		return docStyle.Render(i.err.Error())
+func (i infoModel) entrySummary() string {
+	summary := i.entry.status.String()
+	if i.entry.score != 0 {
+		summary += fmt.Sprintf(" · score %d/10", i.entry.score)
+	}
+	if i.entry.rewatches != 0 {
+		summary += fmt.Sprintf(" · rewatched %dx", i.entry.rewatches)
+	}
+	if !i.entry.sync {
+		summary += " · sync off"
 	}
+	return summary
+}
 
-	i.name = lipgloss.NewStyle().
-		Background(lipgloss.Color("62")).
-		Foreground(lipgloss.Color("230")).
-		Padding(0, 1).
-		Render(i.name)
+// leftPane is everything in the left pane before it's styled and wrapped, the poster
+// is drawn already. Sections that aren't shown are empty
+type leftPane struct {
+	width  int
+	poster string
+	name   string
+	genres string
+	entry  string
+	ids    string
+	body   string
+	notes  string
+}
 
-	genres := lipgloss.NewStyle().
-		Foreground(lipgloss.AdaptiveColor{Light: "#909090", Dark: "#626262"}).
-		Render("Genres: " + strings.Join(i.genres, ","))
+func (i infoModel) leftPane() leftPane {
+	p := leftPane{
+		width:  i.layout.descWidth,
+		poster: i.posterView,
+		name:   i.name,
+		genres: "Genres: " + strings.Join(i.genres, ",") + "\nPlaying: " + i.lang + " with " + i.client,
+		body:   i.body,
+	}
+	if i.inWatchlist {
+		p.entry = i.entrySummary()
+	}
+	if i.editingMapping {
+		p.ids = "Tracker ids (enter to save, esc to cancel)\n" + i.mapping.View()
+	} else if i.ids.animeId != "" {
+		p.ids = i.ids.String()
+	}
+	switch {
+	case i.editingNotes:
+		p.notes = "Notes (ctrl+s to save, esc to cancel)\n" + i.notes.View()
+	case i.entry.notes != "":
+		p.notes = "Notes\n" + i.entry.notes
+	}
+	return p
+}
 
-	left := lipgloss.NewStyle().
-		Width(i.leftWidth).
-		MaxWidth(i.leftWidth).
-		Render(fmt.Sprintf("%s\n\n%s\n\n%s\n", i.name, genres, i.body))
+// render wraps the left pane to its width
+func (p leftPane) render() string {
+	var sections []string
+	if p.poster != "" {
+		sections = append(sections, p.poster)
+	}
+	sections = append(sections, titleStyle.Render(p.name), mutedStyle.Render(p.genres))
+	for _, section := range []string{p.entry, p.ids, p.body, p.notes} {
+		if section != "" {
+			sections = append(sections, section)
+		}
+	}
+
+	return lipgloss.NewStyle().
+		Width(p.width).
+		MaxWidth(p.width).
+		Render(strings.Join(sections, "\n\n"))
+}
 
-	gap := lipgloss.NewStyle().Width(4).Render()
+// scrollPosition is the line under the description, in the accent colour while it has focus
+func (i infoModel) scrollPosition() string {
+	position := fmt.Sprintf("%s %3.f%%", keys.SwitchFocus.Help().Key, i.desc.ScrollPercent()*100)
+	if i.focus == focusDescription {
+		return accentStyle.Render(position)
+	}
+	return mutedStyle.Render(position)
+}
+
+func (i infoModel) View() string {
+	left := lipgloss.NewStyle().
+		Width(i.layout.descWidth).
+		MaxWidth(i.layout.descWidth).
+		Render(i.desc.View() + "\n" + i.scrollPosition())
 
 	var rightStr string
 	right := lipgloss.NewStyle().
-		Width(i.rightWidth).
-		MaxWidth(i.rightWidth)
+		Width(i.layout.listWidth).
+		MaxWidth(i.layout.listWidth).
+		MaxHeight(i.layout.listHeight)
 
 	switch {
 	case !i.loaded:
 		rightStr = right.Render(fmt.Sprintf("%s loading anime episodes...", i.spinner.View()))
 	case i.spinning:
-		rightStr = right.Render(fmt.Sprintf("%s launching player...", i.spinner.View()))
+		rightStr = right.Render(fmt.Sprintf("%s %s", i.spinner.View(), i.activity))
+	case i.picking:
+		rightStr = right.Render(i.qualities.View())
 	default:
-		rightStr = right.Render(i.list.View())
+		episodes := i.list.View()
+		if len(i.ranges) > 1 {
+			sidebar := lipgloss.NewStyle().Width(rangeWidth).Render(renderRanges(i.ranges, i.shown, i.rangeIdx, i.episodesHeight(), i.focus == focusRanges))
+			episodes = lipgloss.JoinHorizontal(lipgloss.Top, sidebar, episodes)
+		}
+		episodes = mutedStyle.Render(episodeSummary(i.episodes, i.hideFiller)) + "\n" + episodes
+		if i.jumping {
+			episodes = "Jump to episode (enter to go, esc to cancel)\n" + i.jump.View() + "\n" + episodes
+		}
+		rightStr = right.Render(episodes)
 	}
 
-	return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Left, left, gap, rightStr))
+	if i.layout.stacked {
+		return docStyle.Render(lipgloss.JoinVertical(lipgloss.Left, left, "", rightStr))
+	}
+	gap := lipgloss.NewStyle().Width(paneGap).Render()
+	return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, left, gap, rightStr))
 }
 
 // watchlist page
 type watchlistModel struct {
 	list    list.Model
-	spinner spinner.Model
-	err     error
-	loaded  bool
-	width   int
-	height  int
+	lists   []animeList
+	listId  int
+	entries []watchlistItem
+	filter  int    // 0 shows every status, otherwise watchStatuses[filter-1]
+	tag     string // only entries with this tag are shown when set
+	sort    int    // index into watchlistSorts
+	input   textinput.Model
+	prompt  watchlistPrompt
+	// confirmDelete is set after the first press of the delete list key
+	confirmDelete bool
+	spinner       spinner.Model
+	loaded        bool
+	compact       bool
+	width         int
+	height        int
+}
+
+// watchlistPrompt is what the text input of the watchlist page is asking for
+type watchlistPrompt int
+
+const (
+	noPrompt watchlistPrompt = iota
+	tagsPrompt
+	importPrompt
+)
+
+// watchlistSorts are the orders the watchlist can be sorted in, entries arrive newest first
+var watchlistSorts = []struct {
+	name string
+	less func(a, b watchlistItem) bool
+}{
+	{"recently added", nil},
+	{"score", func(a, b watchlistItem) bool { return a.score > b.score }},
+	{"rewatches", func(a, b watchlistItem) bool { return a.rewatches > b.rewatches }},
+	{"name", func(a, b watchlistItem) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }},
 }
 
 func initWatchlistModel() watchlistModel {
-	s := spinner.New()
-	s.Spinner = spinner.Points
-	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
-	return watchlistModel{spinner: s}
+	s := newSpinner()
+
+	ti := textinput.New()
+	ti.Width = 40
+
+	return watchlistModel{listId: defaultListId, spinner: s, input: ti}
+}
+
+// filterName returns the name of the status tab at index i
+func filterName(i int) string {
+	if i == 0 {
+		return "All"
+	}
+	return watchStatuses[i-1].String()
+}
+
+func (w watchlistModel) listName() string {
+	for _, l := range w.lists {
+		if l.id == w.listId {
+			return l.name
+		}
+	}
+	return "Watchlist"
+}
+
+// hasTag reports whether an entry passes the tag filter
+func (w watchlistModel) hasTag(entry watchlistItem) bool {
+	return w.tag == "" || slices.Contains(entry.tags, w.tag)
+}
+
+func (w watchlistModel) countEntries(filter int) int {
+	count := 0
+	for _, entry := range w.entries {
+		if w.hasTag(entry) && (filter == 0 || entry.status == watchStatuses[filter-1]) {
+			count++
+		}
+	}
+	return count
+}
+
+// allTags returns every tag used in the current list
+func (w watchlistModel) allTags() []string {
+	var tags []string
+	for _, entry := range w.entries {
+		for _, tag := range entry.tags {
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// nextTag cycles the tag filter through no tag and every tag in the list
+func (w watchlistModel) nextTag() string {
+	tags := w.allTags()
+	i := slices.Index(tags, w.tag)
+	if i+1 < len(tags) {
+		return tags[i+1]
+	}
+	return ""
+}
+
+// switchList returns the list id offset lists away from the current one
+func (w watchlistModel) switchList(offset int) int {
+	if len(w.lists) == 0 {
+		return w.listId
+	}
+	i := slices.IndexFunc(w.lists, func(l animeList) bool { return l.id == w.listId })
+	i = (i + offset + len(w.lists)) % len(w.lists)
+	return w.lists[i].id
+}
+
+// applyFilter shows the entries matching the current status tab and tag
+func (w *watchlistModel) applyFilter() tea.Cmd {
+	var entries []watchlistItem
+	for _, entry := range w.entries {
+		if w.hasTag(entry) && (w.filter == 0 || entry.status == watchStatuses[w.filter-1]) {
+			entries = append(entries, entry)
+		}
+	}
+
+	sorting := watchlistSorts[w.sort]
+	if sorting.less != nil {
+		sort.SliceStable(entries, func(i, j int) bool { return sorting.less(entries[i], entries[j]) })
+	}
+
+	items := make([]list.Item, len(entries))
+	for i, entry := range entries {
+		items[i] = entry
+	}
+
+	w.list.Title = fmt.Sprintf("%s · %s (%d) · by %s", w.listName(), filterName(w.filter), len(items), sorting.name)
+	if w.tag != "" {
+		w.list.Title += " · #" + w.tag
+	}
+	return w.list.SetItems(items)
+}
+
+func (w *watchlistModel) setListSize() {
+	width, height := docStyle.GetFrameSize()
+	w.list.SetSize(w.width-width, w.height-height-1) // leave room for the status tabs
+}
+
+// loadList shows the spinner and fetches the given list
+func (w *watchlistModel) loadList(listId int) tea.Cmd {
+	w.listId = listId
+	w.loaded = false
+	w.tag = ""
+	return tea.Batch(w.spinner.Tick, retryable(func() tea.Msg { return fetchWatchlist(listId) }))
+}
+
+// entriesMsg carries fresh watchlist entries without refetching the anime they belong to
+type entriesMsg struct{ entries []watchlistEntry }
+
+// refreshEntries reloads the entries of the current list from the database
+func (w watchlistModel) refreshEntries() tea.Cmd {
+	listId := w.listId
+	return func() tea.Msg {
+		entries, err := getWatchlist(listId)
+		if err != nil {
+			return noticeMsg{err: err}
+		}
+		return entriesMsg{entries}
+	}
 }
 
 func (w watchlistModel) Update(msg tea.Msg) (watchlistModel, tea.Cmd) {
@@ -457,41 +1219,179 @@ func (w watchlistModel) Update(msg tea.Msg) (watchlistModel, tea.Cmd) {
 		w.width = msg.Width
 		w.height = msg.Height
 		if w.loaded {
-			width, height := docStyle.GetFrameSize()
-			w.list.SetSize(msg.Width-width, msg.Height-height)
+			w.setListSize()
 		}
 
 	case watchlistMsg:
-		items := make([]list.Item, len(msg.animes))
-		for i, a := range msg.animes {
-			items[i] = a
+		// coming back to the same list keeps its cursor and filter
+		var state listState
+		if w.loaded && w.listId == msg.listId {
+			state = saveListState(w.list)
 		}
-		l := list.New(items, list.NewDefaultDelegate(), 0, 0)
-		l.Title = "Watchlist"
-
-		// update list size
-		wi, vi := docStyle.GetFrameSize()
-		l.SetSize(w.width-wi, w.height-vi)
 
+		l := newAnimeList(nil, w.compact)
 		setCustomHelp(&l, watchlistPage)
 
 		w.list = l
+		w.lists = msg.lists
+		w.listId = msg.listId
+		w.entries = msg.items
 		w.loaded = true
+		w.setListSize()
+		cmd := w.applyFilter()
+		state.restore(&w.list)
+		return w, cmd
+
+	case entryMsg:
+		for i := range w.entries {
+			if w.entries[i].ID == msg.entry.animeId {
+				w.entries[i].watchlistEntry = msg.entry
+			}
+		}
+		return w, w.applyFilter()
+
+	case syncResultMsg:
+		return w, w.refreshEntries()
+
+	case entriesMsg:
+		for i := range w.entries {
+			for _, entry := range msg.entries {
+				if w.entries[i].ID == entry.animeId {
+					w.entries[i].watchlistEntry = entry
+				}
+			}
+		}
+		return w, w.applyFilter()
 
 	case tea.KeyMsg:
-		if w.list.FilterState() == list.Filtering {
+		if w.prompt != noPrompt {
+			switch {
+			case key.Matches(msg, keys.Confirm):
+				prompt, value := w.prompt, w.input.Value()
+				w.prompt = noPrompt
+				w.input.Blur()
+
+				switch prompt {
+				case tagsPrompt:
+					if selected, ok := w.list.SelectedItem().(watchlistItem); ok {
+						id, tags := selected.ID, parseTags(value)
+						return w, handleUpdateEntry(id, func() error { return setTags(id, tags) })
+					}
+				case importPrompt:
+					return w, func() tea.Msg { return importWatchlist(value) }
+				}
+				return w, nil
+			case key.Matches(msg, keys.Cancel):
+				w.prompt = noPrompt
+				w.input.Blur()
+				return w, nil
+			}
+
+			var cmd tea.Cmd
+			w.input, cmd = w.input.Update(msg)
+			return w, cmd
+		}
+
+		if !w.loaded || w.list.FilterState() == list.Filtering {
 			break
 		}
-		if msg.String() == " " || msg.String() == "enter" {
-			return w, handleGetAnimeInfo(w.list)
+
+		if !key.Matches(msg, keys.DeleteList) {
+			w.confirmDelete = false
 		}
-		if msg.String() == "r" {
-			handleRemoveFromWatchlist(w.list)
-			return w, func() tea.Msg { return fetchWatchlist() }
+
+		switch {
+		case key.Matches(msg, keys.Info):
+			return w, handleGetAnimeInfo(w.list)
+
+		case key.Matches(msg, keys.RemoveFromWatchlist):
+			return w, handleRemoveFromWatchlist(w.list, w.listId)
+
+		case key.Matches(msg, keys.ChangeStatus):
+			return w, handleChangeStatus(w.list)
+
+		case key.Matches(msg, keys.ToggleSync):
+			if selected, ok := w.list.SelectedItem().(watchlistItem); ok {
+				id, sync := selected.ID, !selected.sync
+				return w, handleUpdateEntry(id, func() error { return setSync(id, sync) })
+			}
+			return w, nil
+
+		case key.Matches(msg, keys.Sort):
+			w.sort = (w.sort + 1) % len(watchlistSorts)
+			return w, w.applyFilter()
+
+		case key.Matches(msg, keys.NextStatusTab):
+			w.filter = (w.filter + 1) % (len(watchStatuses) + 1)
+			w.list.Select(0)
+			return w, w.applyFilter()
+
+		case key.Matches(msg, keys.PrevStatusTab):
+			w.filter = (w.filter + len(watchStatuses)) % (len(watchStatuses) + 1)
+			w.list.Select(0)
+			return w, w.applyFilter()
+
+		case key.Matches(msg, keys.NextList):
+			return w, w.loadList(w.switchList(1))
+
+		case key.Matches(msg, keys.PrevList):
+			return w, w.loadList(w.switchList(-1))
+
+		case key.Matches(msg, keys.FilterTag):
+			w.tag = w.nextTag()
+			w.list.Select(0)
+			return w, w.applyFilter()
+
+		case key.Matches(msg, keys.EditTags):
+			if selected, ok := w.list.SelectedItem().(watchlistItem); ok {
+				w.input.Placeholder = "comma separated tags"
+				w.input.SetValue(strings.Join(selected.tags, ", "))
+				w.input.CursorEnd()
+				w.prompt = tagsPrompt
+				return w, w.input.Focus()
+			}
+			return w, nil
+
+		case key.Matches(msg, keys.Export):
+			return w, exportWatchlist
+
+		case key.Matches(msg, keys.Import):
+			w.input.Placeholder = "path to a json or csv export"
+			w.input.SetValue("")
+			w.prompt = importPrompt
+			return w, w.input.Focus()
+
+		case key.Matches(msg, keys.PullAnilist):
+			return w, tea.Batch(pullAnilist, func() tea.Msg { return noticeMsg{text: "pulling from anilist..."} })
+
+		case key.Matches(msg, keys.DeleteList):
+			if w.listId == defaultListId {
+				return w, func() tea.Msg { return noticeMsg{err: errDefaultList} }
+			}
+			if !w.confirmDelete {
+				w.confirmDelete = true
+				return w, func() tea.Msg {
+					return noticeMsg{text: "press " + keys.DeleteList.Help().Key + " again to delete " + w.listName(), warn: true}
+				}
+			}
+			w.confirmDelete = false
+			listId := w.listId
+			// the list is gone before the watchlist loads, so it isn't in the lists it loads with
+			deleteCmd := func() tea.Msg {
+				if err := deleteList(listId); err != nil {
+					return noticeMsg{err: err}
+				}
+				return nil
+			}
+			return w, tea.Sequence(deleteCmd, w.loadList(defaultListId))
 		}
 
-	case errMsg:
-		w.err = msg.err
+	case importedMsg:
+		text := msg.report.String()
+		if msg.unmatched > 0 {
+			text += fmt.Sprintf(", %d anime couldn't be matched", msg.unmatched)
+		}
+		return w, tea.Batch(func() tea.Msg { return noticeMsg{text: text} }, w.loadList(w.listId))
 	}
 
 	if !w.loaded {
@@ -505,12 +1405,28 @@ func (w watchlistModel) Update(msg tea.Msg) (watchlistModel, tea.Cmd) {
 	return w, cmd
 }
 
+func (w watchlistModel) statusTabs() string {
+	tabs := make([]string, len(watchStatuses)+1)
+	for i := range tabs {
+		tab := fmt.Sprintf("%s %d", filterName(i), w.countEntries(i))
+		if i == w.filter {
+			tabs[i] = activeTabStyle.Render(tab)
+		} else {
+			tabs[i] = inactiveTabStyle.Render(tab)
+		}
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, tabs...)
+}
+
 func (w watchlistModel) View() string {
 	if !w.loaded {
-		return docStyle.Render(fmt.Sprintf("%s loading watchlist...", w.spinner.View()))
+		return docStyle.Render(fmt.Sprintf("%s loading %s...", w.spinner.View(), strings.ToLower(w.listName())))
 	}
-	if w.err != nil {
-		return docStyle.Render(w.err.Error())
+	switch w.prompt {
+	case tagsPrompt:
+		return docStyle.Render(fmt.Sprintf("Tags\n%s\n%s", w.input.View(), w.list.View()))
+	case importPrompt:
+		return docStyle.Render(fmt.Sprintf("Import (merges into your data)\n%s\n%s", w.input.View(), w.list.View()))
 	}
-	return docStyle.Render(w.list.View())
+	return docStyle.Render(fmt.Sprintf("%s\n%s", w.statusTabs(), w.list.View()))
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// runCmd runs cmd and the commands of the batches and sequences it sends, like the
+// program would, and returns every other message in the order they were sent
+func runCmd(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	if msg == nil {
+		return nil
+	}
+	// batches and sequences are slices of commands, sequences aren't exported
+	v := reflect.ValueOf(msg)
+	if v.Kind() == reflect.Slice && v.Type().Elem() == reflect.TypeOf(tea.Cmd(nil)) {
+		var msgs []tea.Msg
+		for i := range v.Len() {
+			msgs = append(msgs, runCmd(v.Index(i).Interface().(tea.Cmd))...)
+		}
+		return msgs
+	}
+	return []tea.Msg{msg}
+}
+
+func TestHandleUpdateEntry(t *testing.T) {
+	useTestDB(t)
+	if err := addAnimeToList(defaultListId, "one-piece-100"); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := runCmd(handleUpdateEntry("one-piece-100", func() error { return setScore("one-piece-100", 7) }))
+	if got, ok := msgs[0].(entryMsg); len(msgs) != 1 || !ok || got.entry.score != 7 {
+		t.Errorf("updating sent %#v, want the updated entry", msgs)
+	}
+
+	msgs = runCmd(handleUpdateEntry("frieren-18542", func() error { return setScore("frieren-18542", 7) }))
+	if got, ok := msgs[0].(noticeMsg); len(msgs) != 1 || !ok || got.err != nil || got.text == "" {
+		t.Errorf("updating an anime outside the watchlist sent %#v, want a notice", msgs)
+	}
+}
+
+func TestInfoFocus(t *testing.T) {
+	long := strings.Repeat("A pirate sets sail.<br>", 100)
+	i := initInfoModel(anime{ID: "one-piece-100", Name: "One Piece", Body: long}, "sub", "mpv", 80, 20)
+	i, _ = i.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+
+	down := tea.KeyMsg{Type: tea.KeyDown}
+	i, _ = i.Update(down)
+	if i.desc.YOffset != 0 {
+		t.Fatalf("description scrolled to %d while the episodes have focus", i.desc.YOffset)
+	}
+
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyTab})
+	if i.focus != focusDescription {
+		t.Fatalf("focus = %v, want the description", i.focus)
+	}
+	i, _ = i.Update(down)
+	i, _ = i.Update(down)
+	if i.desc.YOffset != 2 {
+		t.Errorf("description scrolled to %d, want 2", i.desc.YOffset)
+	}
+
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyTab})
+	if i.focus != focusEpisodes {
+		t.Errorf("focus = %v, want the episodes back", i.focus)
+	}
+}
+
+func TestInfoLeftPane(t *testing.T) {
+	i := initInfoModel(anime{ID: "one-piece-100", Name: "One Piece", Body: "A pirate sets sail."}, "sub", "mpv", 80, 20)
+	i, _ = i.Update(tea.WindowSizeMsg{Width: 80, Height: 20})
+	left := i.left
+	if !strings.Contains(left.render(), "One Piece") {
+		t.Fatalf("left pane = %q, want the name", left.render())
+	}
+
+	i, _ = i.Update(tea.KeyMsg{Type: tea.KeyDown})
+	if i.left != left {
+		t.Errorf("moving through the episodes laid the left pane out again")
+	}
+
+	i, _ = i.Update(entryMsg{entry: watchlistEntry{score: 7}})
+	if i.left == left {
+		t.Errorf("the left pane didn't change with the watchlist entry")
+	}
+}